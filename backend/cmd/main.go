@@ -1,14 +1,27 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	nethttp "net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
+
 	Scheduledjob "github.com/Sumedhvats/pasteCTL_web/cmd/scheduledJob"
-	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	"github.com/Sumedhvats/pasteCTL_web/internal/analytics"
+	"github.com/Sumedhvats/pasteCTL_web/internal/config"
 	"github.com/Sumedhvats/pasteCTL_web/internal/http"
+	"github.com/Sumedhvats/pasteCTL_web/internal/logging"
+	"github.com/Sumedhvats/pasteCTL_web/internal/metrics"
 	pasteService "github.com/Sumedhvats/pasteCTL_web/internal/paste"
+	"github.com/Sumedhvats/pasteCTL_web/internal/tracing"
+	"github.com/Sumedhvats/pasteCTL_web/internal/views"
 	"github.com/Sumedhvats/pasteCTL_web/internal/ws"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -16,26 +29,165 @@ import (
 )
 
 func main() {
-	db.Init()
-	defer db.Close()
-	pasteRepo := db.NewRepo()
-	pasteService := pasteService.NewPasteService(pasteRepo)
-	go Scheduledjob.StartScheduler(pasteService)
+	envErr := godotenv.Load()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+	cfg, _, err := config.Load("pastectl", os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logger, err := logging.New(os.Stderr, cfg.Logging.Level, cfg.Logging.Format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+	if envErr != nil {
+		slog.Debug("no .env file loaded", "error", envErr)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		fatal("unable to set up tracing", err)
+	}
+
+	store, err := openStorage(ctx, cfg)
+	if err != nil {
+		fatal("unable to open storage", err)
+	}
+	defer store.close()
+	// A SQLite file is private to this process, so it is always brought up
+	// to date; shared Postgres schemas are only migrated when asked.
+	if cfg.Storage.MigrateOnStart || store.driver == "sqlite" {
+		if err := store.migrateUp(ctx); err != nil {
+			store.close()
+			fatal("migration failed", err)
+		}
+	}
+	listenCache := store.enableCache(cfg.Cache)
+	pasteService := pasteService.NewPasteServiceWithOptions(store.repo, pasteService.Options{
+		IDLength:      cfg.Paste.IDLength,
+		IDAlphabet:    cfg.Paste.IDAlphabet,
+		ReservedSlugs: cfg.Paste.ReservedSlugs,
+	})
+
+	scheduler := Scheduledjob.NewScheduler(pasteService, time.Duration(cfg.Scheduler.Interval))
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	var background sync.WaitGroup
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		scheduler.Run(backgroundCtx)
+	}()
+
+	health := http.NewHealthHandler()
+	if store.ping != nil {
+		health.AddCheck("database", func(ctx context.Context) (any, error) {
+			return gin.H{"driver": store.driver}, store.ping(ctx)
+		})
+	}
+	if store.migrator != nil {
+		health.AddCheck("migrations", func(ctx context.Context) (any, error) {
+			pending, err := store.migrator.Pending(ctx)
+			if err == nil && pending > 0 {
+				err = fmt.Errorf("%d migration(s) pending", pending)
+			}
+			return gin.H{"pending": pending}, err
+		})
+	}
+	health.AddCheck("scheduler", func(ctx context.Context) (any, error) {
+		st := scheduler.Status()
+		if !st.Running {
+			return st, errors.New("scheduler is not running")
+		}
+		return st, nil
+	})
+
+	viewCounter := views.NewCounter(pasteService, views.Options{
+		DedupWindow: time.Duration(cfg.Views.DedupWindow),
+	})
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		viewCounter.Run(backgroundCtx, time.Duration(cfg.Views.FlushInterval))
+	}()
+
+	if listenCache != nil {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			listenCache(backgroundCtx)
+		}()
+	}
+
+	recorder := analytics.NewRecorder(store.repo, 0)
+	rollup := Scheduledjob.NewRollup(pasteService, time.Duration(cfg.Analytics.RollupInterval))
+	background.Add(2)
+	go func() {
+		defer background.Done()
+		recorder.Run(backgroundCtx, time.Duration(cfg.Analytics.FlushInterval))
+	}()
+	go func() {
+		defer background.Done()
+		rollup.Run(backgroundCtx)
+	}()
+
 	handler := http.NewHandler(pasteService)
-	log.Println("Server starting on :8080...")
-	r := gin.Default()
-	err:=godotenv.Load()
-	if err!=nil {
-		fmt.Print("cannot load env")
+	handler.Views = viewCounter
+	handler.Analytics = recorder
+	hub := ws.NewHub(pasteService)
+	hub.OnConnect = handler.TrackSession
+	// API users may edit every paste, as they may over PUT.
+	hub.CanEdit = func(c *gin.Context) bool { return http.GetUser(c) != "" }
+	hub.AllowedOrigins = cfg.Server.CORS.AllowOrigins
+	hub.SaveInterval = time.Duration(cfg.Live.SaveInterval)
+	hub.PingInterval = time.Duration(cfg.Live.PingInterval)
+	hub.MaxMessageSize = int64(cfg.Live.MaxMessageKB) << 10
+	hub.SendQueueSize = cfg.Live.SendQueue
+	hub.WriteTimeout = time.Duration(cfg.Live.WriteTimeout)
+	hub.MessageRate = cfg.Live.MessageRate
+	hub.MessageBurst = cfg.Live.MessageBurst
+	hub.MaxRoomConnections = cfg.Live.MaxRoomConnections
+	hub.OutboxSize = cfg.Live.OutboxSize
+	if cfg.Live.PubSub == "postgres" {
+		hub.Bus = ws.NewPGBus(store.pool)
 	}
-	frontend_url:=os.Getenv("FRONTEND_URL")
+	handler.Live = hub
+	handler.Expiries = make(map[string]time.Duration, len(cfg.Paste.Expiries))
+	for name, d := range cfg.Paste.Expiries {
+		handler.Expiries[name] = time.Duration(d)
+	}
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.Use(metrics.Middleware())
+	r.Use(tracing.Middleware()...)
+	// RequestID runs inside the tracing middleware so its logger can carry
+	// the trace ID, and it replaces gin's plain-text access log.
+	r.Use(http.RequestID())
+	r.Use(http.Authenticate(cfg.Auth.Tokens))
 	config := cors.DefaultConfig()
-	config.AllowOrigins = []string{"https://www.paste.sumedh.app","https://www.paste.sumedh.app/","https://paste.sumedh.app","https://paste.sumedh.app/","https://localhost:3000", frontend_url}
+	config.AllowOrigins = cfg.Server.CORS.AllowOrigins
 	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
 	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization", "Accept", "User-Agent", "Cache-Control", "Pragma"}
 	config.ExposeHeaders = []string{"Content-Length"}
 	config.AllowCredentials = true
-	config.MaxAge = 12 * time.Hour
+	config.MaxAge = time.Duration(cfg.Server.CORS.MaxAge)
+
+	r.GET("/healthz", health.LivenessHandler)
+	r.GET("/readyz", health.ReadinessHandler)
+	r.GET("/version", health.VersionHandler)
+	r.GET("/metrics", metrics.Handler())
 
 	r.Use(cors.New(config))
 	r.POST("/api/pastes", handler.CreatePasteHandler)
@@ -43,8 +195,87 @@ func main() {
 	r.GET("/api/pastes/:id/raw", handler.GetContentHandler)
 	r.PUT("/api/pastes/:id", handler.UpdatePasteHandler)
 	r.PUT("/api/pastes/:id/view", handler.UpdateViewsHandler)
-	r.GET("/api/ws/:id", ws.PasteHandler)
-	if err := r.Run(":8080"); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	r.GET("/api/pastes/:id/stats", handler.StatsHandler)
+	r.GET("/api/pastes/:id/revisions", handler.RevisionsHandler)
+	r.GET("/api/pastes/:id/participants", handler.ParticipantsHandler)
+	r.GET("/api/pastes/:id/events", handler.EventsHandler)
+	r.GET("/api/ws/:id", hub.PasteHandler)
+
+	srv := &nethttp.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("server starting", "addr", cfg.Server.Addr, "storage", store.driver)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, nethttp.ErrServerClosed) {
+			slog.Error("server failed", "error", err)
+		}
+	case <-ctx.Done():
+		slog.Info("shutdown signal received, draining", "drain_delay", time.Duration(cfg.Server.DrainDelay))
+	}
+	stop()
+
+	// Fail readiness first so the load balancer drains this instance while
+	// the listener still accepts the requests already routed to it.
+	health.SetReady(false)
+	time.Sleep(time.Duration(cfg.Server.DrainDelay))
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout))
+	defer cancel()
+
+	// Shutdown closes the listener and waits for ordinary requests, but it
+	// does not track hijacked WebSocket connections, so close those in
+	// parallel with a restart code the frontend reconnects on.
+	var drain sync.WaitGroup
+	drain.Add(2)
+	go func() {
+		defer drain.Done()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("HTTP shutdown incomplete", "error", err)
+		}
+	}()
+	go func() {
+		defer drain.Done()
+		if err := hub.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("WebSocket shutdown incomplete", "error", err)
+		}
+	}()
+	drain.Wait()
+
+	stopBackground()
+	background.Wait()
+	// Draining may have used up shutdownCtx, and the final writes must
+	// not be skipped for that, so they get a deadline of their own.
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancelFlush()
+	// No request can record a view any more, so this write is the last.
+	if err := viewCounter.Flush(flushCtx); err != nil {
+		slog.Error("flushing view counts on shutdown failed", "error", err)
+	}
+	if err := recorder.Flush(flushCtx); err != nil {
+		slog.Error("flushing analytics events on shutdown failed", "error", err)
 	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Warn("flushing traces failed", "error", err)
+	}
+	slog.Info("server stopped")
+	// The deferred store.close releases the database pool last.
+}
+
+// flushTimeout bounds the writes of pending views and analytics events
+// on shutdown.
+const flushTimeout = 5 * time.Second
+
+// fatal logs err and exits. Deferred calls do not run, so callers release
+// anything that must not leak first.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -0,0 +1,47 @@
+package Scheduledjob
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/metrics"
+	pasteService "github.com/Sumedhvats/pasteCTL_web/internal/paste"
+)
+
+// Rollup folds recorded analytics events into the per-paste stats tables
+// on a fixed interval.
+type Rollup struct {
+	svc      pasteService.PasteService
+	interval time.Duration
+}
+
+func NewRollup(svc pasteService.PasteService, interval time.Duration) *Rollup {
+	return &Rollup{
+		svc:      svc,
+		interval: interval,
+	}
+}
+
+// Run rolls up every interval until ctx is cancelled.
+func (r *Rollup) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n, err := r.svc.RollupStats(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				metrics.AnalyticsRollupFailures.Inc()
+				slog.Error("analytics rollup failed", "error", err)
+			}
+			continue
+		}
+		metrics.AnalyticsRolledUp.Add(float64(n))
+		slog.Debug("analytics rollup finished", "events", n)
+	}
+}
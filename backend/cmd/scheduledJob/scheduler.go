@@ -1,22 +1,104 @@
 package Scheduledjob
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"sync"
 	"time"
 
+	"github.com/Sumedhvats/pasteCTL_web/internal/metrics"
 	pasteService "github.com/Sumedhvats/pasteCTL_web/internal/paste"
 )
-func StartScheduler(svc pasteService.PasteService) {
-	// Create a Ticker that ticks every 2 hours
-	ticker := time.NewTicker(2 * time.Hour)
+
+// Status describes the scheduler for the readiness probe.
+type Status struct {
+	Running   bool       `json:"running"`
+	Interval  string     `json:"interval"`
+	LastRun   *time.Time `json:"last_run,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	NextRun   *time.Time `json:"next_run,omitempty"`
+}
+
+// Scheduler deletes expired pastes on a fixed interval.
+type Scheduler struct {
+	svc      pasteService.PasteService
+	interval time.Duration
+
+	mu      sync.Mutex
+	running bool
+	lastRun time.Time
+	lastErr error
+	nextRun time.Time
+}
+
+func NewScheduler(svc pasteService.PasteService, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		svc:      svc,
+		interval: interval,
+	}
+}
+
+// Run deletes expired pastes every interval until ctx is cancelled. A
+// cleanup already in progress sees the same cancellation.
+func (s *Scheduler) Run(ctx context.Context) {
+	// Create a Ticker that ticks every interval
+	ticker := time.NewTicker(s.interval)
 	defer ticker.Stop()
 
-	// An infinite loop to run the scheduler
-	for range ticker.C {
-		log.Println("Running scheduled paste cleanup...")
-		if err := svc.DeleteExpiredPastes(); err != nil {
-			log.Printf("Scheduler failed to clean up pastes: %v", err)
+	s.mu.Lock()
+	s.running = true
+	s.nextRun = time.Now().Add(s.interval)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.running = false
+		s.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("scheduler stopped")
+			return
+		case <-ticker.C:
 		}
-		log.Println("Scheduled paste cleanup finished.")
+		slog.Debug("running scheduled paste cleanup")
+		start := time.Now()
+		deleted, err := s.svc.DeleteExpiredPastes(ctx)
+		metrics.CleanupDuration.Observe(time.Since(start).Seconds())
+		if err != nil {
+			metrics.CleanupFailures.Inc()
+			slog.Error("scheduled paste cleanup failed", "error", err)
+		} else {
+			metrics.CleanupDeleted.Add(float64(deleted))
+			metrics.CleanupLastSuccess.SetToCurrentTime()
+		}
+		s.mu.Lock()
+		s.lastRun, s.lastErr = time.Now(), err
+		s.nextRun = s.lastRun.Add(s.interval)
+		s.mu.Unlock()
+		slog.Info("scheduled paste cleanup finished", "deleted", deleted, "duration", time.Since(start))
+	}
+}
+
+// Status returns a snapshot of the scheduler's state.
+func (s *Scheduler) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := Status{
+		Running:  s.running,
+		Interval: s.interval.String(),
+	}
+	if !s.lastRun.IsZero() {
+		t := s.lastRun
+		st.LastRun = &t
+	}
+	if s.lastErr != nil {
+		st.LastError = s.lastErr.Error()
+	}
+	if s.running {
+		t := s.nextRun
+		st.NextRun = &t
 	}
-}
\ No newline at end of file
+	return st
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/config"
+	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	"github.com/Sumedhvats/pasteCTL_web/internal/metrics"
+	"github.com/Sumedhvats/pasteCTL_web/internal/migrate"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// storage is the backend selected at startup.
+type storage struct {
+	driver string
+	repo   db.Repository
+	// migrator is nil for backends without a schema, i.e. memory.
+	migrator *migrate.Migrator
+	// ping checks connectivity; nil for backends that cannot fail, i.e. memory.
+	ping  func(ctx context.Context) error
+	close func()
+	// pool is the Postgres pool, nil for other backends.
+	pool *pgxpool.Pool
+}
+
+// openStorage connects to the configured backend without touching its
+// schema; callers decide whether to run migrations.
+func openStorage(ctx context.Context, cfg *config.Config) (*storage, error) {
+	queryTimeout := time.Duration(cfg.Database.QueryTimeout)
+	switch cfg.Storage.Driver {
+	case "postgres":
+		pool, err := db.Open(ctx, db.Config{
+			URL:               cfg.Database.URL,
+			MaxConns:          cfg.Database.MaxConns,
+			MinConns:          cfg.Database.MinConns,
+			MaxConnLifetime:   time.Duration(cfg.Database.MaxConnLifetime),
+			MaxConnIdleTime:   time.Duration(cfg.Database.MaxConnIdleTime),
+			HealthCheckPeriod: time.Duration(cfg.Database.HealthCheckPeriod),
+			QueryTimeout:      queryTimeout,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to connect to database: %w", err)
+		}
+		migrator, err := migrate.NewPostgres(pool)
+		if err != nil {
+			pool.Close()
+			return nil, err
+		}
+		if err := metrics.RegisterPool(pool); err != nil {
+			pool.Close()
+			return nil, err
+		}
+		slog.Info("database initialized", "driver", "postgres")
+		return &storage{
+			driver:   "postgres",
+			repo:     db.WithTracing(db.NewRepo(pool, queryTimeout), "postgresql"),
+			migrator: migrator,
+			ping:     pool.Ping,
+			close:    pool.Close,
+			pool:     pool,
+		}, nil
+	case "sqlite":
+		path := cfg.Storage.SQLitePath
+		sqlDB, err := db.OpenSQLite(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open sqlite database: %w", err)
+		}
+		migrator, err := migrate.NewSQLite(sqlDB)
+		if err != nil {
+			sqlDB.Close()
+			return nil, err
+		}
+		slog.Info("database initialized", "driver", "sqlite", "path", path)
+		return &storage{
+			driver:   "sqlite",
+			repo:     db.WithTracing(db.NewSQLiteRepo(sqlDB, queryTimeout), "sqlite"),
+			migrator: migrator,
+			ping:     sqlDB.PingContext,
+			close:    func() { sqlDB.Close() },
+		}, nil
+	case "memory":
+		slog.Warn("using in-memory storage; pastes will not survive a restart")
+		return &storage{
+			driver: "memory",
+			repo:   db.WithTracing(db.NewMemoryRepo(), "memory"),
+			close:  func() {},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Storage.Driver)
+	}
+}
+
+// migrateUp applies pending migrations, logging how many ran.
+func (s *storage) migrateUp(ctx context.Context) error {
+	if s.migrator == nil {
+		return nil
+	}
+	n, err := s.migrator.Up(ctx)
+	if err != nil {
+		return err
+	}
+	slog.Info("migrations applied", "driver", s.driver, "count", n)
+	return nil
+}
+
+// enableCache puts the read cache in front of the repository. With
+// cross-replica invalidation on, it returns the listener to run in the
+// background; otherwise it returns nil.
+func (s *storage) enableCache(cfg config.Cache) (listen func(ctx context.Context)) {
+	if cfg.MaxEntries == 0 {
+		return nil
+	}
+	cache := db.NewCache(db.CacheConfig{
+		MaxEntries: cfg.MaxEntries,
+		MaxBytes:   int64(cfg.MaxMB) << 20,
+		TTL:        time.Duration(cfg.TTL),
+	})
+	var peers db.Broadcaster
+	if cfg.Notify && s.pool != nil {
+		invalidator := db.NewPGInvalidator(s.pool, cache)
+		peers, listen = invalidator, invalidator.Listen
+	}
+	s.repo = db.WithCache(s.repo, cache, peers)
+	slog.Info("paste cache enabled", "max_entries", cfg.MaxEntries, "max_mb", cfg.MaxMB, "notify", peers != nil)
+	return listen
+}
@@ -0,0 +1,126 @@
+// Package analytics buffers per-paste analytics events in memory and writes
+// them to storage in batches. The scheduled rollup job later folds them
+// into the tables behind GET /api/pastes/:id/stats.
+package analytics
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	"github.com/Sumedhvats/pasteCTL_web/internal/metrics"
+)
+
+// DefaultMaxBuffered bounds the events held between flushes when
+// NewRecorder is given zero.
+const DefaultMaxBuffered = 10_000
+
+// Store persists raw events. db.Repository satisfies it.
+type Store interface {
+	RecordEvents(ctx context.Context, events []db.Event) error
+}
+
+// Recorder collects events until the next Flush. Recording never blocks on
+// storage: when the buffer is full, new events are dropped and counted.
+type Recorder struct {
+	store       Store
+	maxBuffered int
+
+	mu     sync.Mutex
+	buffer []db.Event
+}
+
+func NewRecorder(store Store, maxBuffered int) *Recorder {
+	if maxBuffered <= 0 {
+		maxBuffered = DefaultMaxBuffered
+	}
+	return &Recorder{
+		store:       store,
+		maxBuffered: maxBuffered,
+	}
+}
+
+// Record buffers one event of kind for pasteID. visitor and referrer may
+// be empty.
+func (r *Recorder) Record(pasteID, kind, visitor, referrer string) {
+	e := db.Event{
+		PasteID:  pasteID,
+		Kind:     kind,
+		Visitor:  visitor,
+		Referrer: referrer,
+		At:       time.Now(),
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.buffer) >= r.maxBuffered {
+		metrics.AnalyticsDropped.Inc()
+		return
+	}
+	r.buffer = append(r.buffer, e)
+	metrics.AnalyticsEvents.WithLabelValues(kind).Inc()
+}
+
+// Flush writes the buffered events in one batch. If the write fails they
+// are kept for the next flush, as far as the buffer has room.
+func (r *Recorder) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	batch := r.buffer
+	r.buffer = nil
+	r.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := r.store.RecordEvents(ctx, batch)
+	if err == nil {
+		return nil
+	}
+	r.mu.Lock()
+	room := r.maxBuffered - len(r.buffer)
+	if room < len(batch) {
+		metrics.AnalyticsDropped.Add(float64(len(batch) - room))
+		batch = batch[len(batch)-room:]
+	}
+	r.buffer = append(batch, r.buffer...)
+	r.mu.Unlock()
+	return err
+}
+
+// Run flushes every interval until ctx is cancelled. Call Flush once more
+// after requests have drained.
+func (r *Recorder) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := r.Flush(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("flushing analytics events failed", "error", err)
+		}
+	}
+}
+
+// ReferrerDomain reduces a referring URL to its host, without "www." or a
+// port, or returns "" if it has none.
+func ReferrerDomain(ref string) string {
+	if ref == "" {
+		return ""
+	}
+	u, err := url.Parse(ref)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	host = strings.TrimPrefix(host, "www.")
+	if len(host) > 253 {
+		return ""
+	}
+	return host
+}
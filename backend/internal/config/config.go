@@ -0,0 +1,445 @@
+// Package config loads the server configuration from an optional YAML file,
+// environment variables and command-line flags. Later sources override
+// earlier ones: defaults < file < environment < flags.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/pkg"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Server    Server    `yaml:"server"`
+	Storage   Storage   `yaml:"storage"`
+	Database  Database  `yaml:"database"`
+	Cache     Cache     `yaml:"cache"`
+	Scheduler Scheduler `yaml:"scheduler"`
+	Paste     Paste     `yaml:"paste"`
+	Auth      Auth      `yaml:"auth"`
+	Views     Views     `yaml:"views"`
+	Analytics Analytics `yaml:"analytics"`
+	Live      Live      `yaml:"live"`
+	Tracing   Tracing   `yaml:"tracing"`
+	Logging   Logging   `yaml:"logging"`
+}
+
+type Server struct {
+	Addr string `yaml:"addr"`
+	CORS CORS   `yaml:"cors"`
+	// ShutdownTimeout bounds how long in-flight requests and WebSocket
+	// sessions get to finish after SIGTERM.
+	ShutdownTimeout Duration `yaml:"shutdown_timeout"`
+	// DrainDelay is how long /readyz reports not ready before the listener
+	// closes, giving load balancers time to notice. Match it to the health
+	// check interval.
+	DrainDelay Duration `yaml:"drain_delay"`
+}
+
+type CORS struct {
+	AllowOrigins []string `yaml:"allow_origins"`
+	MaxAge       Duration `yaml:"max_age"`
+}
+
+type Storage struct {
+	// Driver is one of postgres, sqlite or memory.
+	Driver         string `yaml:"driver"`
+	SQLitePath     string `yaml:"sqlite_path"`
+	MigrateOnStart bool   `yaml:"migrate_on_start"`
+}
+
+type Database struct {
+	URL               string   `yaml:"url"`
+	MaxConns          int32    `yaml:"max_conns"`
+	MinConns          int32    `yaml:"min_conns"`
+	MaxConnLifetime   Duration `yaml:"max_conn_lifetime"`
+	MaxConnIdleTime   Duration `yaml:"max_conn_idle_time"`
+	HealthCheckPeriod Duration `yaml:"health_check_period"`
+	QueryTimeout      Duration `yaml:"query_timeout"`
+}
+
+type Cache struct {
+	// MaxEntries caps the cached pastes; 0 disables the cache.
+	MaxEntries int `yaml:"max_entries"`
+	// MaxMB caps the memory the cached pastes may use, in MiB.
+	MaxMB int `yaml:"max_mb"`
+	// TTL bounds how stale an entry may be when no invalidation arrives.
+	TTL Duration `yaml:"ttl"`
+	// Notify shares invalidations between replicas over Postgres
+	// LISTEN/NOTIFY. It needs the postgres driver.
+	Notify bool `yaml:"notify"`
+}
+
+type Scheduler struct {
+	// Interval is how often expired pastes are deleted.
+	Interval Duration `yaml:"interval"`
+}
+
+type Paste struct {
+	// Expiries maps the values clients may send as "expire" to lifetimes.
+	Expiries map[string]Duration `yaml:"expiries"`
+	// IDLength is the number of characters in generated paste IDs.
+	IDLength int `yaml:"id_length"`
+	// IDAlphabet lists the characters generated IDs are drawn from.
+	IDAlphabet string `yaml:"id_alphabet"`
+	// ReservedSlugs may not be claimed as custom IDs, in addition to the
+	// built-in list of route names.
+	ReservedSlugs []string `yaml:"reserved_slugs"`
+}
+
+type Auth struct {
+	// Tokens maps user names to API tokens. Requests bearing one of them
+	// are authenticated as that user, may choose custom paste slugs and
+	// may edit every paste: the tokens are admin keys.
+	Tokens map[string]string `yaml:"tokens"`
+}
+
+type Views struct {
+	// FlushInterval is how often aggregated view counts are written.
+	FlushInterval Duration `yaml:"flush_interval"`
+	// DedupWindow is how long repeat views by one visitor are ignored.
+	DedupWindow Duration `yaml:"dedup_window"`
+}
+
+type Analytics struct {
+	// FlushInterval is how often buffered events are written.
+	FlushInterval Duration `yaml:"flush_interval"`
+	// RollupInterval is how often events are folded into the stats
+	// rollups, and so how stale GET /api/pastes/:id/stats may be.
+	RollupInterval Duration `yaml:"rollup_interval"`
+}
+
+type Live struct {
+	// SaveInterval is how long live edits may stay unsaved before the room
+	// writes them back to the paste.
+	SaveInterval Duration `yaml:"save_interval"`
+	// PingInterval is how often connections are pinged; one silent for two
+	// intervals is dropped.
+	PingInterval Duration `yaml:"ping_interval"`
+	// MaxMessageKB is the largest message a client may send, in KiB.
+	MaxMessageKB int `yaml:"max_message_kb"`
+	// SendQueue is how many messages may wait for a slow connection before
+	// it is closed, and WriteTimeout bounds each write to one.
+	SendQueue    int      `yaml:"send_queue"`
+	WriteTimeout Duration `yaml:"write_timeout"`
+	// MessageRate is how many messages a second a client may send after a
+	// burst of MessageBurst.
+	MessageRate  int `yaml:"message_rate"`
+	MessageBurst int `yaml:"message_burst"`
+	// MaxRoomConnections caps the connections and event streams following
+	// one paste on a replica.
+	MaxRoomConnections int `yaml:"max_room_connections"`
+	// OutboxSize is how many live-editing messages may wait to be sent to
+	// the other replicas.
+	OutboxSize int `yaml:"outbox_size"`
+	// PubSub carries edits between replicas: postgres, over LISTEN/NOTIFY,
+	// or memory, for a single replica. It follows the storage driver when
+	// unset.
+	PubSub string `yaml:"pubsub"`
+}
+
+type Tracing struct {
+	// Exporter is off, stdout or otlp. The OTLP endpoint comes from the
+	// standard OTEL_EXPORTER_OTLP_ENDPOINT variable.
+	Exporter    string  `yaml:"exporter"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+type Logging struct {
+	// Level is debug, info, warn or error.
+	Level string `yaml:"level"`
+	// Format is json or text.
+	Format string `yaml:"format"`
+}
+
+// Default returns the configuration used when nothing overrides it.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Addr: ":8080",
+			CORS: CORS{
+				AllowOrigins: []string{
+					"https://www.paste.sumedh.app",
+					"https://paste.sumedh.app",
+					"https://localhost:3000",
+				},
+				MaxAge: Duration(12 * time.Hour),
+			},
+			ShutdownTimeout: Duration(15 * time.Second),
+		},
+		Storage: Storage{
+			Driver:     "postgres",
+			SQLitePath: "pastectl.db",
+		},
+		Database: Database{
+			QueryTimeout: Duration(5 * time.Second),
+		},
+		Cache: Cache{
+			MaxEntries: 10_000,
+			MaxMB:      64,
+			TTL:        Duration(time.Minute),
+		},
+		Scheduler: Scheduler{
+			Interval: Duration(2 * time.Hour),
+		},
+		Paste: Paste{
+			Expiries: map[string]Duration{
+				"1h":  Duration(time.Hour),
+				"24h": Duration(24 * time.Hour),
+				"7d":  Duration(7 * 24 * time.Hour),
+			},
+			IDLength:   8,
+			IDAlphabet: pkg.DefaultAlphabet,
+		},
+		Views: Views{
+			FlushInterval: Duration(10 * time.Second),
+			DedupWindow:   Duration(30 * time.Minute),
+		},
+		Analytics: Analytics{
+			FlushInterval:  Duration(10 * time.Second),
+			RollupInterval: Duration(5 * time.Minute),
+		},
+		Live: Live{
+			SaveInterval:       Duration(5 * time.Second),
+			PingInterval:       Duration(30 * time.Second),
+			MaxMessageKB:       1024,
+			SendQueue:          256,
+			WriteTimeout:       Duration(10 * time.Second),
+			MessageRate:        50,
+			MessageBurst:       100,
+			MaxRoomConnections: 100,
+			OutboxSize:         1024,
+		},
+		Tracing: Tracing{
+			Exporter:    "off",
+			SampleRatio: 1,
+		},
+		Logging: Logging{
+			Level:  "info",
+			Format: "json",
+		},
+	}
+}
+
+// Load builds a Config for the program called name from args, the process
+// environment and, if -config or PASTECTL_CONFIG names one, a YAML file.
+// It returns the positional arguments left after flag parsing.
+func Load(name string, args []string) (*Config, []string, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("PASTECTL_CONFIG"), "path to a YAML config file")
+	flagValues := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		if s.flag != "" {
+			flagValues[s.flag] = fs.String(s.flag, "", s.usage)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	cfg := Default()
+	if *configPath != "" {
+		if err := cfg.loadFile(*configPath); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var errs []error
+	for _, s := range settings {
+		if s.env == "" {
+			continue
+		}
+		if v, ok := os.LookupEnv(s.env); ok && v != "" {
+			if err := s.set(cfg, v); err != nil {
+				errs = append(errs, fmt.Errorf("%s (from $%s): %w", s.key, s.env, err))
+			}
+		}
+	}
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name {
+				if err := s.set(cfg, *flagValues[f.Name]); err != nil {
+					errs = append(errs, fmt.Errorf("%s (from -%s): %w", s.key, s.flag, err))
+				}
+			}
+		}
+	})
+	// FRONTEND_URL predates the config file and adds one origin rather than
+	// replacing the list.
+	if v := os.Getenv("FRONTEND_URL"); v != "" {
+		cfg.Server.CORS.AllowOrigins = append(cfg.Server.CORS.AllowOrigins, v)
+	}
+	if cfg.Live.PubSub == "" {
+		cfg.Live.PubSub = "memory"
+		if cfg.Storage.Driver == "postgres" {
+			cfg.Live.PubSub = "postgres"
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, invalid(errs)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once so a misconfigured
+// deployment can be fixed in one pass.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, msg string) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", key, msg))
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr", "must not be empty")
+	check(len(c.Server.CORS.AllowOrigins) > 0, "server.cors.allow_origins", "must list at least one origin")
+	for _, o := range c.Server.CORS.AllowOrigins {
+		if o == "*" {
+			continue
+		}
+		u, err := url.Parse(o)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"server.cors.allow_origins", fmt.Sprintf("%q is not an http(s) origin", o))
+	}
+	check(c.Server.CORS.MaxAge >= 0, "server.cors.max_age", "must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout", "must be positive")
+	check(c.Server.DrainDelay >= 0, "server.drain_delay", "must not be negative")
+
+	switch c.Storage.Driver {
+	case "postgres":
+		check(c.Database.URL != "", "database.url", "is required for the postgres driver (set DATABASE_URL)")
+	case "sqlite":
+		check(c.Storage.SQLitePath != "", "storage.sqlite_path", "is required for the sqlite driver")
+	case "memory":
+	default:
+		check(false, "storage.driver", fmt.Sprintf("%q is not one of postgres, sqlite, memory", c.Storage.Driver))
+	}
+
+	check(c.Database.MaxConns >= 0, "database.max_conns", "must not be negative")
+	check(c.Database.MinConns >= 0, "database.min_conns", "must not be negative")
+	check(c.Database.MaxConns == 0 || c.Database.MinConns <= c.Database.MaxConns, "database.min_conns", "must not exceed max_conns")
+	check(c.Database.QueryTimeout >= 0, "database.query_timeout", "must not be negative")
+	check(c.Cache.MaxEntries >= 0, "cache.max_entries", "must not be negative")
+	check(c.Cache.MaxEntries == 0 || c.Cache.MaxMB > 0, "cache.max_mb", "must be positive")
+	check(c.Cache.MaxEntries == 0 || c.Cache.TTL > 0, "cache.ttl", "must be positive")
+	check(!c.Cache.Notify || c.Storage.Driver == "postgres", "cache.notify", "needs the postgres driver")
+	check(c.Scheduler.Interval > 0, "scheduler.interval", "must be positive")
+
+	check(len(c.Paste.Expiries) > 0, "paste.expiries", "must allow at least one expiry")
+	for k, d := range c.Paste.Expiries {
+		check(k != "" && k != "never", "paste.expiries", fmt.Sprintf("%q is reserved", k))
+		check(d > 0, "paste.expiries."+k, "must be positive")
+	}
+	check(c.Paste.IDLength >= 4 && c.Paste.IDLength <= 64, "paste.id_length", "must be between 4 and 64")
+	check(validAlphabet(c.Paste.IDAlphabet), "paste.id_alphabet", "must be at least 2 distinct letters, digits, '-' or '_'")
+	for _, w := range c.Paste.ReservedSlugs {
+		check(strings.TrimSpace(w) != "", "paste.reserved_slugs", "must not contain empty words")
+	}
+
+	seen := make(map[string]string, len(c.Auth.Tokens))
+	for user, token := range c.Auth.Tokens {
+		check(user != "", "auth.tokens", "user names must not be empty")
+		check(len(token) >= 16, "auth.tokens."+user, "must be at least 16 characters")
+		if other, ok := seen[token]; ok {
+			check(false, "auth.tokens."+user, "is the same token as "+other)
+		}
+		seen[token] = user
+	}
+
+	check(c.Views.FlushInterval > 0, "views.flush_interval", "must be positive")
+	check(c.Views.DedupWindow >= 0, "views.dedup_window", "must not be negative")
+
+	check(c.Analytics.FlushInterval > 0, "analytics.flush_interval", "must be positive")
+	check(c.Analytics.RollupInterval > 0, "analytics.rollup_interval", "must be positive")
+
+	check(c.Live.SaveInterval > 0, "live.save_interval", "must be positive")
+	check(c.Live.PingInterval > 0, "live.ping_interval", "must be positive")
+	check(c.Live.MaxMessageKB > 0, "live.max_message_kb", "must be positive")
+	check(c.Live.SendQueue > 0, "live.send_queue", "must be positive")
+	check(c.Live.WriteTimeout > 0, "live.write_timeout", "must be positive")
+	check(c.Live.MessageRate > 0, "live.message_rate", "must be positive")
+	check(c.Live.MessageBurst > 0, "live.message_burst", "must be positive")
+	check(c.Live.MaxRoomConnections > 0, "live.max_room_connections", "must be positive")
+	check(c.Live.OutboxSize > 0, "live.outbox_size", "must be positive")
+	switch c.Live.PubSub {
+	case "postgres":
+		check(c.Storage.Driver == "postgres", "live.pubsub", "postgres needs the postgres driver")
+	case "memory":
+	default:
+		check(false, "live.pubsub", fmt.Sprintf("%q is not one of postgres, memory", c.Live.PubSub))
+	}
+
+	switch c.Tracing.Exporter {
+	case "off", "stdout", "otlp":
+	default:
+		check(false, "tracing.exporter", fmt.Sprintf("%q is not one of off, stdout, otlp", c.Tracing.Exporter))
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio", "must be between 0 and 1")
+
+	switch c.Logging.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "logging.level", fmt.Sprintf("%q is not one of debug, info, warn, error", c.Logging.Level))
+	}
+	switch c.Logging.Format {
+	case "json", "text":
+	default:
+		check(false, "logging.format", fmt.Sprintf("%q is not one of json, text", c.Logging.Format))
+	}
+
+	if len(errs) > 0 {
+		return invalid(errs)
+	}
+	return nil
+}
+
+// validAlphabet reports whether a is usable for IDs: URL-safe characters
+// and no repeats, which would make some characters more likely.
+func validAlphabet(a string) bool {
+	if len(a) < 2 {
+		return false
+	}
+	seen := make(map[rune]bool, len(a))
+	for _, r := range a {
+		ok := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_'
+		if !ok || seen[r] {
+			return false
+		}
+		seen[r] = true
+	}
+	return true
+}
+
+func invalid(errs []error) error {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = "  - " + err.Error()
+	}
+	return fmt.Errorf("invalid configuration:\n%s", strings.Join(msgs, "\n"))
+}
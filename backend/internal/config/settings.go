@@ -0,0 +1,209 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting binds one Config field to its environment variable and flag.
+// Both sources are strings, so they share the same parser.
+type setting struct {
+	key   string
+	env   string
+	flag  string
+	usage string
+	set   func(c *Config, v string) error
+}
+
+var settings = []setting{
+	{"server.addr", "LISTEN_ADDR", "addr", "address to listen on", func(c *Config, v string) error {
+		c.Server.Addr = v
+		return nil
+	}},
+	{"server.cors.allow_origins", "CORS_ALLOW_ORIGINS", "cors-origins", "comma-separated allowed CORS origins", func(c *Config, v string) error {
+		c.Server.CORS.AllowOrigins = splitList(v)
+		return nil
+	}},
+	{"server.cors.max_age", "CORS_MAX_AGE", "cors-max-age", "how long browsers may cache preflight responses", durationSetter(func(c *Config) *Duration { return &c.Server.CORS.MaxAge })},
+	{"server.shutdown_timeout", "SHUTDOWN_TIMEOUT", "shutdown-timeout", "how long to drain requests and WebSockets on shutdown", durationSetter(func(c *Config) *Duration { return &c.Server.ShutdownTimeout })},
+	{"server.drain_delay", "DRAIN_DELAY", "drain-delay", "how long readiness fails before the listener closes on shutdown", durationSetter(func(c *Config) *Duration { return &c.Server.DrainDelay })},
+	{"storage.driver", "STORAGE_DRIVER", "storage", "storage backend: postgres, sqlite or memory", func(c *Config, v string) error {
+		c.Storage.Driver = v
+		return nil
+	}},
+	{"storage.sqlite_path", "SQLITE_PATH", "sqlite-path", "database file for the sqlite driver", func(c *Config, v string) error {
+		c.Storage.SQLitePath = v
+		return nil
+	}},
+	{"storage.migrate_on_start", "MIGRATE_ON_START", "migrate", "apply pending migrations before serving", func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		c.Storage.MigrateOnStart = b
+		return err
+	}},
+	{"database.url", "DATABASE_URL", "database-url", "Postgres connection string", func(c *Config, v string) error {
+		c.Database.URL = v
+		return nil
+	}},
+	{"database.max_conns", "DB_MAX_CONNS", "db-max-conns", "maximum pool connections", int32Setter(func(c *Config) *int32 { return &c.Database.MaxConns })},
+	{"database.min_conns", "DB_MIN_CONNS", "db-min-conns", "minimum idle pool connections", int32Setter(func(c *Config) *int32 { return &c.Database.MinConns })},
+	{"database.max_conn_lifetime", "DB_MAX_CONN_LIFETIME", "db-max-conn-lifetime", "recycle pool connections after this long", durationSetter(func(c *Config) *Duration { return &c.Database.MaxConnLifetime })},
+	{"database.max_conn_idle_time", "DB_MAX_CONN_IDLE_TIME", "db-max-conn-idle-time", "close idle pool connections after this long", durationSetter(func(c *Config) *Duration { return &c.Database.MaxConnIdleTime })},
+	{"database.health_check_period", "DB_HEALTH_CHECK_PERIOD", "db-health-check-period", "how often idle pool connections are checked", durationSetter(func(c *Config) *Duration { return &c.Database.HealthCheckPeriod })},
+	{"database.query_timeout", "DB_QUERY_TIMEOUT", "db-query-timeout", "per-query deadline", durationSetter(func(c *Config) *Duration { return &c.Database.QueryTimeout })},
+	{"cache.max_entries", "CACHE_MAX_ENTRIES", "cache-entries", "pastes kept in the read cache (0 disables it)", intSetter(func(c *Config) *int { return &c.Cache.MaxEntries })},
+	{"cache.max_mb", "CACHE_MAX_MB", "cache-mb", "memory limit of the read cache in MiB", intSetter(func(c *Config) *int { return &c.Cache.MaxMB })},
+	{"cache.ttl", "CACHE_TTL", "cache-ttl", "how long a cached paste may be served without revalidation", durationSetter(func(c *Config) *Duration { return &c.Cache.TTL })},
+	{"cache.notify", "CACHE_NOTIFY", "cache-notify", "share cache invalidations between replicas via Postgres LISTEN/NOTIFY", func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		c.Cache.Notify = b
+		return err
+	}},
+	{"scheduler.interval", "CLEANUP_INTERVAL", "cleanup-interval", "how often expired pastes are deleted", durationSetter(func(c *Config) *Duration { return &c.Scheduler.Interval })},
+	{"paste.expiries", "PASTE_EXPIRIES", "expiries", "comma-separated allowed expiries, e.g. 1h,24h,7d,30d", func(c *Config, v string) error {
+		expiries := make(map[string]Duration)
+		for _, name := range splitList(v) {
+			d, err := ParseDuration(name)
+			if err != nil {
+				return err
+			}
+			expiries[name] = Duration(d)
+		}
+		c.Paste.Expiries = expiries
+		return nil
+	}},
+	{"paste.id_length", "PASTE_ID_LENGTH", "id-length", "characters in generated paste IDs", intSetter(func(c *Config) *int { return &c.Paste.IDLength })},
+	{"paste.id_alphabet", "PASTE_ID_ALPHABET", "id-alphabet", "characters generated paste IDs are drawn from", func(c *Config, v string) error {
+		c.Paste.IDAlphabet = v
+		return nil
+	}},
+	{"paste.reserved_slugs", "PASTE_RESERVED_SLUGS", "reserved-slugs", "comma-separated words that may not be used as custom slugs", func(c *Config, v string) error {
+		c.Paste.ReservedSlugs = splitList(v)
+		return nil
+	}},
+	// API tokens are secrets, so there is no flag that would expose them in
+	// the process list.
+	{"auth.tokens", "API_TOKENS", "", "", func(c *Config, v string) error {
+		tokens := make(map[string]string)
+		for _, pair := range splitList(v) {
+			user, token, ok := strings.Cut(pair, ":")
+			if !ok {
+				return fmt.Errorf("%q is not user:token", pair)
+			}
+			tokens[strings.TrimSpace(user)] = strings.TrimSpace(token)
+		}
+		c.Auth.Tokens = tokens
+		return nil
+	}},
+	{"views.flush_interval", "VIEW_FLUSH_INTERVAL", "view-flush-interval", "how often aggregated view counts are written", durationSetter(func(c *Config) *Duration { return &c.Views.FlushInterval })},
+	{"views.dedup_window", "VIEW_DEDUP_WINDOW", "view-dedup-window", "how long repeat views by one visitor are ignored (0 counts all)", durationSetter(func(c *Config) *Duration { return &c.Views.DedupWindow })},
+	{"analytics.flush_interval", "ANALYTICS_FLUSH_INTERVAL", "analytics-flush-interval", "how often buffered analytics events are written", durationSetter(func(c *Config) *Duration { return &c.Analytics.FlushInterval })},
+	{"analytics.rollup_interval", "ANALYTICS_ROLLUP_INTERVAL", "analytics-rollup-interval", "how often analytics events are rolled up for the stats endpoint", durationSetter(func(c *Config) *Duration { return &c.Analytics.RollupInterval })},
+	{"live.save_interval", "LIVE_SAVE_INTERVAL", "live-save-interval", "how long live edits may stay unsaved", durationSetter(func(c *Config) *Duration { return &c.Live.SaveInterval })},
+	{"live.ping_interval", "LIVE_PING_INTERVAL", "live-ping-interval", "how often live connections are pinged", durationSetter(func(c *Config) *Duration { return &c.Live.PingInterval })},
+	{"live.max_message_kb", "LIVE_MAX_MESSAGE_KB", "live-max-message-kb", "largest live-editing message in KiB", intSetter(func(c *Config) *int { return &c.Live.MaxMessageKB })},
+	{"live.send_queue", "LIVE_SEND_QUEUE", "live-send-queue", "messages that may wait for a slow live connection", intSetter(func(c *Config) *int { return &c.Live.SendQueue })},
+	{"live.write_timeout", "LIVE_WRITE_TIMEOUT", "live-write-timeout", "longest write to a live connection", durationSetter(func(c *Config) *Duration { return &c.Live.WriteTimeout })},
+	{"live.message_rate", "LIVE_MESSAGE_RATE", "live-message-rate", "messages a second a live client may send", intSetter(func(c *Config) *int { return &c.Live.MessageRate })},
+	{"live.message_burst", "LIVE_MESSAGE_BURST", "live-message-burst", "messages a live client may send at once", intSetter(func(c *Config) *int { return &c.Live.MessageBurst })},
+	{"live.max_room_connections", "LIVE_MAX_ROOM_CONNECTIONS", "live-max-room-connections", "connections and event streams one live room may have per replica", intSetter(func(c *Config) *int { return &c.Live.MaxRoomConnections })},
+	{"live.outbox_size", "LIVE_OUTBOX_SIZE", "live-outbox-size", "live-editing messages that may wait to reach other replicas", intSetter(func(c *Config) *int { return &c.Live.OutboxSize })},
+	{"live.pubsub", "LIVE_PUBSUB", "live-pubsub", "how live edits reach other replicas: postgres or memory (default follows -storage)", func(c *Config, v string) error {
+		c.Live.PubSub = strings.ToLower(v)
+		return nil
+	}},
+	{"tracing.exporter", "TRACING_EXPORTER", "trace-exporter", "trace exporter: off, stdout or otlp", func(c *Config, v string) error {
+		c.Tracing.Exporter = v
+		return nil
+	}},
+	{"tracing.sample_ratio", "TRACING_SAMPLE_RATIO", "trace-sample-ratio", "fraction of new traces to record", func(c *Config, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		c.Tracing.SampleRatio = f
+		return err
+	}},
+	{"logging.level", "LOG_LEVEL", "log-level", "minimum log level: debug, info, warn or error", func(c *Config, v string) error {
+		c.Logging.Level = strings.ToLower(v)
+		return nil
+	}},
+	{"logging.format", "LOG_FORMAT", "log-format", "log output format: json or text", func(c *Config, v string) error {
+		c.Logging.Format = strings.ToLower(v)
+		return nil
+	}},
+}
+
+func durationSetter(field func(*Config) *Duration) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		d, err := ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = Duration(d)
+		return nil
+	}
+}
+
+func intSetter(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func int32Setter(field func(*Config) *int32) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return err
+		}
+		*field(c) = int32(n)
+		return nil
+	}
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Duration is a time.Duration that reads from YAML as a string such as
+// "90s" or "7d".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// ParseDuration extends time.ParseDuration with a whole-day "d" unit.
+func ParseDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,287 @@
+package db
+
+import (
+	"container/list"
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/metrics"
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheConfig bounds a Cache. Zero fields fall back to the defaults below.
+type CacheConfig struct {
+	MaxEntries int
+	MaxBytes   int64
+	// TTL bounds how stale an entry may get when another replica changes
+	// the paste and no invalidation reaches this one.
+	TTL time.Duration
+}
+
+const (
+	DefaultCacheEntries = 10_000
+	DefaultCacheBytes   = 64 << 20
+	DefaultCacheTTL     = time.Minute
+)
+
+// entryOverhead approximates the memory a cached paste costs beyond its
+// strings.
+const entryOverhead = 200
+
+type cacheEntry struct {
+	paste *Paste
+	size  int64
+	// until is the earlier of the TTL deadline and the paste's expiry.
+	until time.Time
+}
+
+// Cache is a size-bounded LRU of pastes keyed by ID. It never returns an
+// entry past the paste's ExpireAt.
+type Cache struct {
+	maxEntries int
+	maxBytes   int64
+	ttl        time.Duration
+
+	mu    sync.Mutex
+	ll    *list.List // front is most recently used
+	items map[string]*list.Element
+	bytes int64
+	// epoch is bumped by every invalidation so a read that started before
+	// one does not store what it fetched.
+	epoch uint64
+}
+
+func NewCache(cfg CacheConfig) *Cache {
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = DefaultCacheEntries
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = DefaultCacheBytes
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultCacheTTL
+	}
+	return &Cache{
+		maxEntries: cfg.MaxEntries,
+		maxBytes:   cfg.MaxBytes,
+		ttl:        cfg.TTL,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+func (c *Cache) get(id string, now time.Time) (*Paste, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[id]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*cacheEntry)
+	if !now.Before(e.until) {
+		c.removeLocked(el)
+		c.updateGaugesLocked()
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return clonePaste(e.paste), true
+}
+
+// put stores p unless an invalidation happened since epoch was read.
+func (c *Cache) put(p *Paste, epoch uint64, now time.Time) {
+	until := now.Add(c.ttl)
+	if p.ExpireAt != nil {
+		if !now.Before(*p.ExpireAt) {
+			return
+		}
+		if p.ExpireAt.Before(until) {
+			until = *p.ExpireAt
+		}
+	}
+	size := int64(len(p.ID)+len(p.Content)+len(p.Language)+len(p.OwnerHash)+len(p.EditHash)) + entryOverhead
+	// One huge paste should not flush everything else.
+	if size > c.maxBytes/16 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.epoch != epoch {
+		return
+	}
+	if el, ok := c.items[p.ID]; ok {
+		c.removeLocked(el)
+	}
+	c.items[p.ID] = c.ll.PushFront(&cacheEntry{paste: clonePaste(p), size: size, until: until})
+	c.bytes += size
+	for c.ll.Len() > c.maxEntries || c.bytes > c.maxBytes {
+		c.removeLocked(c.ll.Back())
+		metrics.CacheEvictions.Inc()
+	}
+	c.updateGaugesLocked()
+}
+
+func (c *Cache) currentEpoch() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.epoch
+}
+
+// addViews patches the cached view count after a local UpdateViews, which
+// is cheaper than dropping a hot entry every flush.
+func (c *Cache) addViews(id string, count int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[id]; ok {
+		el.Value.(*cacheEntry).paste.Views += count
+	}
+}
+
+// Invalidate drops id from the cache.
+func (c *Cache) Invalidate(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epoch++
+	if el, ok := c.items[id]; ok {
+		c.removeLocked(el)
+		c.updateGaugesLocked()
+	}
+}
+
+// Purge drops every entry, e.g. after invalidations may have been missed.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epoch++
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.bytes = 0
+	c.updateGaugesLocked()
+}
+
+// Len returns the number of cached pastes.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+func (c *Cache) removeExpired(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, el := range c.items {
+		if p := el.Value.(*cacheEntry).paste; p.ExpireAt != nil && !now.Before(*p.ExpireAt) {
+			c.removeLocked(el)
+		}
+	}
+	c.updateGaugesLocked()
+}
+
+func (c *Cache) removeLocked(el *list.Element) {
+	e := c.ll.Remove(el).(*cacheEntry)
+	delete(c.items, e.paste.ID)
+	c.bytes -= e.size
+}
+
+func (c *Cache) updateGaugesLocked() {
+	metrics.CacheEntries.Set(float64(c.ll.Len()))
+	metrics.CacheBytes.Set(float64(c.bytes))
+}
+
+// Broadcaster tells other replicas to drop a paste from their caches.
+type Broadcaster interface {
+	Broadcast(ctx context.Context, id string) error
+}
+
+// cachedRepo serves GetPaste from a Cache and keeps it coherent with the
+// writes that pass through it.
+type cachedRepo struct {
+	Repository
+	cache *Cache
+	peers Broadcaster
+	group singleflight.Group
+}
+
+// WithCache returns next with GetPaste served through cache. Writes
+// invalidate the local entry and, if peers is non-nil, other replicas'.
+func WithCache(next Repository, cache *Cache, peers Broadcaster) Repository {
+	return &cachedRepo{
+		Repository: next,
+		cache:      cache,
+		peers:      peers,
+	}
+}
+
+func (r *cachedRepo) GetPaste(ctx context.Context, id string) (*Paste, error) {
+	if p, ok := r.cache.get(id, time.Now()); ok {
+		metrics.CacheRequests.WithLabelValues("hit").Inc()
+		return p, nil
+	}
+	metrics.CacheRequests.WithLabelValues("miss").Inc()
+
+	// Concurrent misses for one paste share a single query. It runs
+	// detached from any one caller's cancellation; the repository's query
+	// timeout still bounds it.
+	epoch := r.cache.currentEpoch()
+	ch := r.group.DoChan(id, func() (any, error) {
+		p, err := r.Repository.GetPaste(context.WithoutCancel(ctx), id)
+		if err == nil && p != nil {
+			r.cache.put(p, epoch, time.Now())
+		}
+		return p, err
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil || res.Val == nil {
+			return nil, res.Err
+		}
+		return clonePaste(res.Val.(*Paste)), nil
+	}
+}
+
+func (r *cachedRepo) CreatePaste(ctx context.Context, p *Paste) error {
+	// An expired paste with the same ID may still be cached.
+	r.cache.Invalidate(p.ID)
+	return r.Repository.CreatePaste(ctx, p)
+}
+
+func (r *cachedRepo) UpdatePaste(ctx context.Context, p *Paste) error {
+	err := r.Repository.UpdatePaste(ctx, p)
+	r.cache.Invalidate(p.ID)
+	// Callers arriving now must not join a read that began before the write.
+	r.group.Forget(p.ID)
+	if err == nil {
+		r.broadcast(ctx, p.ID)
+	}
+	return err
+}
+
+func (r *cachedRepo) UpdateViews(ctx context.Context, p *Paste, count int) error {
+	if err := r.Repository.UpdateViews(ctx, p, count); err != nil {
+		r.cache.Invalidate(p.ID)
+		return err
+	}
+	r.cache.addViews(p.ID, count)
+	r.broadcast(ctx, p.ID)
+	return nil
+}
+
+func (r *cachedRepo) DeleteExpired(ctx context.Context) (int64, error) {
+	n, err := r.Repository.DeleteExpired(ctx)
+	// Expired entries are never served, so other replicas need no message.
+	r.cache.removeExpired(time.Now())
+	return n, err
+}
+
+func (r *cachedRepo) broadcast(ctx context.Context, id string) {
+	if r.peers == nil {
+		return
+	}
+	if err := r.peers.Broadcast(ctx, id); err != nil {
+		slog.Warn("broadcasting cache invalidation failed", "paste_id", id, "error", err)
+	}
+}
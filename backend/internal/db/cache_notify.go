@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// invalidationChannel is the LISTEN/NOTIFY channel replicas share.
+const invalidationChannel = "pastectl_cache"
+
+// PGInvalidator carries cache invalidations between replicas over Postgres
+// LISTEN/NOTIFY. Each payload is "<origin> <paste id>", where origin
+// identifies the sending process so it can skip its own messages.
+type PGInvalidator struct {
+	pool   *pgxpool.Pool
+	cache  *Cache
+	origin string
+}
+
+func NewPGInvalidator(pool *pgxpool.Pool, cache *Cache) *PGInvalidator {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return &PGInvalidator{
+		pool:   pool,
+		cache:  cache,
+		origin: hex.EncodeToString(b),
+	}
+}
+
+// Broadcast asks every other listening replica to drop id.
+func (p *PGInvalidator) Broadcast(ctx context.Context, id string) error {
+	_, err := p.pool.Exec(ctx, "SELECT pg_notify($1, $2)", invalidationChannel, p.origin+" "+id)
+	return err
+}
+
+// Listen applies invalidations from other replicas until ctx is cancelled.
+// It holds one pool connection while listening. Whenever the connection is
+// lost the whole cache is purged, because messages sent in the meantime
+// are gone.
+func (p *PGInvalidator) Listen(ctx context.Context) {
+	backoff := time.Second
+	for {
+		err := p.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		p.cache.Purge()
+		slog.Warn("cache invalidation listener disconnected", "error", err, "retry_in", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, 30*time.Second)
+	}
+}
+
+func (p *PGInvalidator) listen(ctx context.Context) error {
+	conn, err := p.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// LISTEN state must not leak back into the pool. Hijacking detaches
+	// the connection from conn, so it is used through pc from here on.
+	pc := conn.Hijack()
+	defer pc.Close(context.Background())
+	if _, err := pc.Exec(ctx, "LISTEN "+invalidationChannel); err != nil {
+		return err
+	}
+	// Anything cached before LISTEN took effect may already be stale.
+	p.cache.Purge()
+	for {
+		n, err := pc.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		origin, id, ok := strings.Cut(n.Payload, " ")
+		if !ok || origin == p.origin {
+			continue
+		}
+		p.cache.Invalidate(id)
+	}
+}
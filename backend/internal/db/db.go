@@ -2,35 +2,59 @@ package db
 
 import (
 	"context"
-	"log"
-	"os"
+	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/joho/godotenv"
 )
 
-var DB *pgxpool.Pool
-func Init() {
-	godotenv.Load()
+// Config describes how to connect to Postgres and how the pool behaves.
+// Zero values leave the pgxpool defaults in place.
+type Config struct {
+	URL               string
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
 
-	connStr := os.Getenv("DATABASE_URL")
-	if connStr == "" {
-		log.Fatal("DATABASE_URL environment variable is not set")
-	}
-	pool, err := pgxpool.New(context.Background(), connStr)
+	// QueryTimeout is the per-query deadline applied by the repository.
+	QueryTimeout time.Duration
+}
+
+// DefaultQueryTimeout is used when a Config does not set QueryTimeout.
+const DefaultQueryTimeout = 5 * time.Second
+
+// Open creates a connection pool from cfg and verifies it with a ping.
+// The caller owns the returned pool and must Close it.
+func Open(ctx context.Context, cfg Config) (*pgxpool.Pool, error) {
+	poolCfg, err := pgxpool.ParseConfig(cfg.URL)
 	if err != nil {
-		log.Fatalf("Unable to create connection pool: %v\n", err)
+		return nil, fmt.Errorf("parse database url: %w", err)
 	}
-
-	if err := pool.Ping(context.Background()); err != nil {
-		log.Fatalf("Unable to ping database: %v\n", err)
+	if cfg.MaxConns > 0 {
+		poolCfg.MaxConns = cfg.MaxConns
+	}
+	if cfg.MinConns > 0 {
+		poolCfg.MinConns = cfg.MinConns
+	}
+	if cfg.MaxConnLifetime > 0 {
+		poolCfg.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		poolCfg.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+	if cfg.HealthCheckPeriod > 0 {
+		poolCfg.HealthCheckPeriod = cfg.HealthCheckPeriod
 	}
 
-	DB = pool
-	log.Println("Database initialized")
-}
-func Close() {
-	if DB != nil {
-		DB.Close()
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+	if err != nil {
+		return nil, fmt.Errorf("create connection pool: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("ping database: %w", err)
 	}
-}
\ No newline at end of file
+	return pool, nil
+}
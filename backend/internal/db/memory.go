@@ -0,0 +1,245 @@
+package db
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryRepo is a Repository that keeps pastes in process memory. It mirrors
+// the Postgres repo: expired pastes stay readable until DeleteExpired runs,
+// and updates to unknown IDs are silently ignored.
+type memoryRepo struct {
+	mu     sync.RWMutex
+	pastes map[string]*Paste
+	events []Event
+	stats  map[string]*memoryStats
+
+	revisions    map[string][]Revision
+	lastRevision int64
+}
+
+// memoryStats holds the rollups of one paste.
+type memoryStats struct {
+	hourly    map[hourKind]int64
+	viewers   map[string]struct{}
+	referrers map[string]int64
+}
+
+type hourKind struct {
+	hour time.Time
+	kind string
+}
+
+// NewMemoryRepo returns an empty, concurrency-safe in-memory Repository.
+func NewMemoryRepo() Repository {
+	return &memoryRepo{
+		pastes: make(map[string]*Paste),
+		stats:  make(map[string]*memoryStats),
+
+		revisions: make(map[string][]Revision),
+	}
+}
+
+func clonePaste(p *Paste) *Paste {
+	cp := *p
+	if p.ExpireAt != nil {
+		t := *p.ExpireAt
+		cp.ExpireAt = &t
+	}
+	return &cp
+}
+
+func (r *memoryRepo) CreatePaste(ctx context.Context, p *Paste) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.pastes[p.ID]; ok {
+		return ErrDuplicateID
+	}
+	stored := clonePaste(p)
+	stored.CreatedAt = time.Now()
+	stored.Views = 0
+	stored.OwnerToken = ""
+	stored.EditToken = ""
+	r.pastes[p.ID] = stored
+	return nil
+}
+
+func (r *memoryRepo) UpdatePaste(ctx context.Context, p *Paste) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.pastes[p.ID]
+	if !ok {
+		return nil
+	}
+	stored.Content = p.Content
+	stored.Language = p.Language
+	r.lastRevision++
+	revs := append(r.revisions[p.ID], Revision{
+		ID:        r.lastRevision,
+		PasteID:   p.ID,
+		Content:   p.Content,
+		Language:  p.Language,
+		CreatedAt: time.Now(),
+	})
+	if len(revs) > MaxRevisions {
+		revs = slices.Clone(revs[len(revs)-MaxRevisions:])
+	}
+	r.revisions[p.ID] = revs
+	return nil
+}
+
+func (r *memoryRepo) UpdateViews(ctx context.Context, p *Paste, count int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stored, ok := r.pastes[p.ID]; ok {
+		stored.Views += count
+	}
+	return nil
+}
+
+func (r *memoryRepo) GetPaste(ctx context.Context, id string) (*Paste, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stored, ok := r.pastes[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clonePaste(stored), nil
+}
+
+func (r *memoryRepo) DeleteExpired(ctx context.Context) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for id, p := range r.pastes {
+		if p.ExpireAt != nil && p.ExpireAt.Before(now) {
+			delete(r.pastes, id)
+			delete(r.stats, id)
+			delete(r.revisions, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *memoryRepo) RecordEvents(ctx context.Context, events []Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, events...)
+	return nil
+}
+
+func (r *memoryRepo) RollupEvents(ctx context.Context, before time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	kept := r.events[:0]
+	for _, e := range r.events {
+		if !e.At.Before(before) {
+			kept = append(kept, e)
+			continue
+		}
+		n++
+		if _, ok := r.pastes[e.PasteID]; !ok {
+			continue
+		}
+		st := r.stats[e.PasteID]
+		if st == nil {
+			st = &memoryStats{
+				hourly:    make(map[hourKind]int64),
+				viewers:   make(map[string]struct{}),
+				referrers: make(map[string]int64),
+			}
+			r.stats[e.PasteID] = st
+		}
+		st.hourly[hourKind{e.At.UTC().Truncate(time.Hour), e.Kind}]++
+		if e.Visitor != "" {
+			st.viewers[e.Visitor] = struct{}{}
+		}
+		if e.Referrer != "" {
+			st.referrers[e.Referrer]++
+		}
+	}
+	r.events = kept
+	return n, nil
+}
+
+func (r *memoryRepo) GetStats(ctx context.Context, id string, since time.Time) (*PasteStats, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stats := &PasteStats{Totals: make(map[string]int64)}
+	st := r.stats[id]
+	if st == nil {
+		return stats, nil
+	}
+	for k, c := range st.hourly {
+		stats.Totals[k.kind] += c
+		if !k.hour.Before(since) {
+			stats.Hourly = append(stats.Hourly, HourlyCount{Hour: k.hour, Kind: k.kind, Count: c})
+		}
+	}
+	sort.Slice(stats.Hourly, func(i, j int) bool {
+		a, b := stats.Hourly[i], stats.Hourly[j]
+		if !a.Hour.Equal(b.Hour) {
+			return a.Hour.Before(b.Hour)
+		}
+		return a.Kind < b.Kind
+	})
+	stats.UniqueViewers = int64(len(st.viewers))
+	for domain, c := range st.referrers {
+		stats.Referrers = append(stats.Referrers, ReferrerCount{Domain: domain, Count: c})
+	}
+	sort.Slice(stats.Referrers, func(i, j int) bool {
+		a, b := stats.Referrers[i], stats.Referrers[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Domain < b.Domain
+	})
+	if len(stats.Referrers) > maxReferrers {
+		stats.Referrers = stats.Referrers[:maxReferrers]
+	}
+	return stats, nil
+}
+
+func (r *memoryRepo) ListRevisions(ctx context.Context, id string, limit int) ([]Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	revs := r.revisions[id]
+	out := make([]Revision, 0, min(limit, len(revs)))
+	for i := len(revs) - 1; i >= 0 && len(out) < limit; i-- {
+		out = append(out, revs[i])
+	}
+	return out, nil
+}
@@ -2,62 +2,131 @@ package db
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrNotFound is returned by every Repository's GetPaste when no paste
+	// has the ID. It is pgx.ErrNoRows so callers that already check for that
+	// keep working.
+	ErrNotFound = pgx.ErrNoRows
+	// ErrDuplicateID is returned by CreatePaste when the ID is already taken.
+	ErrDuplicateID = errors.New("paste id already exists")
 )
+
+// uniqueViolation is the SQLSTATE Postgres reports for a duplicate key.
+const uniqueViolation = "23505"
+
 type Paste struct {
-    ID        string     `json:"id"`
-    Content   string     `json:"content"`
-    Language  string     `json:"language"`
-    CreatedAt time.Time  `json:"created_at"`
-    ExpireAt  *time.Time `json:"expire_at,omitempty"`
-    Views     int        `json:"views"`
+	ID        string     `json:"id"`
+	Content   string     `json:"content"`
+	Language  string     `json:"language"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpireAt  *time.Time `json:"expire_at,omitempty"`
+	Views     int        `json:"views"`
+	// OwnerToken is set only on the paste returned from creation; it is
+	// never stored, only its hash.
+	OwnerToken string `json:"owner_token,omitempty"`
+	// OwnerHash is the hex SHA-256 of the owner token, empty for pastes
+	// created before ownership existed.
+	OwnerHash string `json:"-"`
+	// EditToken, like OwnerToken, is set only on the paste returned from
+	// creation. It lets its holder edit the paste, but not see its stats.
+	EditToken string `json:"edit_token,omitempty"`
+	// EditHash is the hex SHA-256 of the edit token, empty for pastes
+	// created before edit tokens existed.
+	EditHash string `json:"-"`
 }
 
 type Repository interface {
-	CreatePaste(p *Paste) error
-	UpdatePaste(p *Paste) error
-	UpdateViews(p *Paste, count int) error
-	GetPaste(id string) (*Paste, error)
-	DeleteExpired()(error)
+	CreatePaste(ctx context.Context, p *Paste) error
+	// UpdatePaste saves new content and records it as a revision, keeping
+	// the latest MaxRevisions per paste.
+	UpdatePaste(ctx context.Context, p *Paste) error
+	UpdateViews(ctx context.Context, p *Paste, count int) error
+	GetPaste(ctx context.Context, id string) (*Paste, error)
+	// DeleteExpired removes pastes past their expiry and reports how many.
+	DeleteExpired(ctx context.Context) (int64, error)
+
+	// RecordEvents stores raw analytics events for the next rollup.
+	RecordEvents(ctx context.Context, events []Event) error
+	// RollupEvents folds events recorded before the cutoff into the
+	// per-paste rollups, discards them and reports how many were folded.
+	// Events for pastes that no longer exist are discarded.
+	RollupEvents(ctx context.Context, before time.Time) (int64, error)
+	// GetStats returns the rollups for id, with hourly counts from since.
+	GetStats(ctx context.Context, id string, since time.Time) (*PasteStats, error)
+	// ListRevisions returns up to limit revisions of id, newest first.
+	ListRevisions(ctx context.Context, id string, limit int) ([]Revision, error)
 }
 type repo struct {
+	pool         *pgxpool.Pool
+	queryTimeout time.Duration
 }
 
-func NewRepo() Repository {
-	return &repo{}
-}
-func (r *repo) CreatePaste(p *Paste) error {
-	_, err := DB.Exec(context.Background(), "INSERT INTO pastes(id,content,language,expire_at) VALUES($1,$2,$3,$4)", p.ID, p.Content, p.Language, p.ExpireAt)
-	return err
+// NewRepo returns a Repository backed by pool. Every query is bounded by
+// queryTimeout; a non-positive value disables the per-query deadline.
+func NewRepo(pool *pgxpool.Pool, queryTimeout time.Duration) Repository {
+	return &repo{
+		pool:         pool,
+		queryTimeout: queryTimeout,
+	}
 }
 
-func (r *repo) UpdatePaste(p *Paste) error {
-	_, err := DB.Exec(context.Background(), "UPDATE pastes SET content = $1,Language = $2 WHERE ID = $3", p.Content, p.Language, p.ID)
-	return err
+// withTimeout bounds a single query by the configured deadline so a slow
+// statement cannot hold a pool connection indefinitely.
+func (r *repo) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, r.queryTimeout)
 }
-func (r *repo) UpdateViews(p *Paste, count int) error {
-	_, err := DB.Exec(context.Background(), "UPDATE pastes SET views=views+$1 where id=$2 ", count, p.ID)
 
+func (r *repo) CreatePaste(ctx context.Context, p *Paste) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.pool.Exec(ctx, "INSERT INTO pastes(id,content,language,expire_at,owner_token_hash,edit_token_hash) VALUES($1,$2,$3,$4,NULLIF($5,''),NULLIF($6,''))", p.ID, p.Content, p.Language, p.ExpireAt, p.OwnerHash, p.EditHash)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return ErrDuplicateID
+	}
 	return err
 }
 
+func (r *repo) UpdateViews(ctx context.Context, p *Paste, count int) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.pool.Exec(ctx, "UPDATE pastes SET views=views+$1 where id=$2 ", count, p.ID)
 
-func (r *repo) GetPaste(ID string) (*Paste, error) {
-    row := DB.QueryRow(context.Background(), "SELECT id, content, language, created_at, expire_at, views FROM pastes WHERE id=$1", ID)
-    pp := &Paste{}
-    err := row.Scan(&pp.ID, &pp.Content, &pp.Language, &pp.CreatedAt, &pp.ExpireAt, &pp.Views)
-    if err != nil {
-        if err == sql.ErrNoRows {
-            return nil, nil 
-        }
-        return nil, err
-    }
-    return pp, nil
+	return err
 }
 
+func (r *repo) GetPaste(ctx context.Context, ID string) (*Paste, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	row := r.pool.QueryRow(ctx, "SELECT id, content, language, created_at, expire_at, views, COALESCE(owner_token_hash, ''), COALESCE(edit_token_hash, '') FROM pastes WHERE id=$1", ID)
+	pp := &Paste{}
+	err := row.Scan(&pp.ID, &pp.Content, &pp.Language, &pp.CreatedAt, &pp.ExpireAt, &pp.Views, &pp.OwnerHash, &pp.EditHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return pp, nil
+}
 
-func (r *repo) DeleteExpired() error {
-	_, err := DB.Exec(context.Background(), "DELETE FROM pastes WHERE expire_at IS NOT NULL AND expire_at < NOW()")
-	return err
-}
\ No newline at end of file
+func (r *repo) DeleteExpired(ctx context.Context) (int64, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tag, err := r.pool.Exec(ctx, "DELETE FROM pastes WHERE expire_at IS NOT NULL AND expire_at < NOW()")
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// MaxRevisions is how many of its latest revisions each paste keeps.
+const MaxRevisions = 100
+
+// Revision is one saved version of a paste's content. UpdatePaste records
+// one with every save.
+type Revision struct {
+	ID        int64     `json:"id"`
+	PasteID   string    `json:"paste_id"`
+	Content   string    `json:"content"`
+	Language  string    `json:"language"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// pruneRevisionsSQL deletes all but the latest MaxRevisions revisions of a
+// paste. SQLite reads the same numbered parameters as ?1 and ?2.
+const pruneRevisionsSQL = `
+DELETE FROM paste_revisions WHERE paste_id = $1 AND id < (
+	SELECT min(id) FROM (
+		SELECT id FROM paste_revisions WHERE paste_id = $1 ORDER BY id DESC LIMIT $2
+	) AS keep
+)`
+
+func (r *repo) UpdatePaste(ctx context.Context, p *Paste) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, "UPDATE pastes SET content = $1, language = $2 WHERE id = $3", p.Content, p.Language, p.ID)
+		if err != nil || tag.RowsAffected() == 0 {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "INSERT INTO paste_revisions(paste_id, content, language) VALUES($1, $2, $3)", p.ID, p.Content, p.Language); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, pruneRevisionsSQL, p.ID, MaxRevisions)
+		return err
+	})
+}
+
+func (r *repo) ListRevisions(ctx context.Context, id string, limit int) ([]Revision, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.pool.Query(ctx,
+		"SELECT id, paste_id, content, language, created_at FROM paste_revisions WHERE paste_id = $1 ORDER BY id DESC LIMIT $2", id, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[Revision])
+}
+
+func (r *sqliteRepo) UpdatePaste(ctx context.Context, p *Paste) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, "UPDATE pastes SET content = ?, language = ? WHERE id = ?", p.Content, p.Language, p.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO paste_revisions(paste_id, content, language, created_at) VALUES(?, ?, ?, ?)",
+		p.ID, p.Content, p.Language, time.Now().UnixMicro()); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, strings.NewReplacer("$1", "?1", "$2", "?2").Replace(pruneRevisionsSQL), p.ID, MaxRevisions); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqliteRepo) ListRevisions(ctx context.Context, id string, limit int) ([]Revision, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT id, paste_id, content, language, created_at FROM paste_revisions WHERE paste_id = ? ORDER BY id DESC LIMIT ?", id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var revs []Revision
+	for rows.Next() {
+		var rev Revision
+		var createdAt int64
+		if err := rows.Scan(&rev.ID, &rev.PasteID, &rev.Content, &rev.Language, &createdAt); err != nil {
+			return nil, err
+		}
+		rev.CreatedAt = time.UnixMicro(createdAt)
+		revs = append(revs, rev)
+	}
+	return revs, rows.Err()
+}
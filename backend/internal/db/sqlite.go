@@ -0,0 +1,248 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteRepo is a Repository backed by a single SQLite file. It uses the
+// pure-Go modernc driver so the binary stays CGO-free.
+type sqliteRepo struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// OpenSQLite opens (creating if needed) the database file at path. Apply
+// the schema with migrate.NewSQLite before using it. The caller must Close
+// the result.
+func OpenSQLite(ctx context.Context, path string) (*sql.DB, error) {
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+	sqlDB, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite database: %w", err)
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("ping sqlite database: %w", err)
+	}
+	return sqlDB, nil
+}
+
+// NewSQLiteRepo returns a Repository backed by sqlDB, normally obtained from
+// OpenSQLite. Every query is bounded by queryTimeout.
+func NewSQLiteRepo(sqlDB *sql.DB, queryTimeout time.Duration) Repository {
+	return &sqliteRepo{
+		db:           sqlDB,
+		queryTimeout: queryTimeout,
+	}
+}
+
+func (r *sqliteRepo) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, r.queryTimeout)
+}
+
+func toMicros(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixMicro(), Valid: true}
+}
+
+func (r *sqliteRepo) CreatePaste(ctx context.Context, p *Paste) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, "INSERT INTO pastes(id,content,language,created_at,expire_at,owner_token_hash,edit_token_hash) VALUES(?,?,?,?,?,NULLIF(?,''),NULLIF(?,''))",
+		p.ID, p.Content, p.Language, time.Now().UnixMicro(), toMicros(p.ExpireAt), p.OwnerHash, p.EditHash)
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY {
+		return ErrDuplicateID
+	}
+	return err
+}
+
+func (r *sqliteRepo) UpdateViews(ctx context.Context, p *Paste, count int) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, "UPDATE pastes SET views = views + ? WHERE id = ?", count, p.ID)
+	return err
+}
+
+func (r *sqliteRepo) GetPaste(ctx context.Context, id string) (*Paste, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	row := r.db.QueryRowContext(ctx, "SELECT id, content, language, created_at, expire_at, views, COALESCE(owner_token_hash, ''), COALESCE(edit_token_hash, '') FROM pastes WHERE id = ?", id)
+	pp := &Paste{}
+	var createdAt int64
+	var expireAt sql.NullInt64
+	if err := row.Scan(&pp.ID, &pp.Content, &pp.Language, &createdAt, &expireAt, &pp.Views, &pp.OwnerHash, &pp.EditHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	pp.CreatedAt = time.UnixMicro(createdAt)
+	if expireAt.Valid {
+		t := time.UnixMicro(expireAt.Int64)
+		pp.ExpireAt = &t
+	}
+	return pp, nil
+}
+
+func (r *sqliteRepo) DeleteExpired(ctx context.Context) (int64, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.db.ExecContext(ctx, "DELETE FROM pastes WHERE expire_at IS NOT NULL AND expire_at < ?", time.Now().UnixMicro())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *sqliteRepo) RecordEvents(ctx context.Context, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO paste_events(paste_id, kind, visitor, referrer, occurred_at) VALUES(?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, e := range events {
+		if _, err := stmt.ExecContext(ctx, e.PasteID, e.Kind, e.Visitor, e.Referrer, e.At.UnixMicro()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const microsPerHour = int64(time.Hour / time.Microsecond)
+
+func (r *sqliteRepo) RollupEvents(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	cutoff := before.UnixMicro()
+	// The "WHERE true" keeps SQLite from parsing ON CONFLICT as a join
+	// constraint of the SELECT.
+	steps := []struct {
+		query string
+		args  []any
+	}{
+		{`INSERT INTO paste_stats_hourly(paste_id, hour, kind, count)
+			SELECT e.paste_id, (e.occurred_at / ?) * ?, e.kind, count(*)
+			FROM paste_events e JOIN pastes p ON p.id = e.paste_id
+			WHERE e.occurred_at < ? GROUP BY 1, 2, 3
+			ON CONFLICT(paste_id, hour, kind) DO UPDATE SET count = count + excluded.count`,
+			[]any{microsPerHour, microsPerHour, cutoff}},
+		{`INSERT INTO paste_viewers(paste_id, visitor, first_seen)
+			SELECT e.paste_id, e.visitor, min(e.occurred_at)
+			FROM paste_events e JOIN pastes p ON p.id = e.paste_id
+			WHERE e.occurred_at < ? AND e.visitor <> '' GROUP BY 1, 2
+			ON CONFLICT(paste_id, visitor) DO NOTHING`,
+			[]any{cutoff}},
+		{`INSERT INTO paste_referrers(paste_id, domain, count)
+			SELECT e.paste_id, e.referrer, count(*)
+			FROM paste_events e JOIN pastes p ON p.id = e.paste_id
+			WHERE e.occurred_at < ? AND e.referrer <> '' GROUP BY 1, 2
+			ON CONFLICT(paste_id, domain) DO UPDATE SET count = count + excluded.count`,
+			[]any{cutoff}},
+	}
+	for _, s := range steps {
+		if _, err := tx.ExecContext(ctx, s.query, s.args...); err != nil {
+			return 0, err
+		}
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM paste_events WHERE occurred_at < ?", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+func (r *sqliteRepo) GetStats(ctx context.Context, id string, since time.Time) (*PasteStats, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	stats := &PasteStats{Totals: make(map[string]int64)}
+
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT hour, kind, count FROM paste_stats_hourly WHERE paste_id = ? AND hour >= ? ORDER BY hour, kind", id, since.UnixMicro())
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var h HourlyCount
+		var hour int64
+		if err := rows.Scan(&hour, &h.Kind, &h.Count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		h.Hour = time.UnixMicro(hour).UTC()
+		stats.Hourly = append(stats.Hourly, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = r.db.QueryContext(ctx, "SELECT kind, sum(count) FROM paste_stats_hourly WHERE paste_id = ? GROUP BY kind", id)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var kind string
+		var total int64
+		if err := rows.Scan(&kind, &total); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stats.Totals[kind] = total
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.db.QueryRowContext(ctx, "SELECT count(*) FROM paste_viewers WHERE paste_id = ?", id).Scan(&stats.UniqueViewers); err != nil {
+		return nil, err
+	}
+
+	rows, err = r.db.QueryContext(ctx,
+		"SELECT domain, count FROM paste_referrers WHERE paste_id = ? ORDER BY count DESC, domain LIMIT ?", id, maxReferrers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rc ReferrerCount
+		if err := rows.Scan(&rc.Domain, &rc.Count); err != nil {
+			return nil, err
+		}
+		stats.Referrers = append(stats.Referrers, rc)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Analytics event kinds.
+const (
+	// EventView is a view counted towards Paste.Views.
+	EventView = "view"
+	// EventRendered is a fetch of the paste for display, GET /api/pastes/:id.
+	EventRendered = "rendered"
+	// EventRaw is a fetch of the raw content.
+	EventRaw = "raw"
+	// EventDownload is a fetch of the raw content as an attachment.
+	EventDownload = "download"
+	// EventSession is a live-editing WebSocket session.
+	EventSession = "session"
+)
+
+// maxReferrers bounds the referrer domains returned by GetStats.
+const maxReferrers = 20
+
+// Event is one analytics observation for a paste.
+type Event struct {
+	PasteID string
+	Kind    string
+	// Visitor is an opaque fingerprint used to count unique viewers.
+	Visitor string
+	// Referrer is the referring domain, empty when there was none.
+	Referrer string
+	At       time.Time
+}
+
+// HourlyCount is the number of events of one kind in the hour starting at Hour.
+type HourlyCount struct {
+	Hour  time.Time
+	Kind  string
+	Count int64
+}
+
+type ReferrerCount struct {
+	Domain string `json:"domain"`
+	Count  int64  `json:"count"`
+}
+
+// PasteStats is the rolled-up analytics for one paste.
+type PasteStats struct {
+	// Hourly is ordered by hour, then kind.
+	Hourly []HourlyCount
+	// Totals counts every rolled-up event by kind, however old.
+	Totals        map[string]int64
+	UniqueViewers int64
+	// Referrers holds the most frequent domains, most frequent first.
+	Referrers []ReferrerCount
+}
+
+func (r *repo) RecordEvents(ctx context.Context, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.pool.CopyFrom(ctx,
+		pgx.Identifier{"paste_events"},
+		[]string{"paste_id", "kind", "visitor", "referrer", "occurred_at"},
+		pgx.CopyFromSlice(len(events), func(i int) ([]any, error) {
+			e := events[i]
+			return []any{e.PasteID, e.Kind, e.Visitor, e.Referrer, e.At}, nil
+		}))
+	return err
+}
+
+// rollupSQL moves events into the rollups in one statement, so a failure
+// leaves them in place for the next run and concurrent replicas cannot
+// fold the same rows twice.
+const rollupSQL = `
+WITH moved AS (
+	DELETE FROM paste_events WHERE occurred_at < $1
+	RETURNING paste_id, kind, visitor, referrer, occurred_at
+), live AS (
+	SELECT m.* FROM moved m JOIN pastes p ON p.id = m.paste_id
+), hourly AS (
+	INSERT INTO paste_stats_hourly(paste_id, hour, kind, count)
+	SELECT paste_id, date_trunc('hour', occurred_at, 'UTC'), kind, count(*) FROM live GROUP BY 1, 2, 3
+	ON CONFLICT (paste_id, hour, kind) DO UPDATE SET count = paste_stats_hourly.count + EXCLUDED.count
+), viewers AS (
+	INSERT INTO paste_viewers(paste_id, visitor, first_seen)
+	SELECT paste_id, visitor, min(occurred_at) FROM live WHERE visitor <> '' GROUP BY 1, 2
+	ON CONFLICT (paste_id, visitor) DO NOTHING
+), referrers AS (
+	INSERT INTO paste_referrers(paste_id, domain, count)
+	SELECT paste_id, referrer, count(*) FROM live WHERE referrer <> '' GROUP BY 1, 2
+	ON CONFLICT (paste_id, domain) DO UPDATE SET count = paste_referrers.count + EXCLUDED.count
+)
+SELECT count(*) FROM moved`
+
+func (r *repo) RollupEvents(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var n int64
+	err := r.pool.QueryRow(ctx, rollupSQL, before).Scan(&n)
+	return n, err
+}
+
+func (r *repo) GetStats(ctx context.Context, id string, since time.Time) (*PasteStats, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	stats := &PasteStats{Totals: make(map[string]int64)}
+
+	rows, err := r.pool.Query(ctx,
+		"SELECT hour, kind, count FROM paste_stats_hourly WHERE paste_id=$1 AND hour >= $2 ORDER BY hour, kind", id, since)
+	if err != nil {
+		return nil, err
+	}
+	stats.Hourly, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (HourlyCount, error) {
+		var h HourlyCount
+		err := row.Scan(&h.Hour, &h.Kind, &h.Count)
+		return h, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = r.pool.Query(ctx, "SELECT kind, sum(count)::bigint FROM paste_stats_hourly WHERE paste_id=$1 GROUP BY kind", id)
+	if err != nil {
+		return nil, err
+	}
+	var kind string
+	var total int64
+	_, err = pgx.ForEachRow(rows, []any{&kind, &total}, func() error {
+		stats.Totals[kind] = total
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.pool.QueryRow(ctx, "SELECT count(*) FROM paste_viewers WHERE paste_id=$1", id).Scan(&stats.UniqueViewers); err != nil {
+		return nil, err
+	}
+
+	rows, err = r.pool.Query(ctx,
+		"SELECT domain, count FROM paste_referrers WHERE paste_id=$1 ORDER BY count DESC, domain LIMIT $2", id, maxReferrers)
+	if err != nil {
+		return nil, err
+	}
+	stats.Referrers, err = pgx.CollectRows(rows, pgx.RowToStructByPos[ReferrerCount])
+	if err != nil {
+		return nil, err
+	}
+	for i := range stats.Hourly {
+		stats.Hourly[i].Hour = stats.Hourly[i].Hour.UTC()
+	}
+	return stats, nil
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/Sumedhvats/pasteCTL_web/internal/db")
+
+// tracedRepo wraps a Repository with one client span per call, so every
+// backend is instrumented the same way.
+type tracedRepo struct {
+	next   Repository
+	system attribute.KeyValue
+}
+
+// WithTracing returns next instrumented with OpenTelemetry spans. system is
+// reported as db.system, e.g. "postgresql" or "sqlite".
+func WithTracing(next Repository, system string) Repository {
+	return &tracedRepo{
+		next:   next,
+		system: attribute.String("db.system", system),
+	}
+}
+
+func (r *tracedRepo) start(ctx context.Context, op string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "db."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(append(attrs, r.system, attribute.String("db.operation", op))...))
+}
+
+func (r *tracedRepo) CreatePaste(ctx context.Context, p *Paste) (err error) {
+	ctx, span := r.start(ctx, "CreatePaste", tracing.AttrPasteID.String(p.ID), tracing.AttrPasteLanguage.String(p.Language))
+	defer func() { tracing.End(span, err) }()
+	return r.next.CreatePaste(ctx, p)
+}
+
+func (r *tracedRepo) UpdatePaste(ctx context.Context, p *Paste) (err error) {
+	ctx, span := r.start(ctx, "UpdatePaste", tracing.AttrPasteID.String(p.ID), tracing.AttrPasteLanguage.String(p.Language))
+	defer func() { tracing.End(span, err) }()
+	return r.next.UpdatePaste(ctx, p)
+}
+
+func (r *tracedRepo) UpdateViews(ctx context.Context, p *Paste, count int) (err error) {
+	ctx, span := r.start(ctx, "UpdateViews", tracing.AttrPasteID.String(p.ID), attribute.Int("paste.view_increment", count))
+	defer func() { tracing.End(span, err) }()
+	return r.next.UpdateViews(ctx, p, count)
+}
+
+func (r *tracedRepo) GetPaste(ctx context.Context, id string) (_ *Paste, err error) {
+	ctx, span := r.start(ctx, "GetPaste", tracing.AttrPasteID.String(id))
+	defer func() {
+		// A miss is an expected outcome, not a failed query.
+		if errors.Is(err, ErrNotFound) {
+			span.SetAttributes(attribute.Bool("paste.found", false))
+			span.End()
+			return
+		}
+		tracing.End(span, err)
+	}()
+	p, err := r.next.GetPaste(ctx, id)
+	if err == nil && p != nil {
+		span.SetAttributes(tracing.AttrPasteLanguage.String(p.Language))
+	}
+	return p, err
+}
+
+func (r *tracedRepo) DeleteExpired(ctx context.Context) (n int64, err error) {
+	ctx, span := r.start(ctx, "DeleteExpired")
+	defer func() {
+		span.SetAttributes(attribute.Int64("db.rows_affected", n))
+		tracing.End(span, err)
+	}()
+	return r.next.DeleteExpired(ctx)
+}
+
+func (r *tracedRepo) RecordEvents(ctx context.Context, events []Event) (err error) {
+	ctx, span := r.start(ctx, "RecordEvents", attribute.Int("db.batch_size", len(events)))
+	defer func() { tracing.End(span, err) }()
+	return r.next.RecordEvents(ctx, events)
+}
+
+func (r *tracedRepo) RollupEvents(ctx context.Context, before time.Time) (n int64, err error) {
+	ctx, span := r.start(ctx, "RollupEvents")
+	defer func() {
+		span.SetAttributes(attribute.Int64("db.rows_affected", n))
+		tracing.End(span, err)
+	}()
+	return r.next.RollupEvents(ctx, before)
+}
+
+func (r *tracedRepo) GetStats(ctx context.Context, id string, since time.Time) (_ *PasteStats, err error) {
+	ctx, span := r.start(ctx, "GetStats", tracing.AttrPasteID.String(id))
+	defer func() { tracing.End(span, err) }()
+	return r.next.GetStats(ctx, id, since)
+}
+
+func (r *tracedRepo) ListRevisions(ctx context.Context, id string, limit int) (_ []Revision, err error) {
+	ctx, span := r.start(ctx, "ListRevisions", tracing.AttrPasteID.String(id))
+	defer func() { tracing.End(span, err) }()
+	return r.next.ListRevisions(ctx, id, limit)
+}
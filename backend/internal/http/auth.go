@@ -0,0 +1,36 @@
+package http
+
+import (
+	"crypto/sha256"
+
+	"github.com/gin-gonic/gin"
+)
+
+const userKey = "user"
+
+// Authenticate identifies callers that present one of tokens, which maps
+// user names to API tokens, as "Authorization: Bearer <token>". Other
+// requests carry on anonymously: the same header also carries paste owner
+// tokens, so an unknown token is not an error here.
+func Authenticate(tokens map[string]string) gin.HandlerFunc {
+	// Keyed by hash so a lookup takes the same time however much of a
+	// guessed token is right.
+	users := make(map[[sha256.Size]byte]string, len(tokens))
+	for user, token := range tokens {
+		users[sha256.Sum256([]byte(token))] = user
+	}
+	return func(c *gin.Context) {
+		if token, ok := bearerToken(c); ok {
+			if user, ok := users[sha256.Sum256([]byte(token))]; ok {
+				c.Set(userKey, user)
+			}
+		}
+		c.Next()
+	}
+}
+
+// GetUser returns the user authenticated by Authenticate, or "" for an
+// anonymous request.
+func GetUser(c *gin.Context) string {
+	return c.GetString(userKey)
+}
@@ -0,0 +1,178 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/logging"
+	"github.com/Sumedhvats/pasteCTL_web/internal/metrics"
+	"github.com/Sumedhvats/pasteCTL_web/internal/ws"
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultEventsKeepAlive is used when Handler.EventsKeepAlive is not set.
+const DefaultEventsKeepAlive = 15 * time.Second
+
+// Event types on the events stream.
+const (
+	eventContent = "content"
+	eventExpired = "expired"
+	eventDeleted = "deleted"
+)
+
+type contentEvent struct {
+	Content  string `json:"content"`
+	Language string `json:"language"`
+}
+
+type endEvent struct {
+	ID string `json:"id"`
+}
+
+func (h *Handler) eventsKeepAlive() time.Duration {
+	if h.EventsKeepAlive <= 0 {
+		return DefaultEventsKeepAlive
+	}
+	return h.EventsKeepAlive
+}
+
+// EventsHandler streams a paste's changes as server-sent events, for
+// followers that do not speak the live-editing protocol, e.g. curl -N:
+//
+//	event: content  the text changed; data is {"content", "language"}
+//	event: expired  the paste expired; the stream ends
+//	event: deleted  the paste was deleted; the stream ends
+//
+// The stream opens with the current text. Content events carry the whole
+// text, with an ID derived from it, so a client reconnecting with
+// Last-Event-ID is sent the text only if it changed since, whichever
+// replica it reaches. The stream also ends when the server restarts;
+// clients reconnect as after any disconnection.
+func (h *Handler) EventsHandler(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		errorJSON(c, http.StatusBadRequest, "Paste ID is required")
+		return
+	}
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx).With("paste_id", id)
+	p, err := h.Service.GetPaste(ctx, id)
+	if err != nil {
+		writeError(c, err, "Failed to follow paste")
+		return
+	}
+	// With live editing, the room's document is followed: it holds edits
+	// that are not saved yet, as well as updates made with PUT.
+	content, language := p.Content, p.Language
+	var changed, done <-chan struct{}
+	var follower *ws.Follower
+	if h.Live != nil {
+		follower, err = h.Live.Follow(ctx, id)
+		if err != nil {
+			writeError(c, err, "Failed to follow paste")
+			return
+		}
+		defer follower.Close(context.WithoutCancel(ctx))
+		content, language = follower.Text()
+		changed, done = follower.Changed(), follower.Done()
+	}
+	var expired <-chan time.Time
+	if p.ExpireAt != nil {
+		timer := time.NewTimer(time.Until(*p.ExpireAt))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	keepAlive := time.NewTicker(h.eventsKeepAlive())
+	defer keepAlive.Stop()
+
+	metrics.EventStreams.Inc()
+	defer metrics.EventStreams.Dec()
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-store")
+	// Proxies such as nginx would otherwise buffer the stream.
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	last := c.GetHeader("Last-Event-ID")
+	// send writes the text as a content event unless the client has it.
+	send := func(content, language string) error {
+		eventID := contentID(content, language)
+		if eventID == last {
+			return nil
+		}
+		last = eventID
+		return writeEvent(w, eventID, eventContent, contentEvent{Content: content, Language: language})
+	}
+	if err := send(content, language); err != nil {
+		return
+	}
+	w.Flush()
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case <-done:
+			return
+		case <-changed:
+			err = send(follower.Text())
+		case <-expired:
+			writeEvent(w, "", eventExpired, endEvent{ID: id})
+			w.Flush()
+			return
+		case <-keepAlive.C:
+			// Deletion does not pass through the live rooms, so the paste
+			// is looked up again; without live editing, so are its edits.
+			p, lookupErr := h.Service.GetPaste(ctx, id)
+			switch {
+			case errors.Is(lookupErr, ErrPasteNotFound):
+				writeEvent(w, "", eventDeleted, endEvent{ID: id})
+				w.Flush()
+				return
+			case errors.Is(lookupErr, ErrPasteExpired):
+				writeEvent(w, "", eventExpired, endEvent{ID: id})
+				w.Flush()
+				return
+			case lookupErr != nil:
+				logger.Warn("checking followed paste failed", "error", lookupErr)
+			case follower == nil:
+				if err := send(p.Content, p.Language); err != nil {
+					return
+				}
+			}
+			_, err = io.WriteString(w, ": keep-alive\n\n")
+		}
+		if err != nil {
+			return
+		}
+		w.Flush()
+	}
+}
+
+// contentID names a text and language on the events stream.
+func contentID(content, language string) string {
+	sum := sha256.Sum256([]byte(language + "\x00" + content))
+	return hex.EncodeToString(sum[:16])
+}
+
+// writeEvent writes one server-sent event. Data is encoded as JSON, which
+// keeps it on a single line.
+func writeEvent(w io.Writer, id, event string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
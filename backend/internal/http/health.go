@@ -0,0 +1,117 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Check is one readiness dependency. It returns details to report and a
+// non-nil error when the dependency is not ready.
+type Check func(ctx context.Context) (any, error)
+
+// HealthHandler serves the liveness, readiness and version probes.
+type HealthHandler struct {
+	ready atomic.Bool
+
+	mu     sync.RWMutex
+	names  []string
+	checks map[string]Check
+}
+
+// NewHealthHandler returns a handler that reports ready until SetReady(false).
+func NewHealthHandler() *HealthHandler {
+	h := &HealthHandler{checks: make(map[string]Check)}
+	h.ready.Store(true)
+	return h
+}
+
+// AddCheck registers a readiness dependency under name.
+func (h *HealthHandler) AddCheck(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.checks[name]; !ok {
+		h.names = append(h.names, name)
+	}
+	h.checks[name] = check
+}
+
+// SetReady flips readiness; shutdown sets it to false so load balancers stop
+// routing here before the listener closes.
+func (h *HealthHandler) SetReady(ready bool) {
+	h.ready.Store(ready)
+}
+
+// LivenessHandler reports that the process is up and serving requests.
+func (h *HealthHandler) LivenessHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// ReadinessHandler runs every registered check and answers 503 if any fails
+// or the server is shutting down.
+func (h *HealthHandler) ReadinessHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+	defer cancel()
+
+	h.mu.RLock()
+	names := append([]string(nil), h.names...)
+	checks := make(map[string]Check, len(h.checks))
+	for k, v := range h.checks {
+		checks[k] = v
+	}
+	h.mu.RUnlock()
+
+	ready := h.ready.Load()
+	results := make(gin.H, len(names))
+	for _, name := range names {
+		details, err := checks[name](ctx)
+		result := gin.H{"status": "ok"}
+		if details != nil {
+			result["details"] = details
+		}
+		if err != nil {
+			ready = false
+			result["status"] = "failing"
+			result["error"] = err.Error()
+		}
+		results[name] = result
+	}
+
+	status, code := "ready", http.StatusOK
+	if !h.ready.Load() {
+		status, code = "shutting down", http.StatusServiceUnavailable
+	} else if !ready {
+		status, code = "not ready", http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{"status": status, "checks": results})
+}
+
+// VersionHandler reports build information embedded by the Go toolchain.
+func (h *HealthHandler) VersionHandler(c *gin.Context) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"version": "unknown"})
+		return
+	}
+	resp := gin.H{
+		"module":     info.Main.Path,
+		"version":    info.Main.Version,
+		"go_version": info.GoVersion,
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			resp["revision"] = s.Value
+		case "vcs.time":
+			resp["commit_time"] = s.Value
+		case "vcs.modified":
+			resp["dirty"] = s.Value == "true"
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
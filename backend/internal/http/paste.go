@@ -1,24 +1,99 @@
 package http
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
-	"log"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/analytics"
+	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	"github.com/Sumedhvats/pasteCTL_web/internal/logging"
+	"github.com/Sumedhvats/pasteCTL_web/internal/metrics"
 	pasteService "github.com/Sumedhvats/pasteCTL_web/internal/paste"
+	"github.com/Sumedhvats/pasteCTL_web/internal/views"
+	"github.com/Sumedhvats/pasteCTL_web/internal/ws"
 	"github.com/gin-gonic/gin"
 )
+
 var (
-    ErrPasteNotFound = errors.New("paste not found")
-    ErrPasteExpired  = errors.New("paste has expired")
+	ErrPasteNotFound = pasteService.ErrPasteNotFound
+	ErrPasteExpired  = pasteService.ErrPasteExpired
+	ErrNotOwner      = pasteService.ErrNotOwner
+	ErrNotEditor     = pasteService.ErrNotEditor
+	ErrInvalidSlug   = pasteService.ErrInvalidSlug
+	ErrSlugTaken     = pasteService.ErrSlugTaken
 )
+
+// DefaultExpiries are the "expire" values accepted when none are configured.
+var DefaultExpiries = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+}
+
 type Handler struct {
 	Service pasteService.PasteService
+	// Expiries maps the accepted "expire" request values to paste lifetimes.
+	Expiries map[string]time.Duration
+	// Views batches and deduplicates view counts. When nil, each view is
+	// written straight through the service.
+	Views *views.Counter
+	// Analytics records events for the stats endpoint; nil disables it.
+	Analytics *analytics.Recorder
+	// Live reports who is in each paste's live-editing room, takes in
+	// updates so rooms do not overwrite them, and feeds the events stream.
+	// When nil, rooms are always reported empty and the events stream
+	// polls the paste.
+	Live *ws.Hub
+	// EventsKeepAlive is how often an idle events stream sends a comment,
+	// so proxies keep it open, and checks that the paste still exists.
+	EventsKeepAlive time.Duration
 }
 
 func NewHandler(svc pasteService.PasteService) *Handler {
 	return &Handler{
-		Service: svc,
+		Service:  svc,
+		Expiries: DefaultExpiries,
+	}
+}
+
+// errorJSON writes an error body tagged with the request ID so a user's
+// report can be matched to the server logs.
+func errorJSON(c *gin.Context, status int, msg string) {
+	c.JSON(status, gin.H{"error": msg, "request_id": GetRequestID(c)})
+}
+
+// writeError maps service and context errors onto HTTP status codes. Errors
+// it does not recognise are logged and reported as a 500 with msg.
+func writeError(c *gin.Context, err error, msg string) {
+	logger := logging.FromContext(c.Request.Context())
+	switch {
+	case errors.Is(err, ErrPasteNotFound):
+		errorJSON(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrPasteExpired):
+		errorJSON(c, http.StatusGone, err.Error())
+	case errors.Is(err, ErrNotOwner), errors.Is(err, ErrNotEditor):
+		errorJSON(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, ErrInvalidSlug):
+		errorJSON(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrSlugTaken):
+		errorJSON(c, http.StatusConflict, err.Error())
+	case errors.Is(err, ws.ErrShuttingDown), errors.Is(err, ws.ErrRoomFull):
+		errorJSON(c, http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		logger.Warn(msg, "error", err)
+		errorJSON(c, http.StatusGatewayTimeout, "request timed out")
+	case errors.Is(err, context.Canceled):
+		errorJSON(c, http.StatusServiceUnavailable, "request cancelled")
+	default:
+		logger.Error(msg, "error", err)
+		errorJSON(c, http.StatusInternalServerError, msg)
 	}
 }
 
@@ -27,121 +102,308 @@ func (h *Handler) CreatePasteHandler(c *gin.Context) {
 		Content  string `json:"content" binding:"required"`
 		Language string `json:"language" binding:"required"`
 		Expire   string `json:"expire"` // "1h", "24h", "7d", "never"
+		// Slug asks for a custom ID; only authenticated users may.
+		Slug string `json:"slug"`
 	}
 
 	var req CreatePasteRequest
 	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body or missing fields"})
+		errorJSON(c, http.StatusBadRequest, "Invalid request body or missing fields")
 		return
 	}
-expireMinutes := 0
-if req.Expire != "" && req.Expire != "never" {
-    duration, err := parseExpiry(req.Expire) // time.Duration
-    if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expire format"})
-        return
-    }
-    expireMinutes = int(duration.Minutes())
-}
+	expireMinutes := 0
+	if req.Expire != "" && req.Expire != "never" {
+		duration, err := h.parseExpiry(req.Expire) // time.Duration
+		if err != nil {
+			errorJSON(c, http.StatusBadRequest, "Invalid expire format")
+			return
+		}
+		expireMinutes = int(duration.Minutes())
+	}
 
-p, err := h.Service.CreatePaste(req.Content, req.Language, expireMinutes)
+	var p *db.Paste
+	var err error
+	if req.Slug != "" {
+		if GetUser(c) == "" {
+			c.Header("WWW-Authenticate", `Bearer realm="pastectl"`)
+			errorJSON(c, http.StatusUnauthorized, "custom slugs need an API token")
+			return
+		}
+		p, err = h.Service.CreatePasteWithSlug(c.Request.Context(), req.Slug, req.Content, req.Language, expireMinutes)
+	} else {
+		p, err = h.Service.CreatePaste(c.Request.Context(), req.Content, req.Language, expireMinutes)
+	}
 	if err != nil {
-		log.Printf("Failed to create paste: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create paste"})
+		writeError(c, err, "Failed to create paste")
 		return
 	}
+	expiryLabel := req.Expire
+	if expiryLabel == "" {
+		expiryLabel = "never"
+	}
+	metrics.PastesCreated.WithLabelValues(metrics.LanguageLabel(req.Language), expiryLabel).Inc()
+	metrics.PayloadBytes.WithLabelValues("create").Observe(float64(len(req.Content)))
 
 	c.JSON(http.StatusOK, p)
 }
 
-// parseExpiry converts "1h", "24h", "7d" into time.Duration
-func parseExpiry(expire string) (time.Duration, error) {
-	switch expire {
-	case "1h":
-		return time.Hour, nil
-	case "24h":
-		return 24 * time.Hour, nil
-	case "7d":
-		return 7 * 24 * time.Hour, nil
-	default:
+// parseExpiry converts one of the configured expiries, e.g. "1h" or "7d",
+// into time.Duration
+func (h *Handler) parseExpiry(expire string) (time.Duration, error) {
+	d, ok := h.Expiries[expire]
+	if !ok {
 		return 0, errors.New("invalid expiry")
 	}
+	return d, nil
 }
 
-
+// UpdatePasteHandler replaces the text of a paste. Only editors may: API
+// users, and holders of the paste's owner or edit token, who present it
+// as the API users do theirs:
+//
+//	Authorization: Bearer <owner_token or edit_token>
+//
+// Pastes created before edit tokens existed have neither token and stay
+// editable by anyone.
 func (h *Handler) UpdatePasteHandler(c *gin.Context) {
-    id := c.Param("id")
-    if id == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Paste ID is required"})
-        return
-    }
-    type UpdatePasteRequest struct {
-        Content  string `json:"content" binding:"required"`
-        Language string `json:"language"`
-    }
-
-    var req UpdatePasteRequest
-    if err := c.BindJSON(&req); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or incomplete request"})
-        return
-    }
-
-    p, err := h.Service.UpdatePaste(id, req.Content, req.Language)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update paste"})
-        return
-    }
-
-    c.JSON(http.StatusOK, p)
+	id := c.Param("id")
+	if id == "" {
+		errorJSON(c, http.StatusBadRequest, "Paste ID is required")
+		return
+	}
+	if GetUser(c) == "" {
+		token, ok := bearerToken(c)
+		if err := h.Service.CheckEditor(c.Request.Context(), id, token); err != nil {
+			if !ok && errors.Is(err, ErrNotEditor) {
+				c.Header("WWW-Authenticate", `Bearer realm="pastectl"`)
+				errorJSON(c, http.StatusUnauthorized, "edit token required")
+				return
+			}
+			writeError(c, err, "Failed to update paste")
+			return
+		}
+	}
+	type UpdatePasteRequest struct {
+		Content  string `json:"content" binding:"required"`
+		Language string `json:"language"`
+	}
+
+	var req UpdatePasteRequest
+	if err := c.BindJSON(&req); err != nil {
+		errorJSON(c, http.StatusBadRequest, "Invalid or incomplete request")
+		return
+	}
+
+	p, err := h.Service.UpdatePaste(c.Request.Context(), id, req.Content, req.Language)
+	if err != nil {
+		writeError(c, err, "Failed to update paste")
+		return
+	}
+	if h.Live != nil {
+		h.Live.Replace(id, p.Content, p.Language)
+	}
+	metrics.PayloadBytes.WithLabelValues("update").Observe(float64(len(req.Content)))
+
+	c.JSON(http.StatusOK, p)
 }
 
 func (h *Handler) UpdateViewsHandler(c *gin.Context) {
 	id := c.Param("id")
 	if id == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Paste ID is required"})
+		errorJSON(c, http.StatusBadRequest, "Paste ID is required")
+		return
+	}
+	if h.Views == nil {
+		p, err := h.Service.UpdateViews(c.Request.Context(), id, 1)
+		if err != nil {
+			writeError(c, err, "Failed to update views")
+			return
+		}
+		c.JSON(http.StatusOK, p)
 		return
 	}
-	p, err := h.Service.UpdateViews(id, 1)
+
+	// Only count views of pastes that exist, so unknown IDs never
+	// accumulate in the pending batch.
+	p, err := h.Service.GetPaste(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update views"})
+		writeError(c, err, "Failed to update views")
 		return
 	}
-	c.JSON(http.StatusOK, p)
+	visitor := visitorID(c)
+	counted := h.Views.Record(id, visitor)
+	if counted {
+		h.track(c, id, db.EventView, visitor)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      id,
+		"views":   p.Views + h.Views.Pending(id),
+		"counted": counted,
+	})
+}
+
+// visitorID fingerprints the client for view deduplication. It is a hash,
+// so client addresses are never held in memory verbatim.
+func visitorID(c *gin.Context) string {
+	sum := sha256.Sum256([]byte(c.ClientIP() + "\x00" + c.Request.UserAgent()))
+	return hex.EncodeToString(sum[:16])
+}
+
+// countView reports whether a GET asked for the view to be counted, as in
+// GET /api/pastes/:id?view=1.
+func countView(c *gin.Context) bool {
+	v, _ := strconv.ParseBool(c.Query("view"))
+	return v
 }
 
 func (h *Handler) GetPasteHandler(c *gin.Context) {
-    id := c.Param("id")
-    if id == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Paste ID is required"})
-        return
-    }
-
-    p, err := h.Service.GetPaste(id)
-    if err != nil {
-        switch err {
-        case ErrPasteNotFound:
-            c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-        case ErrPasteExpired:
-            c.JSON(http.StatusGone, gin.H{"error": err.Error()})
-        default:
-            log.Printf("Internal error fetching paste: %v", err)
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
-        }
-        return
-    }
-
-    c.JSON(http.StatusOK, p)
+	id := c.Param("id")
+	if id == "" {
+		errorJSON(c, http.StatusBadRequest, "Paste ID is required")
+		return
+	}
+
+	p, err := h.Service.GetPaste(c.Request.Context(), id)
+	if err != nil {
+		writeError(c, err, "internal server error")
+		return
+	}
+	visitor := visitorID(c)
+	if countView(c) {
+		counted := true
+		if h.Views != nil {
+			counted = h.Views.Record(id, visitor)
+		} else if _, err := h.Service.UpdateViews(c.Request.Context(), id, 1); err != nil {
+			writeError(c, err, "Failed to update views")
+			return
+		}
+		if counted {
+			h.track(c, id, db.EventView, visitor)
+		}
+	}
+	h.track(c, id, db.EventRendered, visitor)
+	if h.Views != nil {
+		resp := *p
+		resp.Views += h.Views.Pending(id)
+		p = &resp
+	}
+
+	c.JSON(http.StatusOK, p)
 }
 func (h *Handler) GetContentHandler(c *gin.Context) {
 	id := c.Param("id")
 	if id == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Paste ID is required"})
+		errorJSON(c, http.StatusBadRequest, "Paste ID is required")
 		return
 	}
-	p, err := h.Service.GetPaste(id)
+	p, err := h.Service.GetPaste(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update views"})
+		writeError(c, err, "Failed to fetch paste")
 		return
 	}
+	if download, _ := strconv.ParseBool(c.Query("download")); download {
+		h.track(c, id, db.EventDownload, visitorID(c))
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+".txt"))
+		c.String(http.StatusOK, p.Content)
+		return
+	}
+	h.track(c, id, db.EventRaw, visitorID(c))
 	c.JSON(http.StatusOK, p.Content)
 }
+
+// StatsHandler serves the analytics of a paste to its owner, who proves
+// ownership with the token returned at creation:
+//
+//	Authorization: Bearer <owner_token>
+func (h *Handler) StatsHandler(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		errorJSON(c, http.StatusBadRequest, "Paste ID is required")
+		return
+	}
+	token, ok := bearerToken(c)
+	if !ok {
+		c.Header("WWW-Authenticate", `Bearer realm="pastectl"`)
+		errorJSON(c, http.StatusUnauthorized, "owner token required")
+		return
+	}
+	stats, err := h.Service.GetStats(c.Request.Context(), id, token)
+	if err != nil {
+		writeError(c, err, "Failed to load stats")
+		return
+	}
+	if h.Views != nil {
+		stats.Views += h.Views.Pending(id)
+	}
+	c.Header("Cache-Control", "private, no-store")
+	c.JSON(http.StatusOK, stats)
+}
+
+// RevisionsHandler lists the saved versions of a paste, newest first.
+func (h *Handler) RevisionsHandler(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		errorJSON(c, http.StatusBadRequest, "Paste ID is required")
+		return
+	}
+	revs, err := h.Service.ListRevisions(c.Request.Context(), id)
+	if err != nil {
+		writeError(c, err, "Failed to load revisions")
+		return
+	}
+	c.JSON(http.StatusOK, revs)
+}
+
+// ParticipantsHandler lists who is editing a paste live at the moment.
+func (h *Handler) ParticipantsHandler(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		errorJSON(c, http.StatusBadRequest, "Paste ID is required")
+		return
+	}
+	if _, err := h.Service.GetPaste(c.Request.Context(), id); err != nil {
+		writeError(c, err, "Failed to load participants")
+		return
+	}
+	participants := []ws.Participant{}
+	if h.Live != nil {
+		participants = h.Live.Participants(id)
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, participants)
+}
+
+func bearerToken(c *gin.Context) (string, bool) {
+	const prefix = "Bearer "
+	auth := c.GetHeader("Authorization")
+	if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(auth[len(prefix):]), true
+}
+
+// TrackSession records a live-editing session of paste id; it is meant as
+// the ws.Hub OnConnect hook.
+func (h *Handler) TrackSession(c *gin.Context, id string) {
+	h.track(c, id, db.EventSession, visitorID(c))
+}
+
+// track records an analytics event when analytics are enabled. Views,
+// raw fetches and downloads carry the referrer: the "ref" query parameter,
+// which the frontend fills from document.referrer, or else the Referer
+// header. Rendered fetches and sessions do not, so one visit is not
+// counted against its referrer twice.
+func (h *Handler) track(c *gin.Context, id, kind, visitor string) {
+	if h.Analytics == nil {
+		return
+	}
+	var ref string
+	switch kind {
+	case db.EventView, db.EventRaw, db.EventDownload:
+		ref = c.Query("ref")
+		if ref == "" {
+			ref = c.Request.Referer()
+		}
+	}
+	h.Analytics.Record(id, kind, visitor, analytics.ReferrerDomain(ref))
+}
@@ -0,0 +1,242 @@
+// Package metrics defines the Prometheus collectors exported on /metrics.
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every pasteCTL collector plus the Go runtime and process
+// collectors. It is separate from the global default registry so tests and
+// embedders get only what this package registers.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+var (
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "pastectl_http_requests_total",
+		Help: "HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	HTTPDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pastectl_http_request_duration_seconds",
+		Help:    "HTTP request latency by route template, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	PastesCreated = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "pastectl_pastes_created_total",
+		Help: "Pastes created by language and requested expiry.",
+	}, []string{"language", "expiry"})
+
+	PayloadBytes = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pastectl_paste_payload_bytes",
+		Help:    "Size of paste content received, by operation.",
+		Buckets: prometheus.ExponentialBuckets(64, 4, 9), // 64B .. 4MiB
+	}, []string{"operation"})
+
+	WSRooms = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "pastectl_ws_rooms",
+		Help: "Live-editing rooms with at least one connection.",
+	})
+
+	WSConnections = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "pastectl_ws_connections",
+		Help: "Open WebSocket connections.",
+	})
+
+	WSBroadcastFanout = factory.NewHistogram(prometheus.HistogramOpts{
+		Name:    "pastectl_ws_broadcast_recipients",
+		Help:    "Number of connections each room broadcast was delivered to.",
+		Buckets: []float64{1, 2, 3, 5, 8, 13, 21, 34, 55},
+	})
+
+	WSOps = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "pastectl_ws_ops_total",
+		Help: "Collaborative editing operations received, by whether they were applied or rejected.",
+	}, []string{"result"})
+
+	WSSaves = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "pastectl_ws_saves_total",
+		Help: "Live-editing documents written back to their paste, by result.",
+	}, []string{"result"})
+
+	WSBusMessages = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "pastectl_ws_bus_messages_total",
+		Help: "Live-editing messages exchanged between replicas, by result: published, publish_failed, dropped, delivered, duplicate or gap.",
+	}, []string{"result"})
+
+	WSBusOutboxDepth = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "pastectl_ws_bus_outbox_messages",
+		Help: "Live-editing messages waiting to be published to other replicas.",
+	})
+
+	WSSendQueued = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "pastectl_ws_send_queued_messages",
+		Help: "Messages waiting in WebSocket connections' send queues.",
+	})
+
+	WSSendQueueDepth = factory.NewHistogram(prometheus.HistogramOpts{
+		Name:    "pastectl_ws_send_queue_depth",
+		Help:    "Depth of a connection's send queue after each message is queued.",
+		Buckets: []float64{1, 2, 4, 8, 16, 32, 64, 128, 256, 512},
+	})
+
+	WSSlowConsumers = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "pastectl_ws_slow_consumers_total",
+		Help: "Actions taken against connections with a busy send queue, by action: dropped (a cursor update) or disconnected.",
+	}, []string{"action"})
+
+	WSRefused = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "pastectl_ws_refused_total",
+		Help: "WebSocket connections refused or closed by a limit, by reason: room_full or rate_limited.",
+	}, []string{"reason"})
+
+	EventStreams = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "pastectl_event_streams",
+		Help: "Open server-sent event streams following a paste.",
+	})
+
+	ViewsRecorded = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "pastectl_views_recorded_total",
+		Help: "Paste views received, by whether they were counted, deduplicated or dropped.",
+	}, []string{"result"})
+
+	ViewsPending = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "pastectl_views_pending",
+		Help: "Counted views not yet written to storage.",
+	})
+
+	ViewsFlushed = factory.NewCounter(prometheus.CounterOpts{
+		Name: "pastectl_views_flushed_total",
+		Help: "Counted views written to storage.",
+	})
+
+	CacheRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "pastectl_cache_requests_total",
+		Help: "Paste cache lookups by result (hit or miss).",
+	}, []string{"result"})
+
+	CacheEvictions = factory.NewCounter(prometheus.CounterOpts{
+		Name: "pastectl_cache_evictions_total",
+		Help: "Pastes evicted from the cache to stay within its limits.",
+	})
+
+	CacheEntries = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "pastectl_cache_entries",
+		Help: "Pastes currently cached.",
+	})
+
+	CacheBytes = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "pastectl_cache_bytes",
+		Help: "Approximate memory held by cached pastes.",
+	})
+
+	AnalyticsEvents = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "pastectl_analytics_events_total",
+		Help: "Analytics events buffered for storage, by kind.",
+	}, []string{"kind"})
+
+	AnalyticsDropped = factory.NewCounter(prometheus.CounterOpts{
+		Name: "pastectl_analytics_events_dropped_total",
+		Help: "Analytics events dropped because the buffer was full.",
+	})
+
+	AnalyticsRolledUp = factory.NewCounter(prometheus.CounterOpts{
+		Name: "pastectl_analytics_rolled_up_total",
+		Help: "Analytics events folded into the stats rollups.",
+	})
+
+	AnalyticsRollupFailures = factory.NewCounter(prometheus.CounterOpts{
+		Name: "pastectl_analytics_rollup_failures_total",
+		Help: "Scheduled analytics rollup runs that returned an error.",
+	})
+
+	CleanupDuration = factory.NewHistogram(prometheus.HistogramOpts{
+		Name:    "pastectl_cleanup_duration_seconds",
+		Help:    "Duration of scheduled expired-paste cleanup runs.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	CleanupDeleted = factory.NewCounter(prometheus.CounterOpts{
+		Name: "pastectl_cleanup_deleted_total",
+		Help: "Expired pastes deleted by the scheduler.",
+	})
+
+	CleanupFailures = factory.NewCounter(prometheus.CounterOpts{
+		Name: "pastectl_cleanup_failures_total",
+		Help: "Scheduled cleanup runs that returned an error.",
+	})
+
+	CleanupLastSuccess = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "pastectl_cleanup_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful cleanup run.",
+	})
+)
+
+// Handler serves Registry in the Prometheus text format.
+func Handler() gin.HandlerFunc {
+	h := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	return gin.WrapH(h)
+}
+
+// Middleware records HTTP request counts and latencies. Routes are labelled
+// by their template (e.g. /api/pastes/:id) so paste IDs never become labels.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		HTTPRequests.WithLabelValues(route, c.Request.Method, status).Inc()
+		HTTPDuration.WithLabelValues(route, c.Request.Method, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// maxLanguages caps the distinct language label values; clients choose
+// the language string, so an unbounded label would let them blow up the
+// series count.
+const maxLanguages = 64
+
+var (
+	languagesMu sync.Mutex
+	languages   = make(map[string]struct{})
+)
+
+// LanguageLabel normalises a client-supplied language for use as a label,
+// folding anything beyond the first maxLanguages distinct values to "other".
+func LanguageLabel(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang == "" || len(lang) > 32 {
+		return "other"
+	}
+	languagesMu.Lock()
+	defer languagesMu.Unlock()
+	if _, ok := languages[lang]; ok {
+		return lang
+	}
+	if len(languages) >= maxLanguages {
+		return "other"
+	}
+	languages[lang] = struct{}{}
+	return lang
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolCollector exports pgxpool.Stat on every scrape.
+type poolCollector struct {
+	pool *pgxpool.Pool
+
+	acquired, idle, total, max, constructing *prometheus.Desc
+	acquireCount, acquireSeconds             *prometheus.Desc
+	canceledAcquires, emptyAcquires          *prometheus.Desc
+}
+
+// RegisterPool exports connection pool statistics for pool.
+func RegisterPool(pool *pgxpool.Pool) error {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("pastectl_db_pool_"+name, help, nil, nil)
+	}
+	return Registry.Register(&poolCollector{
+		pool:             pool,
+		acquired:         desc("acquired_conns", "Connections currently checked out of the pool."),
+		idle:             desc("idle_conns", "Idle connections in the pool."),
+		total:            desc("total_conns", "Total connections in the pool."),
+		max:              desc("max_conns", "Configured maximum pool size."),
+		constructing:     desc("constructing_conns", "Connections being established."),
+		acquireCount:     desc("acquires_total", "Successful connection acquisitions."),
+		acquireSeconds:   desc("acquire_duration_seconds_total", "Total time spent waiting to acquire connections."),
+		canceledAcquires: desc("canceled_acquires_total", "Acquisitions cancelled by their context."),
+		emptyAcquires:    desc("empty_acquires_total", "Acquisitions that had to wait because the pool was empty."),
+	})
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{c.acquired, c.idle, c.total, c.max, c.constructing,
+		c.acquireCount, c.acquireSeconds, c.canceledAcquires, c.emptyAcquires} {
+		ch <- d
+	}
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.pool.Stat()
+	gauge := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v)
+	}
+	counter := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v)
+	}
+	gauge(c.acquired, float64(s.AcquiredConns()))
+	gauge(c.idle, float64(s.IdleConns()))
+	gauge(c.total, float64(s.TotalConns()))
+	gauge(c.max, float64(s.MaxConns()))
+	gauge(c.constructing, float64(s.ConstructingConns()))
+	counter(c.acquireCount, float64(s.AcquireCount()))
+	counter(c.acquireSeconds, s.AcquireDuration().Seconds())
+	counter(c.canceledAcquires, float64(s.CanceledAcquireCount()))
+	counter(c.emptyAcquires, float64(s.EmptyAcquireCount()))
+}
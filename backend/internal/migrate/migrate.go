@@ -0,0 +1,224 @@
+// Package migrate applies the embedded schema migrations and records which
+// versions have run in a schema_migrations table.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migration is one numbered schema change with its up and down SQL.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status reports whether a known migration has been applied.
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// Driver is the database-specific half of a Migrator.
+type Driver interface {
+	// EnsureVersionTable creates schema_migrations if it does not exist.
+	EnsureVersionTable(ctx context.Context) error
+	// Applied returns the applied versions and when they ran.
+	Applied(ctx context.Context) (map[int64]time.Time, error)
+	// AppliedVersions reads the applied versions without creating or
+	// locking anything, reporting ok false when schema_migrations does not
+	// exist yet.
+	AppliedVersions(ctx context.Context) (versions []int64, ok bool, err error)
+	// Apply runs sql and records (up) or forgets (down) version in one
+	// transaction that holds the database-wide migration lock. It re-checks
+	// schema_migrations under that lock and reports false, without running
+	// sql, when another process got there first.
+	Apply(ctx context.Context, version int64, sql string, up bool) (bool, error)
+}
+
+// Migrator applies a fixed, ordered set of migrations through a Driver.
+type Migrator struct {
+	driver     Driver
+	migrations []Migration
+}
+
+// New returns a Migrator for migrations, which must be sorted by version.
+func New(driver Driver, migrations []Migration) *Migrator {
+	return &Migrator{
+		driver:     driver,
+		migrations: migrations,
+	}
+}
+
+// Load reads NNNNNN_name.up.sql / NNNNNN_name.down.sql pairs from dir in
+// fsys and returns them sorted by version.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+		var up bool
+		var stem string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			up, stem = true, strings.TrimSuffix(name, ".up.sql")
+		case strings.HasSuffix(name, ".down.sql"):
+			stem = strings.TrimSuffix(name, ".down.sql")
+		default:
+			return nil, fmt.Errorf("migration %s: expected .up.sql or .down.sql suffix", name)
+		}
+		prefix, label, _ := strings.Cut(stem, "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: bad version prefix: %w", name, err)
+		}
+		body, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		}
+		if up {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int64]time.Time, error) {
+	if err := m.driver.EnsureVersionTable(ctx); err != nil {
+		return nil, fmt.Errorf("create schema_migrations: %w", err)
+	}
+	applied, err := m.driver.Applied(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	return applied, nil
+}
+
+// Up applies every pending migration in order and returns how many this
+// call ran. Replicas calling Up concurrently serialise on the driver lock,
+// so each migration runs exactly once.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		ran, err := m.driver.Apply(ctx, mig.Version, mig.Up, true)
+		if err != nil {
+			return n, fmt.Errorf("apply %d_%s: %w", mig.Version, mig.Name, err)
+		}
+		if ran {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Down reverts the most recently applied migrations, at most steps of them.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	if steps <= 0 {
+		return 0, errors.New("steps must be positive")
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for i := len(m.migrations) - 1; i >= 0 && n < steps; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if mig.Down == "" {
+			return n, fmt.Errorf("migration %d_%s has no down file", mig.Version, mig.Name)
+		}
+		ran, err := m.driver.Apply(ctx, mig.Version, mig.Down, false)
+		if err != nil {
+			return n, fmt.Errorf("revert %d_%s: %w", mig.Version, mig.Name, err)
+		}
+		if ran {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Status lists every known migration and when it was applied, if at all.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if at, ok := applied[mig.Version]; ok {
+			at := at
+			s.AppliedAt = &at
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// Pending returns how many known migrations have not been applied. It only
+// reads schema_migrations, never waiting for the migration lock, so it is
+// safe to call from readiness probes while another replica migrates.
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	versions, ok, err := m.driver.AppliedVersions(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	if !ok {
+		return len(m.migrations), nil
+	}
+	applied := make(map[int64]bool, len(versions))
+	for _, v := range versions {
+		applied[v] = true
+	}
+	n := 0
+	for _, mig := range m.migrations {
+		if !applied[mig.Version] {
+			n++
+		}
+	}
+	return n, nil
+}
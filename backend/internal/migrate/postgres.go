@@ -0,0 +1,126 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/migrations"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// undefinedTable is the SQLSTATE Postgres reports for a missing table.
+const undefinedTable = "42P01"
+
+// advisoryLockKey identifies the pasteCTL migration lock among any other
+// advisory locks taken on the same database.
+const advisoryLockKey int64 = 0x70617374 // "past"
+
+type postgresDriver struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgres returns a Migrator for the embedded Postgres migrations.
+func NewPostgres(pool *pgxpool.Pool) (*Migrator, error) {
+	ms, err := Load(migrations.Postgres, ".")
+	if err != nil {
+		return nil, err
+	}
+	return New(&postgresDriver{pool: pool}, ms), nil
+}
+
+// lockedTx begins a transaction holding the migration advisory lock. The
+// lock is transaction-scoped, so replicas starting together queue behind
+// each other and it is released by commit or rollback.
+func (d *postgresDriver) lockedTx(ctx context.Context) (pgx.Tx, error) {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", advisoryLockKey); err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (d *postgresDriver) EnsureVersionTable(ctx context.Context) error {
+	tx, err := d.lockedTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations(
+		version BIGINT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (d *postgresDriver) Applied(ctx context.Context) (map[int64]time.Time, error) {
+	rows, err := d.pool.Query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+func (d *postgresDriver) AppliedVersions(ctx context.Context) ([]int64, bool, error) {
+	// Preparing the query may already fail on the missing table.
+	rows, err := d.pool.Query(ctx, "SELECT version FROM schema_migrations")
+	var versions []int64
+	if err == nil {
+		versions, err = pgx.CollectRows(rows, pgx.RowTo[int64])
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == undefinedTable {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return versions, true, nil
+}
+
+func (d *postgresDriver) Apply(ctx context.Context, version int64, sql string, up bool) (bool, error) {
+	tx, err := d.lockedTx(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	if err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version=$1)", version).Scan(&exists); err != nil {
+		return false, err
+	}
+	if exists == up {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return false, err
+	}
+	if up {
+		_, err = tx.Exec(ctx, "INSERT INTO schema_migrations(version) VALUES($1)", version)
+	} else {
+		_, err = tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version=$1", version)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
@@ -0,0 +1,100 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/migrations"
+)
+
+type sqliteDriver struct {
+	db *sql.DB
+}
+
+// NewSQLite returns a Migrator for the embedded SQLite migrations.
+func NewSQLite(sqlDB *sql.DB) (*Migrator, error) {
+	ms, err := Load(migrations.SQLite, "sqlite")
+	if err != nil {
+		return nil, err
+	}
+	return New(&sqliteDriver{db: sqlDB}, ms), nil
+}
+
+func (d *sqliteDriver) EnsureVersionTable(ctx context.Context) error {
+	_, err := d.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations(
+		version INTEGER PRIMARY KEY,
+		applied_at INTEGER NOT NULL
+	)`)
+	return err
+}
+
+func (d *sqliteDriver) Applied(ctx context.Context) (map[int64]time.Time, error) {
+	rows, err := d.db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version, at int64
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = time.UnixMicro(at)
+	}
+	return applied, rows.Err()
+}
+
+func (d *sqliteDriver) AppliedVersions(ctx context.Context) ([]int64, bool, error) {
+	var exists bool
+	err := d.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type='table' AND name='schema_migrations')").Scan(&exists)
+	if err != nil || !exists {
+		return nil, false, err
+	}
+	rows, err := d.db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	var versions []int64
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			return nil, false, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, true, rows.Err()
+}
+
+// Apply needs no separate lock: SQLite serialises writers on the database
+// file, and the version check and migration share one transaction.
+func (d *sqliteDriver) Apply(ctx context.Context, version int64, stmt string, up bool) (bool, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var n int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations WHERE version=?", version).Scan(&n); err != nil {
+		return false, err
+	}
+	if (n > 0) == up {
+		return false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, stmt); err != nil {
+		return false, err
+	}
+	if up {
+		_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations(version, applied_at) VALUES(?, ?)", version, time.Now().UnixMicro())
+	} else {
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version=?", version)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,342 @@
+// Package ot implements operational transformation for plain text, in the
+// style of ot.js. An Op walks the whole document from start to end and
+// retains, inserts or deletes text as it goes; two ops made concurrently
+// on the same document are reconciled with Transform so that applying
+// them in either order gives the same text. Lengths count Unicode code
+// points.
+package ot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"unicode/utf8"
+)
+
+var (
+	// ErrBaseLength is returned when an op does not span the document, or
+	// two ops given to Transform do not start from the same one.
+	ErrBaseLength = errors.New("operation length does not match the document")
+	ErrInvalidOp  = errors.New("invalid operation")
+)
+
+// MaxLen bounds the length of the document an op decoded from JSON may
+// span or produce, far beyond any paste, so that no sum of its lengths
+// can overflow.
+const MaxLen = 1 << 30
+
+// Component is one step of an Op. Exactly one field is set.
+type Component struct {
+	Retain int
+	Insert string
+	Delete int
+}
+
+// Op is an edit of a whole document. Build one with Retain, Insert and
+// Delete, which keep it in canonical form: adjacent components of one kind
+// are merged and an insert always precedes a delete at the same place.
+type Op []Component
+
+// Retain skips over n characters.
+func (o Op) Retain(n int) Op {
+	if n <= 0 {
+		return o
+	}
+	if last := len(o) - 1; last >= 0 && o[last].Retain > 0 {
+		o[last].Retain += n
+		return o
+	}
+	return append(o, Component{Retain: n})
+}
+
+// Insert adds s at the current position.
+func (o Op) Insert(s string) Op {
+	if s == "" {
+		return o
+	}
+	last := len(o) - 1
+	switch {
+	case last >= 0 && o[last].Insert != "":
+		o[last].Insert += s
+	case last >= 0 && o[last].Delete > 0:
+		// Deleting then inserting equals inserting then deleting; keep
+		// the latter so equal edits have one representation.
+		if last > 0 && o[last-1].Insert != "" {
+			o[last-1].Insert += s
+		} else {
+			o = append(o, Component{})
+			copy(o[last+1:], o[last:])
+			o[last] = Component{Insert: s}
+		}
+	default:
+		o = append(o, Component{Insert: s})
+	}
+	return o
+}
+
+// Delete removes the next n characters.
+func (o Op) Delete(n int) Op {
+	if n <= 0 {
+		return o
+	}
+	if last := len(o) - 1; last >= 0 && o[last].Delete > 0 {
+		o[last].Delete += n
+		return o
+	}
+	return append(o, Component{Delete: n})
+}
+
+// BaseLen is the length of the document the op applies to, or -1 if a
+// length is negative or they overflow.
+func (o Op) BaseLen() int {
+	n := 0
+	for _, c := range o {
+		n = addLen(addLen(n, c.Retain), c.Delete)
+	}
+	return n
+}
+
+// TargetLen is the length of the document the op produces, or -1 if a
+// length is negative or they overflow.
+func (o Op) TargetLen() int {
+	n := 0
+	for _, c := range o {
+		n = addLen(addLen(n, c.Retain), utf8.RuneCountInString(c.Insert))
+	}
+	return n
+}
+
+// addLen adds two lengths, giving -1 when either is negative or the sum
+// overflows.
+func addLen(n, m int) int {
+	if n < 0 || m < 0 || m > math.MaxInt-n {
+		return -1
+	}
+	return n + m
+}
+
+// IsNoop reports whether the op leaves the document unchanged.
+func (o Op) IsNoop() bool {
+	return len(o) == 0 || len(o) == 1 && o[0].Retain > 0
+}
+
+// Apply returns doc with op applied.
+func Apply(doc []rune, op Op) ([]rune, error) {
+	if op.BaseLen() != len(doc) {
+		return nil, ErrBaseLength
+	}
+	out := make([]rune, 0, len(doc))
+	i := 0
+	for _, c := range op {
+		switch {
+		case c.Retain > 0:
+			if c.Retain > len(doc)-i {
+				return nil, ErrInvalidOp
+			}
+			out = append(out, doc[i:i+c.Retain]...)
+			i += c.Retain
+		case c.Insert != "":
+			out = append(out, []rune(c.Insert)...)
+		default:
+			if c.Delete <= 0 || c.Delete > len(doc)-i {
+				return nil, ErrInvalidOp
+			}
+			i += c.Delete
+		}
+	}
+	return out, nil
+}
+
+// Diff returns an op turning before into after. It finds the single
+// changed region between their common prefix and suffix, which is exact
+// for the typing, pasting and deleting an editor reports.
+func Diff(before, after []rune) Op {
+	prefix := 0
+	for prefix < len(before) && prefix < len(after) && before[prefix] == after[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(before)-prefix && suffix < len(after)-prefix &&
+		before[len(before)-1-suffix] == after[len(after)-1-suffix] {
+		suffix++
+	}
+	var op Op
+	op = op.Retain(prefix)
+	op = op.Insert(string(after[prefix : len(after)-suffix]))
+	op = op.Delete(len(before) - prefix - suffix)
+	return op.Retain(suffix)
+}
+
+// cursor walks the components of an op, splitting retains and deletes as
+// the other side of a transform consumes them.
+type cursor struct {
+	op  Op
+	i   int
+	cur Component
+	ok  bool
+}
+
+func newCursor(op Op) *cursor {
+	c := &cursor{op: op}
+	c.next()
+	return c
+}
+
+func (c *cursor) next() {
+	if c.i < len(c.op) {
+		c.cur, c.ok = c.op[c.i], true
+		c.i++
+		return
+	}
+	c.cur, c.ok = Component{}, false
+}
+
+// take consumes n characters of the current retain or delete.
+func (c *cursor) take(n int) {
+	if c.cur.Retain > 0 {
+		c.cur.Retain -= n
+		if c.cur.Retain == 0 {
+			c.next()
+		}
+		return
+	}
+	c.cur.Delete -= n
+	if c.cur.Delete == 0 {
+		c.next()
+	}
+}
+
+func (c *cursor) span() int {
+	return c.cur.Retain + c.cur.Delete
+}
+
+// Transform takes ops a and b made concurrently on the same document and
+// returns a' and b' such that applying a then b' equals applying b then
+// a'. When both insert at one position, a's text comes first.
+func Transform(a, b Op) (Op, Op, error) {
+	if a.BaseLen() < 0 || b.BaseLen() < 0 {
+		return nil, nil, ErrInvalidOp
+	}
+	if a.BaseLen() != b.BaseLen() {
+		return nil, nil, ErrBaseLength
+	}
+	var a1, b1 Op
+	ca, cb := newCursor(a), newCursor(b)
+	for ca.ok || cb.ok {
+		if ca.ok && ca.cur.Insert != "" {
+			a1 = a1.Insert(ca.cur.Insert)
+			b1 = b1.Retain(utf8.RuneCountInString(ca.cur.Insert))
+			ca.next()
+			continue
+		}
+		if cb.ok && cb.cur.Insert != "" {
+			a1 = a1.Retain(utf8.RuneCountInString(cb.cur.Insert))
+			b1 = b1.Insert(cb.cur.Insert)
+			cb.next()
+			continue
+		}
+		if !ca.ok || !cb.ok {
+			// Equal base lengths make this unreachable.
+			return nil, nil, ErrBaseLength
+		}
+		n := min(ca.span(), cb.span())
+		if n <= 0 {
+			return nil, nil, ErrInvalidOp
+		}
+		switch {
+		case ca.cur.Retain > 0 && cb.cur.Retain > 0:
+			a1 = a1.Retain(n)
+			b1 = b1.Retain(n)
+		case ca.cur.Delete > 0 && cb.cur.Retain > 0:
+			a1 = a1.Delete(n)
+		case ca.cur.Retain > 0 && cb.cur.Delete > 0:
+			b1 = b1.Delete(n)
+		}
+		// Both deleting the same text leaves nothing for either to do.
+		ca.take(n)
+		cb.take(n)
+	}
+	return a1, b1, nil
+}
+
+// TransformIndex maps a position in the document op applies to onto the
+// document it produces, e.g. to keep a cursor in place as others edit.
+// Text inserted at the position lands before it, and a position inside
+// deleted text moves to the start of the deletion.
+func TransformIndex(index int, op Op) int {
+	out, at := index, 0
+	for _, c := range op {
+		if at > index {
+			break
+		}
+		switch {
+		case c.Retain > 0:
+			at += c.Retain
+		case c.Insert != "":
+			out += utf8.RuneCountInString(c.Insert)
+		default:
+			out -= min(c.Delete, index-at)
+			at += c.Delete
+		}
+	}
+	return out
+}
+
+// MarshalJSON encodes the op as ot.js does: a positive number retains, a
+// negative one deletes and a string inserts, e.g. [3,"abc",-2,5].
+func (o Op) MarshalJSON() ([]byte, error) {
+	parts := make([]any, len(o))
+	for i, c := range o {
+		switch {
+		case c.Retain > 0:
+			parts[i] = c.Retain
+		case c.Insert != "":
+			parts[i] = c.Insert
+		default:
+			parts[i] = -c.Delete
+		}
+	}
+	return json.Marshal(parts)
+}
+
+func (o *Op) UnmarshalJSON(data []byte) error {
+	var parts []json.RawMessage
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidOp, err)
+	}
+	var op Op
+	base, target := 0, 0
+	for _, p := range parts {
+		p = bytes.TrimSpace(p)
+		if len(p) > 0 && p[0] == '"' {
+			var s string
+			if err := json.Unmarshal(p, &s); err != nil || s == "" {
+				return fmt.Errorf("%w: bad insert %s", ErrInvalidOp, p)
+			}
+			if target = addLen(target, utf8.RuneCountInString(s)); target > MaxLen {
+				return fmt.Errorf("%w: too long", ErrInvalidOp)
+			}
+			op = op.Insert(s)
+			continue
+		}
+		var n int
+		if err := json.Unmarshal(p, &n); err != nil || n == 0 || n < -MaxLen || n > MaxLen {
+			return fmt.Errorf("%w: bad component %s", ErrInvalidOp, p)
+		}
+		if base = addLen(base, max(n, -n)); base > MaxLen {
+			return fmt.Errorf("%w: too long", ErrInvalidOp)
+		}
+		if n > 0 {
+			if target = addLen(target, n); target > MaxLen {
+				return fmt.Errorf("%w: too long", ErrInvalidOp)
+			}
+			op = op.Retain(n)
+		} else {
+			op = op.Delete(-n)
+		}
+	}
+	*o = op
+	return nil
+}
@@ -0,0 +1,72 @@
+package pasteService
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/tracing"
+)
+
+// newToken returns a random owner or edit token and the hash that is stored
+// in its place.
+func newToken() (token, hash string, err error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// tokenMatches reports whether token hashes to hash. Pastes created before
+// ownership or edit tokens existed have no hash and match nothing.
+func tokenMatches(hash, token string) bool {
+	if hash == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(hashToken(token))) == 1
+}
+
+func (s *pasteService) CheckOwner(ctx context.Context, id, ownerToken string) (err error) {
+	ctx, span := tracer.Start(ctx, "PasteService.CheckOwner")
+	span.SetAttributes(tracing.AttrPasteID.String(id))
+	defer func() { tracing.End(span, err) }()
+
+	paste, err := s.GetPaste(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !tokenMatches(paste.OwnerHash, ownerToken) {
+		return ErrNotOwner
+	}
+	return nil
+}
+
+func (s *pasteService) CheckEditor(ctx context.Context, id, token string) (err error) {
+	ctx, span := tracer.Start(ctx, "PasteService.CheckEditor")
+	span.SetAttributes(tracing.AttrPasteID.String(id))
+	defer func() { tracing.End(span, err) }()
+
+	paste, err := s.GetPaste(ctx, id)
+	if err != nil {
+		return err
+	}
+	// Pastes created before edit tokens existed have neither hash. They
+	// stay open to everyone, as they were when they were created.
+	if paste.OwnerHash == "" && paste.EditHash == "" {
+		return nil
+	}
+	if !tokenMatches(paste.OwnerHash, token) && !tokenMatches(paste.EditHash, token) {
+		return ErrNotEditor
+	}
+	return nil
+}
@@ -1,35 +1,151 @@
 package pasteService
 
 import (
+	"context"
 	"errors"
-	"log"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	"github.com/Sumedhvats/pasteCTL_web/internal/logging"
+	"github.com/Sumedhvats/pasteCTL_web/internal/tracing"
 	"github.com/Sumedhvats/pasteCTL_web/pkg"
-	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 )
+
+var tracer = otel.Tracer("github.com/Sumedhvats/pasteCTL_web/internal/paste")
+
 type PasteService interface {
-	CreatePaste(content string, lang string, expireMinutes int) (*db.Paste, error)
-	GetPaste(id string) (*db.Paste, error)
-	GetContent(id string) (string, error)
-	UpdatePaste(id string,content string, lang string)(*db.Paste,error)
-	UpdateViews(id string,count int)(*db.Paste,error)
-	DeleteExpiredPastes()error
+	CreatePaste(ctx context.Context, content string, lang string, expireMinutes int) (*db.Paste, error)
+	// CreatePasteWithSlug creates a paste under a caller-chosen ID. It fails
+	// with ErrInvalidSlug or ErrSlugTaken when slug cannot be used.
+	CreatePasteWithSlug(ctx context.Context, slug, content, lang string, expireMinutes int) (*db.Paste, error)
+	GetPaste(ctx context.Context, id string) (*db.Paste, error)
+	GetContent(ctx context.Context, id string) (string, error)
+	UpdatePaste(ctx context.Context, id string, content string, lang string) (*db.Paste, error)
+	UpdateViews(ctx context.Context, id string, count int) (*db.Paste, error)
+	DeleteExpiredPastes(ctx context.Context) (int64, error)
+	// CheckOwner fails with ErrNotOwner unless ownerToken is the owner
+	// token of id.
+	CheckOwner(ctx context.Context, id, ownerToken string) error
+	// CheckEditor fails with ErrNotEditor unless token is the owner or
+	// edit token of id. Pastes without either token accept any token,
+	// even an empty one.
+	CheckEditor(ctx context.Context, id, token string) error
+	// GetStats returns the analytics for id to the holder of its owner token.
+	GetStats(ctx context.Context, id, ownerToken string) (*Stats, error)
+	// RollupStats folds recorded analytics events into the stats rollups.
+	RollupStats(ctx context.Context) (int64, error)
+	// ListRevisions returns the saved versions of id, newest first.
+	ListRevisions(ctx context.Context, id string) ([]db.Revision, error)
 }
+
 var (
-    ErrPasteNotFound = errors.New("paste not found")
-    ErrPasteExpired  = errors.New("paste has expired")
+	ErrPasteNotFound = errors.New("paste not found")
+	ErrPasteExpired  = errors.New("paste has expired")
+	ErrNotOwner      = errors.New("not the owner of this paste")
+	ErrNotEditor     = errors.New("not an editor of this paste")
+)
+
+// Default ID settings. 62^8 IDs are far too many to enumerate.
+const (
+	DefaultIDLength   = 8
+	DefaultIDAlphabet = pkg.DefaultAlphabet
 )
-type pasteService struct{
-	repo db.Repository
+
+// maxIDAttempts bounds the retries when a generated ID is already taken.
+const maxIDAttempts = 5
+
+// Options tune a PasteService. Zero fields fall back to the defaults.
+type Options struct {
+	IDLength   int
+	IDAlphabet string
+	// ReservedSlugs are refused as custom IDs in addition to
+	// DefaultReservedSlugs.
+	ReservedSlugs []string
+}
+
+type pasteService struct {
+	repo     db.Repository
+	ids      pkg.IDGenerator
+	reserved map[string]struct{}
+}
+
+func NewPasteService(r db.Repository) PasteService {
+	return NewPasteServiceWithOptions(r, Options{})
 }
-func NewPasteService(r db.Repository)PasteService{
+
+func NewPasteServiceWithOptions(r db.Repository, opts Options) PasteService {
+	if opts.IDLength <= 0 {
+		opts.IDLength = DefaultIDLength
+	}
+	if opts.IDAlphabet == "" {
+		opts.IDAlphabet = DefaultIDAlphabet
+	}
+	reserved := make(map[string]struct{}, len(DefaultReservedSlugs)+len(opts.ReservedSlugs))
+	for _, w := range slices.Concat(DefaultReservedSlugs, opts.ReservedSlugs) {
+		reserved[strings.ToLower(w)] = struct{}{}
+	}
 	return &pasteService{
-		repo:r,
+		repo:     r,
+		ids:      pkg.IDGenerator{Length: opts.IDLength, Alphabet: opts.IDAlphabet},
+		reserved: reserved,
+	}
+}
+
+func (s *pasteService) CreatePaste(ctx context.Context, content string, lang string, expireMinutes int) (_ *db.Paste, err error) {
+	ctx, span := tracer.Start(ctx, "PasteService.CreatePaste")
+	span.SetAttributes(tracing.AttrPasteLanguage.String(lang), attribute.Int("paste.expire_minutes", expireMinutes))
+	defer func() { tracing.End(span, err) }()
+
+	paste, err := newPaste(content, lang, expireMinutes)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < maxIDAttempts; i++ {
+		paste.ID = s.ids.New()
+		err := s.repo.CreatePaste(ctx, paste)
+		if err == nil {
+			span.SetAttributes(tracing.AttrPasteID.String(paste.ID))
+			return paste, nil
+		}
+		if !errors.Is(err, db.ErrDuplicateID) {
+			return nil, err
+		}
+		logging.FromContext(ctx).Warn("ID collision detected, retrying", "paste_id", paste.ID)
+	}
+
+	return nil, fmt.Errorf("failed to generate a unique ID after %d attempts", maxIDAttempts)
+}
+
+func (s *pasteService) CreatePasteWithSlug(ctx context.Context, slug, content, lang string, expireMinutes int) (_ *db.Paste, err error) {
+	ctx, span := tracer.Start(ctx, "PasteService.CreatePasteWithSlug")
+	span.SetAttributes(tracing.AttrPasteID.String(slug), tracing.AttrPasteLanguage.String(lang), attribute.Int("paste.expire_minutes", expireMinutes))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.checkSlug(slug); err != nil {
+		return nil, err
+	}
+	paste, err := newPaste(content, lang, expireMinutes)
+	if err != nil {
+		return nil, err
+	}
+	paste.ID = slug
+	if err := s.repo.CreatePaste(ctx, paste); err != nil {
+		if errors.Is(err, db.ErrDuplicateID) {
+			return nil, ErrSlugTaken
+		}
+		return nil, err
 	}
+	return paste, nil
 }
-func (s *pasteService)CreatePaste(content string, lang string, expireMinutes int) (*db.Paste, error) {
+
+// newPaste builds a paste without an ID. It carries new owner and edit
+// tokens, of which only the hashes are stored.
+func newPaste(content, lang string, expireMinutes int) (*db.Paste, error) {
 	if content == "" || lang == "" {
 		return nil, errors.New("content and language required")
 	}
@@ -40,95 +156,98 @@ func (s *pasteService)CreatePaste(content string, lang string, expireMinutes int
 		expireTime = &t
 	}
 
-	for i := 0; i < 5; i++ {
-		id :=pkg.GenerateId(5)
-		paste := &db.Paste{
-			ID:       id,
-			Content:  content,
-			Language: lang,
-			ExpireAt: expireTime,
-		}
-
-		err := s.repo.CreatePaste(paste)
-		if err == nil {
-			return paste, nil
-		}
-
-		if err.Error() != "unique constraint violation" {
-			return nil, err
-		}
-		log.Printf("ID collision detected, retrying: %s", id)
+	ownerToken, ownerHash, err := newToken()
+	if err != nil {
+		return nil, err
 	}
-
-	return nil, errors.New("failed to generate a unique ID after 5 attempts")
+	editToken, editHash, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	return &db.Paste{
+		Content:    content,
+		Language:   lang,
+		ExpireAt:   expireTime,
+		OwnerToken: ownerToken,
+		OwnerHash:  ownerHash,
+		EditToken:  editToken,
+		EditHash:   editHash,
+	}, nil
 }
 
+func (s *pasteService) UpdatePaste(ctx context.Context, id string, content string, lang string) (_ *db.Paste, err error) {
+	ctx, span := tracer.Start(ctx, "PasteService.UpdatePaste")
+	span.SetAttributes(tracing.AttrPasteID.String(id), tracing.AttrPasteLanguage.String(lang))
+	defer func() { tracing.End(span, err) }()
 
-func (s *pasteService) UpdatePaste(id string, content string, lang string) (*db.Paste, error) {
-    if content == "" {
-        return nil, errors.New("content is required")
-    }
+	if content == "" {
+		return nil, errors.New("content is required")
+	}
 
-    paste := &db.Paste{
-        ID:      id,
-        Content: content,
-    }
+	paste := &db.Paste{
+		ID:      id,
+		Content: content,
+	}
 
-    if lang != "" {
-        paste.Language = lang
-    } else {
-        paste.Language = "text" // default language
-    }
+	if lang != "" {
+		paste.Language = lang
+	} else {
+		paste.Language = "text" // default language
+	}
 
-    err := s.repo.UpdatePaste(paste)
-    if err != nil {
-        log.Printf("Failed to update paste ID=%s: %v", id, err)
-        return nil, err
-    }
+	err = s.repo.UpdatePaste(ctx, paste)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to update paste", "paste_id", id, "error", err)
+		return nil, err
+	}
 
-    return paste, nil
+	return paste, nil
 }
 
-func (s *pasteService)UpdateViews(id string,count int)(*db.Paste,error){
-	paste:=&db.Paste{
+func (s *pasteService) UpdateViews(ctx context.Context, id string, count int) (_ *db.Paste, err error) {
+	ctx, span := tracer.Start(ctx, "PasteService.UpdateViews")
+	span.SetAttributes(tracing.AttrPasteID.String(id))
+	defer func() { tracing.End(span, err) }()
+
+	paste := &db.Paste{
 		ID: id,
 	}
-	err:=s.repo.UpdateViews(paste,count )
-	if err!=nil {
-		return nil,err
+	err = s.repo.UpdateViews(ctx, paste, count)
+	if err != nil {
+		return nil, err
 	}
-	return paste,nil
+	return paste, nil
 }
 
-func(s *pasteService) GetPaste(id string) (*db.Paste, error) {
-    paste, err := s.repo.GetPaste(id)
-    if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
+func (s *pasteService) GetPaste(ctx context.Context, id string) (*db.Paste, error) {
+	ctx, span := tracer.Start(ctx, "PasteService.GetPaste")
+	span.SetAttributes(tracing.AttrPasteID.String(id))
+	defer span.End()
+
+	paste, err := s.repo.GetPaste(ctx, id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
 			return nil, ErrPasteNotFound
 		}
+		tracing.RecordError(span, err)
 		return nil, err // It's some other real DB error
 	}
-    if paste == nil {
-        return nil, ErrPasteNotFound
-    }
-    if paste.ExpireAt != nil && time.Now().After(*paste.ExpireAt) {
-        return nil, ErrPasteExpired
-    }
-    return paste, nil
+	span.SetAttributes(tracing.AttrPasteLanguage.String(paste.Language))
+	if paste.ExpireAt != nil && time.Now().After(*paste.ExpireAt) {
+		return nil, ErrPasteExpired
+	}
+	return paste, nil
 }
 
-func (s *pasteService)GetContent(id string)(string,error){
-	paste, err := s.repo.GetPaste(id)
+func (s *pasteService) GetContent(ctx context.Context, id string) (string, error) {
+	paste, err := s.GetPaste(ctx, id)
 	if err != nil {
 		return "", err
 	}
-
-	if paste.ExpireAt != nil && time.Now().After(*paste.ExpireAt) {
-		return "", errors.New("paste has expired")
-	}
-
 	return paste.Content, nil
 }
-func (s *pasteService)DeleteExpiredPastes()error{
-	return s.repo.DeleteExpired()
-}
\ No newline at end of file
+func (s *pasteService) DeleteExpiredPastes(ctx context.Context) (_ int64, err error) {
+	ctx, span := tracer.Start(ctx, "PasteService.DeleteExpiredPastes")
+	defer func() { tracing.End(span, err) }()
+	return s.repo.DeleteExpired(ctx)
+}
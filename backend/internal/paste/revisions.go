@@ -0,0 +1,28 @@
+package pasteService
+
+import (
+	"context"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	"github.com/Sumedhvats/pasteCTL_web/internal/tracing"
+)
+
+func (s *pasteService) ListRevisions(ctx context.Context, id string) (_ []db.Revision, err error) {
+	ctx, span := tracer.Start(ctx, "PasteService.ListRevisions")
+	span.SetAttributes(tracing.AttrPasteID.String(id))
+	defer func() { tracing.End(span, err) }()
+
+	// Revisions are as readable as the paste itself, so an expired paste
+	// hides them too.
+	if _, err := s.GetPaste(ctx, id); err != nil {
+		return nil, err
+	}
+	revs, err := s.repo.ListRevisions(ctx, id, db.MaxRevisions)
+	if err != nil {
+		return nil, err
+	}
+	if revs == nil {
+		revs = []db.Revision{}
+	}
+	return revs, nil
+}
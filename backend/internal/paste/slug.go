@@ -0,0 +1,47 @@
+package pasteService
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	minSlugLength = 3
+	maxSlugLength = 64
+)
+
+var (
+	ErrInvalidSlug = errors.New("slug must be 3-64 letters, digits, '-' or '_', starting and ending with a letter or digit")
+	// ErrSlugTaken is returned for slugs that are reserved or already used
+	// by another paste.
+	ErrSlugTaken = errors.New("slug is not available")
+)
+
+// DefaultReservedSlugs are words that may not become paste IDs because
+// they name, or may one day name, routes of the API or the frontend.
+var DefaultReservedSlugs = []string{
+	"about", "admin", "api", "assets", "auth", "docs", "download", "edit",
+	"events", "healthz", "help", "login", "logout", "metrics", "new",
+	"paste", "pastes", "raw", "readyz", "settings", "signup", "static",
+	"stats", "version", "view", "views", "ws",
+}
+
+// checkSlug validates a requested custom ID against the slug format and
+// the reserved words, which are compared case-insensitively.
+func (s *pasteService) checkSlug(slug string) error {
+	if len(slug) < minSlugLength || len(slug) > maxSlugLength {
+		return ErrInvalidSlug
+	}
+	for i := 0; i < len(slug); i++ {
+		c := slug[i]
+		alnum := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+		edge := i == 0 || i == len(slug)-1
+		if !alnum && (edge || c != '-' && c != '_') {
+			return ErrInvalidSlug
+		}
+	}
+	if _, ok := s.reserved[strings.ToLower(slug)]; ok {
+		return ErrSlugTaken
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package pasteService
+
+import (
+	"context"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	"github.com/Sumedhvats/pasteCTL_web/internal/tracing"
+)
+
+const (
+	// statsHours and statsDays are how far back the hourly and daily
+	// series in Stats reach.
+	statsHours = 48
+	statsDays  = 30
+)
+
+// Stats is the analytics report for one paste. Counts are keyed by event
+// kind: view, rendered, raw, download and session.
+type Stats struct {
+	PasteID string `json:"paste_id"`
+	// Views is the paste's view counter, which includes views not yet
+	// rolled up into the series below.
+	Views         int                `json:"views"`
+	UniqueViewers int64              `json:"unique_viewers"`
+	Totals        map[string]int64   `json:"totals"`
+	Hourly        []StatsBucket      `json:"hourly"`
+	Daily         []StatsBucket      `json:"daily"`
+	Referrers     []db.ReferrerCount `json:"referrers"`
+	// GeneratedAt is when the report was built. Events newer than the last
+	// rollup run are not included yet.
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// StatsBucket counts events in the hour or UTC day starting at Start.
+// Buckets without events are omitted.
+type StatsBucket struct {
+	Start  time.Time        `json:"start"`
+	Counts map[string]int64 `json:"counts"`
+}
+
+func (s *pasteService) GetStats(ctx context.Context, id, ownerToken string) (_ *Stats, err error) {
+	ctx, span := tracer.Start(ctx, "PasteService.GetStats")
+	span.SetAttributes(tracing.AttrPasteID.String(id))
+	defer func() { tracing.End(span, err) }()
+
+	paste, err := s.GetPaste(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !tokenMatches(paste.OwnerHash, ownerToken) {
+		return nil, ErrNotOwner
+	}
+
+	now := time.Now().UTC()
+	dayStart := now.Truncate(24*time.Hour).AddDate(0, 0, -(statsDays - 1))
+	raw, err := s.repo.GetStats(ctx, id, dayStart)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{
+		PasteID:       id,
+		Views:         paste.Views,
+		UniqueViewers: raw.UniqueViewers,
+		Totals:        raw.Totals,
+		Hourly:        []StatsBucket{},
+		Daily:         []StatsBucket{},
+		Referrers:     raw.Referrers,
+		GeneratedAt:   now,
+	}
+	if stats.Referrers == nil {
+		stats.Referrers = []db.ReferrerCount{}
+	}
+	hourStart := now.Truncate(time.Hour).Add(-(statsHours - 1) * time.Hour)
+	for _, h := range raw.Hourly {
+		if !h.Hour.Before(hourStart) {
+			stats.Hourly = addToBucket(stats.Hourly, h.Hour, h.Kind, h.Count)
+		}
+		stats.Daily = addToBucket(stats.Daily, h.Hour.Truncate(24*time.Hour), h.Kind, h.Count)
+	}
+	return stats, nil
+}
+
+// addToBucket adds count to the last bucket if it starts at start, or
+// appends a new one. raw.Hourly is sorted, so buckets stay in order.
+func addToBucket(buckets []StatsBucket, start time.Time, kind string, count int64) []StatsBucket {
+	if n := len(buckets); n > 0 && buckets[n-1].Start.Equal(start) {
+		buckets[n-1].Counts[kind] += count
+		return buckets
+	}
+	return append(buckets, StatsBucket{Start: start, Counts: map[string]int64{kind: count}})
+}
+
+func (s *pasteService) RollupStats(ctx context.Context) (_ int64, err error) {
+	ctx, span := tracer.Start(ctx, "PasteService.RollupStats")
+	defer func() { tracing.End(span, err) }()
+	return s.repo.RollupEvents(ctx, time.Now())
+}
@@ -0,0 +1,126 @@
+// Package tracing configures the OpenTelemetry tracer provider and the W3C
+// trace-context propagator used across the handler, service and repository.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName is reported as service.name on every span.
+const ServiceName = "pastectl-backend"
+
+// Config selects where spans go.
+type Config struct {
+	// Exporter is "off", "stdout" or "otlp". The OTLP exporter reads its
+	// endpoint and headers from the standard OTEL_EXPORTER_OTLP_* variables.
+	Exporter string
+	// SampleRatio is the fraction of new traces recorded; sampling decisions
+	// from an incoming traceparent are respected.
+	SampleRatio float64
+}
+
+// Setup installs the global tracer provider and propagator. The returned
+// function flushes buffered spans and must be called on shutdown.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "", "off":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	attrs := []resource.Option{resource.WithAttributes(semconv.ServiceName(ServiceName))}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		attrs = append(attrs, resource.WithAttributes(semconv.ServiceVersion(info.Main.Version)))
+	}
+	res, err := resource.New(ctx, append(attrs, resource.WithFromEnv(), resource.WithHost())...)
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// untracedPrefixes are paths that would only add noise or, for WebSockets,
+// hold a span open for the whole session.
+var untracedPrefixes = []string{"/api/ws/", "/healthz", "/readyz", "/metrics", "/version"}
+
+// Middleware starts a server span per request, continuing any trace passed
+// in a traceparent header, and tags it with the paste ID when the route has
+// one. Request and response bodies are never recorded.
+func Middleware() []gin.HandlerFunc {
+	return []gin.HandlerFunc{
+		otelgin.Middleware(ServiceName, otelgin.WithFilter(func(r *http.Request) bool {
+			for _, p := range untracedPrefixes {
+				if strings.HasPrefix(r.URL.Path, p) {
+					return false
+				}
+			}
+			return true
+		})),
+		func(c *gin.Context) {
+			if id := c.Param("id"); id != "" {
+				trace.SpanFromContext(c.Request.Context()).SetAttributes(AttrPasteID.String(id))
+			}
+			c.Next()
+		},
+	}
+}
+
+// Attribute keys shared by every layer. Paste content is deliberately absent.
+const (
+	AttrPasteID       = attribute.Key("paste.id")
+	AttrPasteLanguage = attribute.Key("paste.language")
+)
+
+// RecordError marks span failed with err.
+func RecordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// End finishes span, marking it failed if err is non-nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		RecordError(span, err)
+	}
+	span.End()
+}
@@ -0,0 +1,164 @@
+// Package views counts paste views in memory and writes them to storage in
+// batches, so a popular paste costs one UPDATE per flush rather than one
+// per visitor, and a client looping on the view endpoint is counted once
+// per dedup window.
+package views
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	"github.com/Sumedhvats/pasteCTL_web/internal/metrics"
+)
+
+// DefaultMaxTracked bounds the visitor/paste pairs remembered for
+// deduplication when Options.MaxTracked is zero.
+const DefaultMaxTracked = 100_000
+
+// Store persists aggregated view increments. The paste service satisfies it.
+type Store interface {
+	UpdateViews(ctx context.Context, id string, count int) (*db.Paste, error)
+}
+
+type Options struct {
+	// DedupWindow is how long repeat views of a paste by the same visitor
+	// are ignored. Zero counts every view.
+	DedupWindow time.Duration
+	// MaxTracked bounds the visitors remembered for deduplication. Once it
+	// is reached, views from visitors not already remembered are dropped
+	// until older entries expire, so a flood of fresh fingerprints can
+	// neither exhaust memory nor inflate counts.
+	MaxTracked int
+}
+
+type seenKey struct {
+	paste   string
+	visitor string
+}
+
+// Counter aggregates view increments until the next Flush.
+type Counter struct {
+	store      Store
+	window     time.Duration
+	maxTracked int
+
+	mu      sync.Mutex
+	pending map[string]int
+	seen    map[seenKey]time.Time // expiry of each dedup entry
+}
+
+func NewCounter(store Store, opts Options) *Counter {
+	if opts.MaxTracked <= 0 {
+		opts.MaxTracked = DefaultMaxTracked
+	}
+	return &Counter{
+		store:      store,
+		window:     opts.DedupWindow,
+		maxTracked: opts.MaxTracked,
+		pending:    make(map[string]int),
+		seen:       make(map[seenKey]time.Time),
+	}
+}
+
+// Record counts a view of paste id by visitor, an opaque fingerprint,
+// unless the same visitor was counted within the dedup window. It reports
+// whether the view was counted.
+func (c *Counter) Record(id, visitor string) bool {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.window > 0 {
+		key := seenKey{id, visitor}
+		if until, ok := c.seen[key]; ok && now.Before(until) {
+			metrics.ViewsRecorded.WithLabelValues("duplicate").Inc()
+			return false
+		}
+		if len(c.seen) >= c.maxTracked {
+			c.pruneLocked(now)
+			if len(c.seen) >= c.maxTracked {
+				metrics.ViewsRecorded.WithLabelValues("dropped").Inc()
+				return false
+			}
+		}
+		c.seen[key] = now.Add(c.window)
+	}
+	c.pending[id]++
+	metrics.ViewsRecorded.WithLabelValues("counted").Inc()
+	metrics.ViewsPending.Inc()
+	return true
+}
+
+// Pending returns the views of id recorded but not yet flushed, so
+// responses can include them.
+func (c *Counter) Pending(id string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pending[id]
+}
+
+// Flush writes every pending count to the store, one call per paste.
+// Counts that fail to write are kept for the next flush.
+func (c *Counter) Flush(ctx context.Context) error {
+	c.mu.Lock()
+	batch := c.pending
+	c.pending = make(map[string]int, len(batch))
+	c.pruneLocked(time.Now())
+	c.mu.Unlock()
+
+	var errs []error
+	for id, n := range batch {
+		if err := ctx.Err(); err != nil {
+			c.requeue(id, n)
+			errs = append(errs, err)
+			continue
+		}
+		if _, err := c.store.UpdateViews(ctx, id, n); err != nil {
+			c.requeue(id, n)
+			errs = append(errs, err)
+			continue
+		}
+		metrics.ViewsFlushed.Add(float64(n))
+		metrics.ViewsPending.Sub(float64(n))
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// Run flushes every interval until ctx is cancelled. It does not flush on
+// the way out: call Flush once requests have drained so the last views
+// are not lost.
+func (c *Counter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := c.Flush(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("flushing view counts failed", "error", err)
+		}
+	}
+}
+
+func (c *Counter) requeue(id string, n int) {
+	c.mu.Lock()
+	c.pending[id] += n
+	c.mu.Unlock()
+}
+
+func (c *Counter) pruneLocked(now time.Time) {
+	for k, until := range c.seen {
+		if !now.Before(until) {
+			delete(c.seen, k)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package ws
+
+import (
+	"context"
+	"sync"
+)
+
+// Bus carries room messages between the replicas of the server. Every
+// message published by any replica reaches the listener of every replica,
+// the publisher's own included, and all listeners receive them in the same
+// order. Rooms rely on that order to apply the same edits in the same
+// sequence everywhere.
+type Bus interface {
+	// Publish sends msg to every listener.
+	Publish(ctx context.Context, msg []byte) error
+	// Listen calls deliver with each published message until ctx is done.
+	// It calls subscribed whenever it starts receiving, at first and after
+	// reconnecting; messages published before may not be delivered.
+	Listen(ctx context.Context, subscribed func(), deliver func(msg []byte))
+}
+
+// MemoryBus is a Bus within one process: for a single replica, or for
+// several hubs in tests.
+type MemoryBus struct {
+	mu        sync.Mutex
+	listeners []*fifo[[]byte]
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{}
+}
+
+func (b *MemoryBus) Publish(ctx context.Context, msg []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, l := range b.listeners {
+		l.push(msg)
+	}
+	return nil
+}
+
+func (b *MemoryBus) Listen(ctx context.Context, subscribed func(), deliver func(msg []byte)) {
+	q := newFifo[[]byte](0)
+	b.mu.Lock()
+	b.listeners = append(b.listeners, q)
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, l := range b.listeners {
+			if l == q {
+				b.listeners = append(b.listeners[:i], b.listeners[i+1:]...)
+				break
+			}
+		}
+	}()
+
+	subscribed()
+	for {
+		msg, ok := q.pop(ctx)
+		if !ok {
+			return
+		}
+		deliver(msg)
+	}
+}
+
+// fifo is a queue with one consumer, holding at most limit items, or any
+// number if limit is 0. Pushing never blocks, so a producer may push while
+// holding locks the consumer needs.
+type fifo[T any] struct {
+	limit int
+	mu    sync.Mutex
+	items []T
+	// ready has a token while items is not empty.
+	ready chan struct{}
+}
+
+func newFifo[T any](limit int) *fifo[T] {
+	return &fifo[T]{limit: limit, ready: make(chan struct{}, 1)}
+}
+
+// push adds item, reporting false without adding it when the queue is
+// full.
+func (q *fifo[T]) push(item T) bool {
+	q.mu.Lock()
+	if q.limit > 0 && len(q.items) >= q.limit {
+		q.mu.Unlock()
+		return false
+	}
+	q.items = append(q.items, item)
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (q *fifo[T]) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// pop waits for the oldest item. It reports false once ctx is done.
+func (q *fifo[T]) pop(ctx context.Context) (T, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.items) > 0 {
+			item := q.items[0]
+			var zero T
+			q.items[0] = zero
+			q.items = q.items[1:]
+			if len(q.items) > 0 {
+				select {
+				case q.ready <- struct{}{}:
+				default:
+				}
+			}
+			q.mu.Unlock()
+			return item, true
+		}
+		q.mu.Unlock()
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+			var zero T
+			return zero, false
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// busChannel is the LISTEN/NOTIFY channel replicas share.
+const busChannel = "pastectl_live"
+
+// maxNotifyChunk keeps each notification under Postgres's 8000-byte
+// payload limit, with room for the chunk header.
+const maxNotifyChunk = 7900
+
+// A message too large for one notification is split into chunks sent in
+// one transaction, which Postgres delivers back to back. Every chunk is
+// headed "<message>/<index>/<count>:", naming the message by the bus and
+// a number. Postgres drops a notification that repeats one already sent in
+// the same transaction, so the header also keeps equal chunks distinct.
+
+// PGBus is a Bus over Postgres LISTEN/NOTIFY. Postgres delivers
+// notifications in commit order, which gives every replica the same order.
+type PGBus struct {
+	pool *pgxpool.Pool
+	id   string
+	seq  atomic.Uint64
+}
+
+func NewPGBus(pool *pgxpool.Pool) *PGBus {
+	return &PGBus{pool: pool, id: randomID()}
+}
+
+func (b *PGBus) Publish(ctx context.Context, msg []byte) error {
+	id := b.id + "." + strconv.FormatUint(b.seq.Add(1), 10)
+	chunks := splitChunks(id, msg, maxNotifyChunk)
+	if len(chunks) == 1 {
+		_, err := b.pool.Exec(ctx, "SELECT pg_notify($1, $2)", busChannel, chunks[0])
+		return err
+	}
+	return pgx.BeginFunc(ctx, b.pool, func(tx pgx.Tx) error {
+		for _, c := range chunks {
+			if _, err := tx.Exec(ctx, "SELECT pg_notify($1, $2)", busChannel, c); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// splitChunks cuts message id into headed chunks of at most size bytes
+// of msg, on rune boundaries since payloads must be valid text.
+func splitChunks(id string, msg []byte, size int) []string {
+	var parts []string
+	for len(msg) > size {
+		n := size
+		for n > 0 && !utf8.RuneStart(msg[n]) {
+			n--
+		}
+		parts = append(parts, string(msg[:n]))
+		msg = msg[n:]
+	}
+	parts = append(parts, string(msg))
+	for i, p := range parts {
+		parts[i] = fmt.Sprintf("%s/%d/%d:%s", id, i, len(parts), p)
+	}
+	return parts
+}
+
+// chunk is one parsed notification.
+type chunk struct {
+	id           string
+	index, count int
+	payload      string
+}
+
+func parseChunk(s string) (chunk, bool) {
+	header, payload, ok := strings.Cut(s, ":")
+	if !ok {
+		return chunk{}, false
+	}
+	fields := strings.Split(header, "/")
+	if len(fields) != 3 {
+		return chunk{}, false
+	}
+	index, err1 := strconv.Atoi(fields[1])
+	count, err2 := strconv.Atoi(fields[2])
+	if err1 != nil || err2 != nil || index < 0 || index >= count {
+		return chunk{}, false
+	}
+	return chunk{id: fields[0], index: index, count: count, payload: payload}, true
+}
+
+// assembler joins chunks back into messages.
+type assembler struct {
+	id          string
+	next, count int
+	partial     []byte
+}
+
+// add takes the next chunk and returns the message once it is whole. A
+// chunk out of place discards the message it belongs to; the hub notices
+// the missing message by its numbering.
+func (a *assembler) add(s string) ([]byte, bool) {
+	c, ok := parseChunk(s)
+	if !ok {
+		slog.Warn("malformed live-editing bus notification")
+		return nil, false
+	}
+	if c.index == 0 {
+		if a.partial != nil {
+			slog.Warn("incomplete live-editing bus message dropped", "message", a.id)
+		}
+		a.id, a.next, a.count, a.partial = c.id, 0, c.count, []byte{}
+	}
+	if a.partial == nil || c.id != a.id || c.index != a.next || c.count != a.count {
+		slog.Warn("live-editing bus chunk out of place dropped", "message", c.id, "index", c.index, "count", c.count)
+		a.partial = nil
+		return nil, false
+	}
+	a.partial = append(a.partial, c.payload...)
+	a.next++
+	if a.next < c.count {
+		return nil, false
+	}
+	msg := a.partial
+	a.partial = nil
+	return msg, true
+}
+
+// Listen holds one pool connection while listening and reconnects with
+// backoff whenever it is lost.
+func (b *PGBus) Listen(ctx context.Context, subscribed func(), deliver func(msg []byte)) {
+	backoff := time.Second
+	for {
+		err := b.listen(ctx, func() {
+			backoff = time.Second
+			subscribed()
+		}, deliver)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("live-editing bus listener disconnected", "error", err, "retry_in", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, 30*time.Second)
+	}
+}
+
+func (b *PGBus) listen(ctx context.Context, subscribed func(), deliver func(msg []byte)) error {
+	conn, err := b.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// LISTEN state must not leak back into the pool. Hijacking detaches
+	// the connection from conn, so it is used through pc from here on.
+	pc := conn.Hijack()
+	defer pc.Close(context.Background())
+	if _, err := pc.Exec(ctx, "LISTEN "+busChannel); err != nil {
+		return err
+	}
+	subscribed()
+	var chunks assembler
+	for {
+		n, err := pc.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		if msg, ok := chunks.add(n.Payload); ok {
+			deliver(msg)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package ws
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/metrics"
+	"github.com/gorilla/websocket"
+)
+
+// client is one WebSocket connection. Only its writer goroutine writes
+// data frames to conn, as gorilla/websocket requires.
+type client struct {
+	conn   *websocket.Conn
+	logger *slog.Logger
+	// send is the bounded queue of messages for the writer.
+	send chan []byte
+	// pingInterval is how often the writer pings the peer, and
+	// writeTimeout bounds each write.
+	pingInterval time.Duration
+	writeTimeout time.Duration
+	// greeted is set once the client was sent the room's state; it is sent
+	// nothing before. Guarded by the room's lock.
+	greeted bool
+	// collaborative is set once the client says hello; until then it is
+	// a legacy client. Guarded by the room's lock.
+	collaborative bool
+	// editor is set once the client may change the text. Only the read
+	// loop writes it, before handling the message that granted it.
+	editor bool
+	// participant is how the room's other members see this client once it
+	// has said hello, and joined orders it among them. Both are guarded by
+	// the room's lock, except participant.ID, which never changes.
+	participant Participant
+	joined      int
+	// contentBusy is set while a legacy client's edit is on the bus, and
+	// nextContent holds the newest text it sent meanwhile. Both are
+	// guarded by the room's lock.
+	contentBusy bool
+	nextContent *string
+
+	stopOnce sync.Once
+	// done is closed to stop the writer.
+	done chan struct{}
+	// closeMsg, if set before done is closed, is sent as a close frame by
+	// the writer on its way out.
+	closeMsg []byte
+	// stopped is closed once the writer has returned.
+	stopped chan struct{}
+}
+
+func newClient(conn *websocket.Conn, logger *slog.Logger, pingInterval, writeTimeout time.Duration, queueSize int) *client {
+	return &client{
+		conn:         conn,
+		logger:       logger,
+		pingInterval: pingInterval,
+		writeTimeout: writeTimeout,
+		participant:  Participant{ID: participantIDs.New()},
+		send:         make(chan []byte, queueSize),
+		done:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+	}
+}
+
+// queue hands msg to the writer without blocking. It reports false when
+// the queue is full.
+func (cl *client) queue(msg []byte) bool {
+	select {
+	case cl.send <- msg:
+		metrics.WSSendQueued.Inc()
+		metrics.WSSendQueueDepth.Observe(float64(len(cl.send)))
+		return true
+	default:
+		return false
+	}
+}
+
+// busy reports whether the queue is over half full.
+func (cl *client) busy() bool {
+	return 2*len(cl.send) > cap(cl.send)
+}
+
+// discard drops the messages the writer left queued. Call it once the
+// writer has returned and the client has left its room, when nothing
+// queues for it any more.
+func (cl *client) discard() {
+	for {
+		select {
+		case <-cl.send:
+			metrics.WSSendQueued.Dec()
+		default:
+			return
+		}
+	}
+}
+
+// stop tells the writer to finish. Messages still queued are discarded.
+func (cl *client) stop() {
+	cl.stopOnce.Do(func() { close(cl.done) })
+}
+
+// kick stops the writer, which then closes the connection with code and
+// reason so the client learns why.
+func (cl *client) kick(code int, reason string) {
+	cl.stopOnce.Do(func() {
+		cl.closeMsg = websocket.FormatCloseMessage(code, reason)
+		close(cl.done)
+	})
+}
+
+// writeLoop delivers queued messages and pings the peer every
+// pingInterval until stop is called or a write fails. On failure it closes
+// the connection, which also ends the read loop blocked on it.
+func (cl *client) writeLoop() {
+	defer close(cl.stopped)
+	ping := time.NewTicker(cl.pingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-cl.done:
+			if cl.closeMsg != nil {
+				cl.conn.WriteControl(websocket.CloseMessage, cl.closeMsg, time.Now().Add(cl.writeTimeout))
+				cl.conn.Close()
+			}
+			return
+		case msg := <-cl.send:
+			metrics.WSSendQueued.Dec()
+			cl.conn.SetWriteDeadline(time.Now().Add(cl.writeTimeout))
+			if err := cl.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				cl.logger.Debug("websocket write failed", "error", err)
+				cl.conn.Close()
+				return
+			}
+		case <-ping.C:
+			if err := cl.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(cl.writeTimeout)); err != nil {
+				cl.logger.Debug("websocket ping failed", "error", err)
+				cl.conn.Close()
+				return
+			}
+		}
+	}
+}
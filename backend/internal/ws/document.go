@@ -0,0 +1,104 @@
+package ws
+
+import (
+	"errors"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/ot"
+)
+
+// maxHistory is how many recent ops a document keeps, at least, for
+// transforming late ones. A client further behind has to start over from a
+// snapshot.
+const maxHistory = 1000
+
+var (
+	errStaleRevision = errors.New("revision is too old or unknown; request a new snapshot")
+	errInvalidCursor = errors.New("cursor offsets must not be negative")
+)
+
+// document is the authoritative copy of a paste being edited live. Every
+// accepted op advances its revision by one.
+type document struct {
+	text     []rune
+	language string
+	rev      int
+	// history[i] turned revision base+i into base+i+1.
+	history []ot.Op
+	base    int
+}
+
+func newDocument(content, language string) *document {
+	return &document{text: []rune(content), language: language}
+}
+
+// documentAt rebuilds a document at revision rev from its text and the ops
+// that led to it, most recent last.
+func documentAt(content, language string, rev int, history []ot.Op) *document {
+	return &document{
+		text:     []rune(content),
+		language: language,
+		rev:      rev,
+		history:  history,
+		base:     rev - len(history),
+	}
+}
+
+// since returns the ops that turned revision rev into the current one,
+// or false when rev is unknown or too old to be in the history.
+func (d *document) since(rev int) ([]ot.Op, bool) {
+	if rev < d.base || rev > d.rev {
+		return nil, false
+	}
+	return d.history[rev-d.base:], true
+}
+
+// apply transforms op, made against revision rev, past every op accepted
+// since and applies it. It returns the op as applied to the current text.
+func (d *document) apply(rev int, op ot.Op) (ot.Op, error) {
+	if rev < d.base || rev > d.rev {
+		return nil, errStaleRevision
+	}
+	for _, h := range d.history[rev-d.base:] {
+		var err error
+		if op, _, err = ot.Transform(op, h); err != nil {
+			return nil, err
+		}
+	}
+	text, err := ot.Apply(d.text, op)
+	if err != nil {
+		return nil, err
+	}
+	d.text = text
+	d.rev++
+	d.history = append(d.history, op)
+	// Trim in batches so the copy is amortised over many ops.
+	if len(d.history) >= 2*maxHistory {
+		drop := len(d.history) - maxHistory
+		d.history = append(d.history[:0:0], d.history[drop:]...)
+		d.base += drop
+	}
+	return op, nil
+}
+
+// transformSelection carries sel, made against revision rev, across every
+// op accepted since. Offsets past the end of the text are clamped to it. A
+// nil selection stays nil.
+func (d *document) transformSelection(rev int, sel *Selection) (*Selection, error) {
+	if rev < d.base || rev > d.rev {
+		return nil, errStaleRevision
+	}
+	if sel == nil {
+		return nil, nil
+	}
+	if sel.Anchor < 0 || sel.Head < 0 {
+		return nil, errInvalidCursor
+	}
+	out := *sel
+	for _, h := range d.history[rev-d.base:] {
+		out.Anchor = ot.TransformIndex(out.Anchor, h)
+		out.Head = ot.TransformIndex(out.Head, h)
+	}
+	out.Anchor = min(out.Anchor, len(d.text))
+	out.Head = min(out.Head, len(d.text))
+	return &out, nil
+}
@@ -0,0 +1,127 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrShuttingDown is returned by Follow once the hub is shutting down.
+var ErrShuttingDown = errors.New("live editing is shutting down")
+
+// Follower is a read-only member of a paste's room that is told when the
+// text changes, for consumers that do not speak the WebSocket protocol,
+// such as the events stream. Changes are coalesced: a slow follower reads
+// the latest text rather than every revision.
+type Follower struct {
+	hub *Hub
+	rm  *room
+	// changed has a token while the text changed since the last Text.
+	changed  chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Follow joins the room of pasteID as a follower, loading the paste as a
+// connection would. It fails with the paste service's errors for missing
+// and expired pastes, and with ErrRoomFull when the room is at
+// MaxRoomConnections. A follower keeps the room open, and so keeps edits
+// from other replicas arriving, until it is closed.
+func (h *Hub) Follow(ctx context.Context, pasteID string) (*Follower, error) {
+	f := &Follower{
+		hub:     h,
+		changed: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	h.mu.Lock()
+	if h.closing {
+		h.mu.Unlock()
+		return nil, ErrShuttingDown
+	}
+	if h.fullLocked(pasteID) {
+		h.mu.Unlock()
+		return nil, ErrRoomFull
+	}
+	h.active.Add(1)
+	h.startBus()
+	f.rm = h.roomLocked(pasteID)
+	f.rm.follow(f)
+	h.mu.Unlock()
+
+	if err := f.rm.load(ctx); err != nil {
+		f.Close(ctx)
+		return nil, err
+	}
+	return f, nil
+}
+
+// Changed receives when the text changed since the last call to Text.
+func (f *Follower) Changed() <-chan struct{} {
+	return f.changed
+}
+
+// Done is closed when the follower should stop: the hub is shutting down,
+// or the room lost sync with the other replicas. Following again gives the
+// current text.
+func (f *Follower) Done() <-chan struct{} {
+	return f.done
+}
+
+// Text returns the current text and language of the paste, including
+// edits not saved yet.
+func (f *Follower) Text() (content, language string) {
+	select {
+	case <-f.changed:
+	default:
+	}
+	f.rm.mu.Lock()
+	defer f.rm.mu.Unlock()
+	return string(f.rm.doc.text), f.rm.doc.language
+}
+
+// Close leaves the room; the last member to leave saves it. Call it once.
+func (f *Follower) Close(ctx context.Context) {
+	f.hub.mu.Lock()
+	left := f.rm.unfollow(f)
+	f.hub.mu.Unlock()
+	f.stop()
+	f.hub.release(ctx, f.rm, left)
+	f.hub.active.Done()
+}
+
+func (f *Follower) stop() {
+	f.stopOnce.Do(func() { close(f.done) })
+}
+
+func (rm *room) follow(f *Follower) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.followers[f] = struct{}{}
+}
+
+// unfollow drops f and returns how many members remain.
+func (rm *room) unfollow(f *Follower) int {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	delete(rm.followers, f)
+	return len(rm.clients) + len(rm.followers)
+}
+
+// notifyFollowersLocked tells every follower the text changed.
+func (rm *room) notifyFollowersLocked() {
+	for f := range rm.followers {
+		select {
+		case f.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// stopFollowers tells every follower to stop.
+func (rm *room) stopFollowers() {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	for f := range rm.followers {
+		f.stop()
+	}
+}
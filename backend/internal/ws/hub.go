@@ -0,0 +1,366 @@
+package ws
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	"github.com/Sumedhvats/pasteCTL_web/internal/metrics"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// Store loads the paste a room edits, saves the room's edits back and
+// checks the owner or edit tokens that make clients editors.
+type Store interface {
+	GetPaste(ctx context.Context, id string) (*db.Paste, error)
+	UpdatePaste(ctx context.Context, id, content, lang string) (*db.Paste, error)
+	CheckEditor(ctx context.Context, id, token string) error
+}
+
+// Defaults for the Hub fields left zero.
+const (
+	DefaultSaveInterval       = 5 * time.Second
+	DefaultPingInterval       = 30 * time.Second
+	DefaultMaxMessageSize     = 1 << 20
+	DefaultSendQueueSize      = 256
+	DefaultOutboxSize         = 1024
+	DefaultWriteTimeout       = 10 * time.Second
+	DefaultMessageRate        = 50
+	DefaultMessageBurst       = 100
+	DefaultMaxRoomConnections = 100
+)
+
+// ErrRoomFull is returned by Follow, and refuses a connection, when the
+// room is at MaxRoomConnections.
+var ErrRoomFull = errors.New("room is full")
+
+// Hub owns the live-editing rooms, one per paste, and every connection in
+// them. The hub's lock guards which rooms exist; each room's lock guards
+// its members and document. Writes to a connection only ever happen on
+// that connection's writer goroutine.
+type Hub struct {
+	// OnConnect, when set, is called for every accepted connection before
+	// its first message, e.g. to record a live-editing session.
+	OnConnect func(c *gin.Context, pasteID string)
+	// CanEdit, when set, reports whether the request that opened a
+	// connection may edit any paste, e.g. because it authenticated as a
+	// user. Other clients edit only with the paste's owner token.
+	CanEdit func(c *gin.Context) bool
+	// AllowedOrigins are the browser origins, besides the server's own,
+	// that may open connections. Requests without an Origin header do not
+	// come from a browser page and are always accepted.
+	AllowedOrigins []string
+	// SaveInterval is how long after its first unsaved edit a room writes
+	// its document back. Rooms also save when their last member leaves
+	// and on Shutdown.
+	SaveInterval time.Duration
+	// PingInterval is how often the server pings each connection. A
+	// connection that sends nothing, not even a pong, for two intervals is
+	// dropped as dead.
+	PingInterval time.Duration
+	// MaxMessageSize is the largest message in bytes a client may send;
+	// larger ones close the connection.
+	MaxMessageSize int64
+	// SendQueueSize is how many messages may wait for a connection. Once
+	// it is half full, cursor updates for the connection are dropped; once
+	// it is full, the connection is closed as too slow.
+	SendQueueSize int
+	// WriteTimeout bounds each write to a connection; a write that takes
+	// longer closes it.
+	WriteTimeout time.Duration
+	// MessageRate is how many messages a second a client may send on
+	// average, after a burst of MessageBurst; faster clients are
+	// disconnected.
+	MessageRate  int
+	MessageBurst int
+	// MaxRoomConnections caps the members of one paste's room on this
+	// replica, connections and followers alike; more are refused.
+	MaxRoomConnections int
+	// Bus, when set, joins this hub's rooms with the rooms of the same
+	// pastes on other replicas. Without one, rooms are local to this
+	// process.
+	Bus Bus
+	// SyncTimeout is how long a new room waits for another replica to send
+	// the live document before it asks again. After SyncAttempts requests
+	// go unanswered, it reads the paste instead.
+	SyncTimeout  time.Duration
+	SyncAttempts int
+	// OutboxSize is how many messages may wait to be published on the bus.
+	// A message that finds it full is dropped and its room resynced, as
+	// when publishing fails.
+	OutboxSize int
+
+	store Store
+	// replica identifies this hub on the bus.
+	replica string
+	// outbox holds messages waiting to be published; it is made by
+	// startBus, before any room publishes.
+	outbox *fifo[busMsg]
+	// dropped lists the rooms whose messages found the outbox full, for
+	// the publish loop to resync.
+	droppedMu sync.Mutex
+	dropped   []string
+	// listening is closed once the bus delivers messages.
+	listening chan struct{}
+	// seen is the last sequence number delivered from each replica. Only
+	// the bus listener uses it.
+	seen map[string]uint64
+
+	mu    sync.Mutex
+	rooms map[string]*room
+	// closing is set by Shutdown; no connection joins after it.
+	closing bool
+	// active counts running PasteHandler calls and open followers so
+	// Shutdown can wait for them. It is only incremented under mu while
+	// closing is false.
+	active sync.WaitGroup
+	// stopBus stops publishing and listening; nil until the first join.
+	stopBus context.CancelFunc
+}
+
+func NewHub(store Store) *Hub {
+	return &Hub{
+		store:     store,
+		replica:   randomID(),
+		listening: make(chan struct{}),
+		seen:      make(map[string]uint64),
+		rooms:     make(map[string]*room),
+	}
+}
+
+// randomID names replicas and room sessions.
+func randomID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (h *Hub) pingInterval() time.Duration {
+	if h.PingInterval <= 0 {
+		return DefaultPingInterval
+	}
+	return h.PingInterval
+}
+
+func (h *Hub) maxMessageSize() int64 {
+	if h.MaxMessageSize <= 0 {
+		return DefaultMaxMessageSize
+	}
+	return h.MaxMessageSize
+}
+
+func (h *Hub) outboxSize() int {
+	if h.OutboxSize <= 0 {
+		return DefaultOutboxSize
+	}
+	return h.OutboxSize
+}
+
+func (h *Hub) sendQueueSize() int {
+	if h.SendQueueSize <= 0 {
+		return DefaultSendQueueSize
+	}
+	return h.SendQueueSize
+}
+
+func (h *Hub) writeTimeout() time.Duration {
+	if h.WriteTimeout <= 0 {
+		return DefaultWriteTimeout
+	}
+	return h.WriteTimeout
+}
+
+func (h *Hub) messageRate() (rate, burst int) {
+	rate, burst = h.MessageRate, h.MessageBurst
+	if rate <= 0 {
+		rate = DefaultMessageRate
+	}
+	if burst <= 0 {
+		burst = DefaultMessageBurst
+	}
+	return rate, burst
+}
+
+// fullLocked reports whether the room of pasteID is at MaxRoomConnections.
+// The caller holds h.mu.
+func (h *Hub) fullLocked(pasteID string) bool {
+	rm := h.rooms[pasteID]
+	return rm != nil && rm.size() >= h.maxRoomConnections()
+}
+
+func (h *Hub) maxRoomConnections() int {
+	if h.MaxRoomConnections <= 0 {
+		return DefaultMaxRoomConnections
+	}
+	return h.MaxRoomConnections
+}
+
+// join adds cl to the room of pasteID, creating the room if needed. It
+// fails with ErrShuttingDown once the hub is shutting down and with
+// ErrRoomFull when the room is at MaxRoomConnections.
+func (h *Hub) join(pasteID string, cl *client) (*room, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closing {
+		return nil, ErrShuttingDown
+	}
+	if h.fullLocked(pasteID) {
+		return nil, ErrRoomFull
+	}
+	h.active.Add(1)
+	h.startBus()
+	rm := h.roomLocked(pasteID)
+	rm.add(cl)
+	metrics.WSConnections.Inc()
+	return rm, nil
+}
+
+// roomLocked returns the room of pasteID, creating it if needed. The
+// caller holds h.mu.
+func (h *Hub) roomLocked(pasteID string) *room {
+	rm, ok := h.rooms[pasteID]
+	if !ok {
+		interval := h.SaveInterval
+		if interval <= 0 {
+			interval = DefaultSaveInterval
+		}
+		rm = newRoom(h, pasteID, interval)
+		h.rooms[pasteID] = rm
+		metrics.WSRooms.Set(float64(len(h.rooms)))
+	}
+	return rm
+}
+
+// leave removes cl from its room and stops cl's writer. The last member
+// to leave saves the document before the room is freed; the room stays
+// registered meanwhile, so a client joining during the save keeps editing
+// the same document. Rooms detached by resync are freed all the same.
+func (h *Hub) leave(ctx context.Context, rm *room, cl *client) {
+	h.mu.Lock()
+	left := rm.remove(cl)
+	cl.stop()
+	metrics.WSConnections.Dec()
+	h.mu.Unlock()
+	h.release(ctx, rm, left)
+}
+
+// release frees rm once its last member, of left remaining, has gone.
+func (h *Hub) release(ctx context.Context, rm *room, left int) {
+	if left > 0 {
+		return
+	}
+
+	rm.save(ctx)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if rm.size() == 0 {
+		if h.rooms[rm.id] == rm {
+			delete(h.rooms, rm.id)
+		}
+		rm.close()
+	}
+	metrics.WSRooms.Set(float64(len(h.rooms)))
+}
+
+// Rooms returns the number of rooms with at least one member.
+func (h *Hub) Rooms() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.rooms)
+}
+
+// Connections returns the number of connections in the room of pasteID.
+func (h *Hub) Connections(pasteID string) int {
+	h.mu.Lock()
+	rm := h.rooms[pasteID]
+	h.mu.Unlock()
+	if rm == nil {
+		return 0
+	}
+	return rm.connections()
+}
+
+// Followers returns the number of followers of pasteID.
+func (h *Hub) Followers(pasteID string) int {
+	h.mu.Lock()
+	rm := h.rooms[pasteID]
+	h.mu.Unlock()
+	if rm == nil {
+		return 0
+	}
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	return len(rm.followers)
+}
+
+// Participants returns who is editing pasteID collaboratively, in the
+// order they joined. Cursors are left out: they are only meaningful
+// alongside the document revision.
+func (h *Hub) Participants(pasteID string) []Participant {
+	h.mu.Lock()
+	rm := h.rooms[pasteID]
+	h.mu.Unlock()
+	if rm == nil {
+		return []Participant{}
+	}
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	out := rm.participantsLocked()
+	for i := range out {
+		out[i].Cursor = nil
+	}
+	return out
+}
+
+// Shutdown stops accepting connections and followers, sends every open
+// connection a "service restart" close frame so clients know to reconnect,
+// stops every follower, saves every room, then waits for the handlers and
+// followers to finish or for ctx to expire. Edits that arrive after the
+// save are saved when their room empties.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	msg := websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server restarting")
+	deadline := time.Now().Add(time.Second)
+	h.mu.Lock()
+	h.closing = true
+	if h.stopBus != nil {
+		defer h.stopBus()
+	}
+	rooms := make([]*room, 0, len(h.rooms))
+	for _, rm := range h.rooms {
+		rooms = append(rooms, rm)
+	}
+	h.mu.Unlock()
+	for _, rm := range rooms {
+		for _, cl := range rm.members() {
+			// WriteControl may run alongside the writer goroutine.
+			cl.conn.WriteControl(websocket.CloseMessage, msg, deadline)
+		}
+		rm.stopFollowers()
+	}
+	var saves sync.WaitGroup
+	for _, rm := range rooms {
+		saves.Add(1)
+		go func() {
+			defer saves.Done()
+			rm.save(ctx)
+		}()
+	}
+	saves.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		h.active.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
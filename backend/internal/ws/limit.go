@@ -0,0 +1,29 @@
+package ws
+
+import "time"
+
+// rateLimiter is a token bucket: it allows burst messages at once and
+// rate messages a second after that. Only a connection's read loop uses
+// it, so it needs no lock.
+type rateLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate, burst int) *rateLimiter {
+	return &rateLimiter{rate: float64(rate), burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// allow takes a token for a message that arrived at now, reporting false
+// when none is left.
+func (l *rateLimiter) allow(now time.Time) bool {
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
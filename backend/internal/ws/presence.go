@@ -0,0 +1,155 @@
+package ws
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/metrics"
+	"github.com/Sumedhvats/pasteCTL_web/internal/ot"
+	"github.com/Sumedhvats/pasteCTL_web/pkg"
+)
+
+// maxNameLength caps display names, in characters.
+const maxNameLength = 40
+
+// palette is the colours handed out to participants who do not pick one,
+// chosen to stay distinct on the editor's dark background.
+var palette = []string{
+	"#F87171", "#FB923C", "#FACC15", "#4ADE80",
+	"#2DD4BF", "#60A5FA", "#A78BFA", "#F472B6",
+}
+
+var colorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// participantIDs names connections. The IDs are only unique within the
+// process; they identify a participant to the others in its room.
+var participantIDs = pkg.IDGenerator{Length: 8, Alphabet: pkg.DefaultAlphabet}
+
+// Participant is a collaborative client as the others in its room see it.
+type Participant struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+	// Cursor is nil until the client reports one, and when its editor
+	// loses focus.
+	Cursor *Selection `json:"cursor,omitempty"`
+}
+
+// Selection is a cursor or selected range as offsets into the document,
+// in characters. The cursor is at Head; Anchor == Head when nothing is
+// selected.
+type Selection struct {
+	Anchor int `json:"anchor"`
+	Head   int `json:"head"`
+}
+
+// displayName cleans up the name a client asked for, falling back to one
+// derived from its ID.
+func displayName(requested, id string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(requested))
+	if utf8.RuneCountInString(name) > maxNameLength {
+		name = strings.TrimSpace(string([]rune(name)[:maxNameLength]))
+	}
+	if name == "" {
+		return "Guest " + id[:4]
+	}
+	return name
+}
+
+// pickColorLocked returns the colour a client asked for if it is a valid
+// #RRGGBB value, or else the palette colour fewest members already have.
+func (rm *room) pickColorLocked(requested string) string {
+	if colorPattern.MatchString(requested) {
+		return strings.ToUpper(requested)
+	}
+	used := make([]int, len(palette))
+	for cl := range rm.clients {
+		if i := slices.Index(palette, cl.participant.Color); i >= 0 {
+			used[i]++
+		}
+	}
+	return palette[slices.Index(used, slices.Min(used))]
+}
+
+// renameLocked applies the name and colour a participant asked for in a
+// repeated hello; empty or invalid values keep the current ones. It
+// reports whether anything changed.
+func (rm *room) renameLocked(cl *client, name, color string) bool {
+	p := cl.participant
+	if name != "" {
+		p.Name = displayName(name, p.ID)
+	}
+	if colorPattern.MatchString(color) {
+		p.Color = strings.ToUpper(color)
+	}
+	if p == cl.participant {
+		return false
+	}
+	cl.participant = p
+	return true
+}
+
+// participantsLocked lists the collaborative members in the order they
+// said hello.
+func (rm *room) participantsLocked() []Participant {
+	var members []*client
+	for cl := range rm.clients {
+		if cl.collaborative {
+			members = append(members, cl)
+		}
+	}
+	slices.SortFunc(members, func(a, b *client) int { return a.joined - b.joined })
+	out := make([]Participant, len(members))
+	for i, cl := range members {
+		out[i] = cl.participant
+	}
+	return out
+}
+
+// moveCursorsLocked carries every member's cursor across op, which has
+// just been applied to the document.
+func (rm *room) moveCursorsLocked(op ot.Op) {
+	for cl := range rm.clients {
+		if sel := cl.participant.Cursor; sel != nil {
+			cl.participant.Cursor = &Selection{
+				Anchor: ot.TransformIndex(sel.Anchor, op),
+				Head:   ot.TransformIndex(sel.Head, op),
+			}
+		}
+	}
+}
+
+// broadcastCursorLocked sends the cursor update msg like a presence
+// message, except to members whose queue is busy: the next update
+// supersedes it, so a slow client misses some rather than falling further
+// behind.
+func (rm *room) broadcastCursorLocked(from *client, msg []byte) {
+	for cl := range rm.clients {
+		if cl == from || !cl.collaborative {
+			continue
+		}
+		if cl.busy() {
+			metrics.WSSlowConsumers.WithLabelValues("dropped").Inc()
+			continue
+		}
+		rm.sendLocked(cl, msg)
+	}
+}
+
+// broadcastPresenceLocked sends msg to every collaborative member except
+// from. Legacy clients would not understand presence messages.
+func (rm *room) broadcastPresenceLocked(from *client, msg []byte) {
+	for cl := range rm.clients {
+		if cl != from && cl.collaborative {
+			rm.sendLocked(cl, msg)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/ot"
+	"github.com/gorilla/websocket"
+)
+
+// Subprotocol names the version of the message protocol below. Clients
+// ask for it in the Sec-WebSocket-Protocol header; a client that offers
+// only other versions is refused before the upgrade. Clients that offer
+// none are served this version too, for compatibility.
+const Subprotocol = "pastectl.v1"
+
+// Message types. Every message is a JSON object whose "type" says which
+// of these it is.
+//
+// Every connection first receives the room's state: a "snapshot" of the
+// document, or, for a client that reconnects with the session and the
+// revision it last saw, a "catch_up" with only the ops it missed. Nothing
+// else reaches it before.
+//
+// Clients that want collaborative editing then send "hello" and receive a
+// "snapshot", or a "catch_up" when the hello names the revision they have;
+// from then on they send "op" messages against the revision they have and
+// receive "ack" for their own ops and "op" for everyone else's. Clients
+// that never say hello are treated as legacy clients and exchange
+// whole-document "content_update" messages.
+//
+// Only editors may change the text: clients whose hello carries the
+// paste's owner or edit token, connections the hub's CanEdit admits, and
+// every client of a paste created before edit tokens existed. Everyone
+// else is a viewer, told so by "read_only" in the snapshot, whose ops and
+// content updates are refused.
+//
+// Collaborative clients are also participants. Presence is carried by
+// "join" and "leave", and each participant may report its "cursor"
+// against a revision, which the server relays at the current one. A
+// repeated hello with a new name or colour is announced as another "join"
+// of the same participant ID.
+//
+// A request the server cannot carry out is answered with an "error"
+// whose code says why; the connection stays open.
+const (
+	msgHello         = "hello"
+	msgSnapshot      = "snapshot"
+	msgCatchUp       = "catch_up"
+	msgOp            = "op"
+	msgAck           = "ack"
+	msgError         = "error"
+	msgContentUpdate = "content_update"
+	msgJoin          = "join"
+	msgLeave         = "leave"
+	msgCursor        = "cursor"
+)
+
+// Error codes sent in error messages.
+const (
+	errCodeNotJoined     = "not_joined"
+	errCodeStaleRevision = "stale_revision"
+	errCodeInvalidOp     = "invalid_op"
+	errCodeInvalidCursor = "invalid_cursor"
+	errCodeUnknownType   = "unknown_type"
+	errCodeReadOnly      = "read_only"
+)
+
+// Close codes. The server closes a connection with one of these when it
+// cannot go on; the 4xxx codes mirror the HTTP status of the same cause.
+//
+//	1003 binary frames are not supported
+//	1007 a frame is not a valid message
+//	1008 the client sent messages faster than the configured rate
+//	1009 a message is larger than the configured limit
+//	1011 the paste could not be loaded
+//	1012 the server is restarting; reconnect
+//	1013 the client fell too far behind, or the room lost sync with
+//	     other replicas; reconnect
+//	4404 the paste does not exist
+//	4410 the paste has expired
+//	4429 the room has as many connections as it may
+const (
+	closePasteNotFound = 4404
+	closePasteExpired  = 4410
+	closeRoomFull      = 4429
+)
+
+// maxCloseReason keeps close reasons within the 125 bytes of a control
+// frame, after the two-byte code.
+const maxCloseReason = 120
+
+// errMalformed wraps every reason a frame is not a valid message.
+var errMalformed = errors.New("malformed message")
+
+// helloIn asks for a snapshot and, the first time, joins the room. Name
+// and Color are the participant's wishes; Token, the paste's owner or edit
+// token, makes the client an editor. A client that has the document at
+// revision Rev of Session asks for the ops since instead.
+type helloIn struct {
+	Name    string `json:"name"`
+	Color   string `json:"color"`
+	Token   string `json:"token"`
+	Rev     *int   `json:"rev"`
+	Session string `json:"session"`
+}
+
+// opIn is an edit made against revision Rev.
+type opIn struct {
+	Rev *int  `json:"rev"`
+	Op  ot.Op `json:"op"`
+}
+
+// cursorIn reports the sender's cursor as of revision Rev; a nil Cursor
+// clears it.
+type cursorIn struct {
+	Rev    *int       `json:"rev"`
+	Cursor *Selection `json:"cursor"`
+}
+
+// contentUpdateIn is a legacy client's whole new text.
+type contentUpdateIn struct {
+	Content *string `json:"content"`
+}
+
+// unknownIn is a message of a type this version does not know.
+type unknownIn struct {
+	Type string
+}
+
+// decode parses one client frame into helloIn, opIn, cursorIn,
+// contentUpdateIn or unknownIn. Frames that are not JSON objects with a
+// type, or lack a field their type requires, are errMalformed.
+func decode(data []byte) (any, error) {
+	var env struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformed, err)
+	}
+	var (
+		msg     any
+		missing bool
+		err     error
+	)
+	switch env.Type {
+	case "":
+		return nil, fmt.Errorf("%w: no type", errMalformed)
+	case msgHello:
+		var m helloIn
+		err = json.Unmarshal(data, &m)
+		msg = m
+	case msgOp:
+		var m opIn
+		err = json.Unmarshal(data, &m)
+		msg, missing = m, m.Rev == nil || m.Op == nil
+	case msgCursor:
+		var m cursorIn
+		err = json.Unmarshal(data, &m)
+		msg, missing = m, m.Rev == nil
+	case msgContentUpdate:
+		var m contentUpdateIn
+		err = json.Unmarshal(data, &m)
+		msg, missing = m, m.Content == nil
+	default:
+		return unknownIn{Type: env.Type}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformed, err)
+	}
+	if missing {
+		return nil, fmt.Errorf("%w: %s is missing a required field", errMalformed, env.Type)
+	}
+	return msg, nil
+}
+
+// snapshotMsg is the room's state: the document at revision Rev of
+// Session, the room's lifetime across replicas, which a reconnecting
+// client names to catch up. You is the recipient's own participant ID,
+// listed among Participants once it said hello; ReadOnly is set when the
+// recipient may not edit.
+type snapshotMsg struct {
+	Type         string        `json:"type"`
+	Session      string        `json:"session"`
+	Rev          int           `json:"rev"`
+	Content      string        `json:"content"`
+	Language     string        `json:"language"`
+	ReadOnly     bool          `json:"read_only"`
+	You          string        `json:"you"`
+	Participants []Participant `json:"participants"`
+}
+
+// catchUpMsg is the room's state for a client that has the document at
+// revision From: Ops turn it into revision Rev, one revision each. The
+// other fields are as in snapshotMsg.
+type catchUpMsg struct {
+	Type         string        `json:"type"`
+	Session      string        `json:"session"`
+	From         int           `json:"from"`
+	Rev          int           `json:"rev"`
+	Ops          []ot.Op       `json:"ops"`
+	Language     string        `json:"language"`
+	ReadOnly     bool          `json:"read_only"`
+	You          string        `json:"you"`
+	Participants []Participant `json:"participants"`
+}
+
+// opMsg carries an op that produced revision Rev. Acks reuse it without
+// the op.
+type opMsg struct {
+	Type string `json:"type"`
+	Rev  int    `json:"rev"`
+	Op   ot.Op  `json:"op,omitempty"`
+}
+
+type errorMsg struct {
+	Type    string `json:"type"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func newError(code, message string) errorMsg {
+	return errorMsg{Type: msgError, Code: code, Message: message}
+}
+
+type joinMsg struct {
+	Type        string      `json:"type"`
+	Participant Participant `json:"participant"`
+}
+
+type leaveMsg struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// cursorMsg relays participant ID's cursor, as of revision Rev. A nil
+// Cursor means the participant has none.
+type cursorMsg struct {
+	Type   string     `json:"type"`
+	ID     string     `json:"id"`
+	Rev    int        `json:"rev"`
+	Cursor *Selection `json:"cursor"`
+}
+
+type contentUpdateMsg struct {
+	Type    string `json:"type"`
+	Content string `json:"content"`
+}
+
+func encode(v any) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		// Every message type above marshals; this is a programming error.
+		panic(err)
+	}
+	return b
+}
+
+// errorCode classifies an error from applying an op or a cursor.
+func errorCode(err error) string {
+	switch {
+	case errors.Is(err, errStaleRevision):
+		return errCodeStaleRevision
+	case errors.Is(err, errInvalidCursor):
+		return errCodeInvalidCursor
+	default:
+		return errCodeInvalidOp
+	}
+}
+
+// closeFor is the close code and reason for a connection whose frame
+// could not be read as a message.
+func closeFor(frameType int, err error) (int, string) {
+	if frameType != websocket.TextMessage {
+		return websocket.CloseUnsupportedData, "binary frames are not supported"
+	}
+	reason := err.Error()
+	// Close reasons must fit a control frame.
+	if len(reason) > maxCloseReason {
+		reason = strings.ToValidUTF8(reason[:maxCloseReason], "")
+	}
+	return websocket.CloseInvalidFramePayloadData, reason
+}
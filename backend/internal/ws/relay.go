@@ -0,0 +1,438 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/metrics"
+	"github.com/Sumedhvats/pasteCTL_web/internal/ot"
+	"github.com/gorilla/websocket"
+)
+
+// Rooms never apply edits directly. Each edit is published on the bus and
+// applied when it comes back, by every replica with a room for the paste,
+// in the bus's order; so every copy of a room passes through the same
+// revisions. A room opening on one replica while another already has it
+// asks for that room's document instead of reading the paste, which may
+// lag behind the live edits.
+
+// Kinds of bus messages.
+const (
+	// busOp carries an edit from Client at revision Rev.
+	busOp = "op"
+	// busSync asks the replicas with a room for its document; Attempt
+	// numbers the room's requests.
+	busSync = "sync"
+	// busState answers the sync Attempt from replica To with the document
+	// at Rev of Session, saved as of revision Saved.
+	busState = "state"
+	// busSaved says the room saved its document at revision Rev.
+	busSaved = "saved"
+	// busReplace carries text saved to the paste by other means than live
+	// editing, which replaces the document.
+	busReplace = "replace"
+)
+
+// DefaultSyncTimeout is used when Hub.SyncTimeout is not set.
+const DefaultSyncTimeout = 500 * time.Millisecond
+
+// DefaultSyncAttempts is used when Hub.SyncAttempts is not set.
+const DefaultSyncAttempts = 3
+
+// syncHistory is how many recent ops a state message carries, so the new
+// room can transform edits made against slightly older revisions.
+const syncHistory = 100
+
+// publishTimeout bounds publishing one message.
+const publishTimeout = 10 * time.Second
+
+// busMsg is what replicas exchange. Origin and Seq identify a message:
+// each replica numbers its messages from 1, so a listener can drop
+// messages it has seen and notice ones it missed. Lost names the rooms of
+// the messages numbered just before this one that failed to publish, so
+// that the gap they leave costs only those rooms.
+type busMsg struct {
+	Origin string   `json:"origin"`
+	Seq    uint64   `json:"seq"`
+	Room   string   `json:"room"`
+	Kind   string   `json:"kind"`
+	Lost   []string `json:"lost,omitempty"`
+
+	Client   string  `json:"client,omitempty"`
+	To       string  `json:"to,omitempty"`
+	Rev      int     `json:"rev,omitempty"`
+	Op       ot.Op   `json:"op,omitempty"`
+	Content  string  `json:"content,omitempty"`
+	Language string  `json:"language,omitempty"`
+	History  []ot.Op `json:"history,omitempty"`
+	Saved    int     `json:"saved,omitempty"`
+	Session  string  `json:"session,omitempty"`
+	Attempt  int     `json:"attempt,omitempty"`
+}
+
+// startBus starts publishing and listening on the hub's bus the first time
+// a connection joins. The caller holds h.mu.
+func (h *Hub) startBus() {
+	if h.stopBus != nil {
+		return
+	}
+	bus := h.Bus
+	if bus == nil {
+		bus = NewMemoryBus()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	h.stopBus = cancel
+	h.outbox = newFifo[busMsg](h.outboxSize())
+	go h.publishLoop(ctx, bus)
+	go bus.Listen(ctx, h.subscribed, h.deliver)
+}
+
+// shared reports whether rooms may have copies on other replicas.
+func (h *Hub) shared() bool {
+	return h.Bus != nil
+}
+
+func (h *Hub) syncTimeout() time.Duration {
+	if h.SyncTimeout <= 0 {
+		return DefaultSyncTimeout
+	}
+	return h.SyncTimeout
+}
+
+func (h *Hub) syncAttempts() int {
+	if h.SyncAttempts <= 0 {
+		return DefaultSyncAttempts
+	}
+	return h.SyncAttempts
+}
+
+// Replace tells the rooms of pasteID on every replica that the paste was
+// saved with content and language by other means than live editing, e.g.
+// a PUT. The rooms take the text as an edit, so their members see it and
+// their next save does not overwrite it.
+func (h *Hub) Replace(pasteID, content, language string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closing {
+		return
+	}
+	h.startBus()
+	h.publish(busMsg{Kind: busReplace, Room: pasteID, Content: content, Language: language})
+}
+
+// publish queues m for the bus without blocking, so rooms may publish
+// while holding their lock. When the outbox is full, m is dropped and the
+// publish loop resyncs its room.
+func (h *Hub) publish(m busMsg) {
+	m.Origin = h.replica
+	if !h.outbox.push(m) {
+		metrics.WSBusMessages.WithLabelValues("dropped").Inc()
+		h.droppedMu.Lock()
+		h.dropped = append(h.dropped, m.Room)
+		h.droppedMu.Unlock()
+	}
+	metrics.WSBusOutboxDepth.Set(float64(h.outbox.len()))
+}
+
+// publishLoop numbers and publishes queued messages one at a time, so they
+// reach the bus in the order they were numbered.
+func (h *Hub) publishLoop(ctx context.Context, bus Bus) {
+	var seq uint64
+	var lost []string
+	for {
+		m, ok := h.outbox.pop(ctx)
+		if !ok {
+			return
+		}
+		metrics.WSBusOutboxDepth.Set(float64(h.outbox.len()))
+		// Dropped messages are numbered and lost like failed ones, so the
+		// listeners resync their rooms too.
+		h.droppedMu.Lock()
+		dropped := h.dropped
+		h.dropped = nil
+		h.droppedMu.Unlock()
+		for _, id := range dropped {
+			slog.Error("live-editing outbox full, message dropped", "paste_id", id)
+			seq++
+			lost = append(lost, id)
+			h.resync(id)
+		}
+		seq++
+		m.Seq = seq
+		m.Lost = lost
+		pctx, cancel := context.WithTimeout(ctx, publishTimeout)
+		err := bus.Publish(pctx, encode(m))
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			// The edit is lost and the listeners will see a gap, which the
+			// next message tells them is this room's; start the room
+			// afresh here too.
+			metrics.WSBusMessages.WithLabelValues("publish_failed").Inc()
+			slog.Error("publishing live-editing message failed", "paste_id", m.Room, "kind", m.Kind, "error", err)
+			lost = append(lost, m.Room)
+			h.resync(m.Room)
+			continue
+		}
+		lost = nil
+		metrics.WSBusMessages.WithLabelValues("published").Inc()
+	}
+}
+
+// subscribed lets rooms sync once the bus listens. Listening again after a
+// disconnection means messages may have been missed, so every room starts
+// afresh.
+func (h *Hub) subscribed() {
+	select {
+	case <-h.listening:
+		h.seen = make(map[string]uint64)
+		slog.Warn("live-editing bus resubscribed, resyncing rooms")
+		h.resync("")
+	default:
+		close(h.listening)
+	}
+}
+
+// deliver hands a bus message to its room after dropping duplicates. A gap
+// in an origin's numbering means this replica missed edits: if the message
+// names the rooms of the missing ones, those rooms start afresh, and
+// otherwise every room does. Only the bus listener calls deliver.
+func (h *Hub) deliver(data []byte) {
+	var m busMsg
+	if err := json.Unmarshal(data, &m); err != nil {
+		slog.Warn("malformed live-editing bus message", "error", err)
+		return
+	}
+	last, known := h.seen[m.Origin]
+	switch {
+	case known && m.Seq <= last:
+		metrics.WSBusMessages.WithLabelValues("duplicate").Inc()
+		return
+	case known && m.Seq > last+1 && m.Seq-last-1 == uint64(len(m.Lost)):
+		// The origin failed to publish them and has resynced its rooms.
+		metrics.WSBusMessages.WithLabelValues("gap").Inc()
+		if m.Origin != h.replica {
+			slog.Warn("live-editing bus messages lost, resyncing their rooms", "origin", m.Origin, "paste_ids", m.Lost)
+			for _, id := range m.Lost {
+				h.resync(id)
+			}
+		}
+	case known && m.Seq > last+1:
+		metrics.WSBusMessages.WithLabelValues("gap").Inc()
+		slog.Warn("live-editing bus messages missed, resyncing rooms", "origin", m.Origin, "expected", last+1, "got", m.Seq)
+		h.seen[m.Origin] = m.Seq
+		h.resync("")
+		return
+	}
+	h.seen[m.Origin] = m.Seq
+	metrics.WSBusMessages.WithLabelValues("delivered").Inc()
+
+	h.mu.Lock()
+	rm := h.rooms[m.Room]
+	h.mu.Unlock()
+	if rm != nil && !rm.deliver(m) {
+		// Another replica had the room after all, and the two copies
+		// have diverged: start this one afresh from that one.
+		slog.Warn("live document arrived after the room started without it, resyncing", "paste_id", m.Room)
+		h.resync(m.Room)
+	}
+}
+
+// resync detaches the room of pasteID, or every room if pasteID is empty,
+// and closes its connections and stops its followers so that clients
+// reconnect to a fresh room.
+// Detached rooms still save what they have when their last member leaves.
+func (h *Hub) resync(pasteID string) {
+	h.mu.Lock()
+	var rooms []*room
+	for id, rm := range h.rooms {
+		if pasteID == "" || id == pasteID {
+			rooms = append(rooms, rm)
+			delete(h.rooms, id)
+		}
+	}
+	metrics.WSRooms.Set(float64(len(h.rooms)))
+	h.mu.Unlock()
+	for _, rm := range rooms {
+		for _, cl := range rm.members() {
+			cl.kick(websocket.CloseTryAgainLater, "lost sync with other servers")
+		}
+		rm.stopFollowers()
+	}
+}
+
+// deliver applies a bus message to the room. It reports false when the
+// message shows that the room started a session of its own while another
+// replica had one.
+func (rm *room) deliver(m busMsg) bool {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	switch m.Kind {
+	case busOp, busReplace:
+		if rm.doc != nil {
+			rm.applyLocked(m)
+		} else if len(rm.syncMarks) > 0 {
+			// The state answering our sync will not include this edit.
+			rm.pending = append(rm.pending, m)
+		}
+	case busSync:
+		if m.Origin == rm.hub.replica {
+			if rm.doc == nil {
+				rm.syncMarks = append(rm.syncMarks, len(rm.pending))
+			}
+			return true
+		}
+		if rm.doc == nil {
+			return true
+		}
+		// Cloned: the message is encoded later, outside the lock.
+		history := slices.Clone(rm.doc.history[max(0, len(rm.doc.history)-syncHistory):])
+		rm.hub.publish(busMsg{
+			Kind:     busState,
+			Room:     rm.id,
+			To:       m.Origin,
+			Rev:      rm.doc.rev,
+			Content:  string(rm.doc.text),
+			Language: rm.doc.language,
+			History:  history,
+			Saved:    rm.savedRev,
+			Session:  rm.session,
+			Attempt:  m.Attempt,
+		})
+	case busState:
+		if m.To != rm.hub.replica {
+			return true
+		}
+		if rm.doc != nil {
+			// Later answers to our other attempts are the same session.
+			return m.Session == rm.session
+		}
+		if m.Attempt < 0 || m.Attempt >= len(rm.syncMarks) {
+			return true
+		}
+		// The state includes the edits made before the sync it answers.
+		rm.pending = rm.pending[rm.syncMarks[m.Attempt]:]
+		rm.doc = documentAt(m.Content, m.Language, m.Rev, m.History)
+		rm.session = m.Session
+		rm.savedRev = m.Saved
+		rm.applyPendingLocked()
+		close(rm.synced)
+	case busSaved:
+		if rm.doc != nil && m.Rev > rm.savedRev && m.Rev <= rm.doc.rev {
+			rm.savedRev = m.Rev
+		}
+	}
+	return true
+}
+
+// applyLocked applies an edit that came back from the bus. Only the
+// replica it came from answers its sender and saves it.
+func (rm *room) applyLocked(m busMsg) {
+	if m.Kind == busReplace {
+		rm.replaceLocked(m)
+		return
+	}
+	local := m.Origin == rm.hub.replica
+	var from *client
+	if local {
+		from = rm.clientLocked(m.Client)
+	}
+	applied, err := rm.doc.apply(m.Rev, m.Op)
+	if local {
+		result := "applied"
+		if err != nil {
+			result = "rejected"
+		}
+		metrics.WSOps.WithLabelValues(result).Inc()
+	}
+	if from != nil && !from.collaborative {
+		defer rm.nextContentLocked(from)
+	}
+	if err != nil {
+		if from != nil && from.collaborative {
+			rm.sendLocked(from, encode(newError(errorCode(err), err.Error())))
+		}
+		return
+	}
+	rm.moveCursorsLocked(applied)
+	if from != nil && from.collaborative {
+		rm.sendLocked(from, encode(opMsg{Type: msgAck, Rev: rm.doc.rev}))
+	}
+	rm.broadcastLocked(from, applied)
+	if local {
+		rm.scheduleSaveLocked()
+	}
+}
+
+// replaceLocked applies replacement text as the edit from the current
+// text, so members see it like any other edit. The text is saved already.
+func (rm *room) replaceLocked(m busMsg) {
+	op := ot.Diff(rm.doc.text, []rune(m.Content))
+	if !op.IsNoop() {
+		applied, err := rm.doc.apply(rm.doc.rev, op)
+		if err != nil {
+			slog.Error("replacing live document failed", "paste_id", rm.id, "error", err)
+			return
+		}
+		rm.moveCursorsLocked(applied)
+		rm.broadcastLocked(nil, applied)
+	}
+	if m.Language != "" && m.Language != rm.doc.language {
+		rm.doc.language = m.Language
+		rm.notifyFollowersLocked()
+	}
+	rm.savedRev = rm.doc.rev
+	rm.replacedRev = rm.doc.rev
+}
+
+// applyPendingLocked applies the edits that arrived while the document
+// was loading.
+func (rm *room) applyPendingLocked() {
+	for _, m := range rm.pending {
+		rm.applyLocked(m)
+	}
+	rm.pending = nil
+}
+
+// clientLocked finds the member with participant ID id, which may have
+// left.
+func (rm *room) clientLocked(id string) *client {
+	for cl := range rm.clients {
+		if cl.participant.ID == id {
+			return cl
+		}
+	}
+	return nil
+}
+
+// publishContentLocked publishes a legacy client's whole new text as the
+// edit from the current text. A client has one such edit on the bus at a
+// time: diffing against a text its previous edit has not reached yet would
+// apply that edit twice, so newer text waits, and only the newest is kept.
+func (rm *room) publishContentLocked(cl *client, content string) {
+	if cl.contentBusy {
+		cl.nextContent = &content
+		return
+	}
+	op := ot.Diff(rm.doc.text, []rune(content))
+	if op.IsNoop() {
+		return
+	}
+	cl.contentBusy = true
+	rm.hub.publish(busMsg{Kind: busOp, Room: rm.id, Client: cl.participant.ID, Rev: rm.doc.rev, Op: op})
+}
+
+// nextContentLocked publishes the text a legacy client sent while its
+// previous edit was on the bus.
+func (rm *room) nextContentLocked(cl *client) {
+	cl.contentBusy = false
+	if next := cl.nextContent; next != nil {
+		cl.nextContent = nil
+		rm.publishContentLocked(cl, *next)
+	}
+}
@@ -0,0 +1,321 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/metrics"
+	"github.com/Sumedhvats/pasteCTL_web/internal/ot"
+	pasteService "github.com/Sumedhvats/pasteCTL_web/internal/paste"
+	"github.com/gorilla/websocket"
+)
+
+// loadTimeout bounds reading the paste when a room opens.
+const loadTimeout = 10 * time.Second
+
+// room is the live session of one paste: its connections and the
+// document they edit. Messages are queued to members while mu is held, so
+// every member sees the room's messages in the same order.
+type room struct {
+	id           string
+	hub          *Hub
+	store        Store
+	saveInterval time.Duration
+
+	loadOnce sync.Once
+	loadErr  error
+	// synced is closed when another replica sends the document.
+	synced chan struct{}
+
+	// saveMu serialises saves so an older snapshot never overwrites a
+	// newer one.
+	saveMu sync.Mutex
+
+	mu        sync.Mutex
+	clients   map[*client]struct{}
+	followers map[*Follower]struct{}
+	doc       *document
+	// session names this lifetime of the room, shared with its copies on
+	// other replicas; revisions are only meaningful within one.
+	session string
+	// syncMarks holds, for each of the room's sync requests that came back
+	// from the bus, how many edits were pending before it. Edits after the
+	// first are kept in pending until the document arrives.
+	syncMarks []int
+	pending   []busMsg
+	// joins numbers the hellos, to list participants in arrival order.
+	joins int
+	// savedRev is the last revision written back to the paste.
+	savedRev int
+	// replacedRev is the revision that took the last text saved by other
+	// means than the room.
+	replacedRev int
+	saveTimer   *time.Timer
+	// closed is set once the hub has freed the room; it no longer
+	// schedules saves.
+	closed bool
+}
+
+func newRoom(h *Hub, id string, saveInterval time.Duration) *room {
+	return &room{
+		id:           id,
+		hub:          h,
+		store:        h.store,
+		saveInterval: saveInterval,
+		synced:       make(chan struct{}),
+		clients:      make(map[*client]struct{}),
+		followers:    make(map[*Follower]struct{}),
+	}
+}
+
+func (rm *room) add(cl *client) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.clients[cl] = struct{}{}
+}
+
+// remove drops cl, tells the other participants it left and returns how
+// many members remain.
+func (rm *room) remove(cl *client) int {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	delete(rm.clients, cl)
+	if cl.collaborative {
+		rm.broadcastPresenceLocked(cl, encode(leaveMsg{Type: msgLeave, ID: cl.participant.ID}))
+	}
+	return len(rm.clients) + len(rm.followers)
+}
+
+func (rm *room) connections() int {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	return len(rm.clients)
+}
+
+// size returns how many members, connections and followers, the room has.
+func (rm *room) size() int {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	return len(rm.clients) + len(rm.followers)
+}
+
+func (rm *room) members() []*client {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	out := make([]*client, 0, len(rm.clients))
+	for cl := range rm.clients {
+		out = append(out, cl)
+	}
+	return out
+}
+
+// load sets up the room's document the first time any member needs it;
+// later callers wait and share the result. The paste is always read, to
+// refuse missing and expired ones, but while another replica has the room
+// its document is newer and is used instead. Should that document arrive
+// only after the room gave up waiting, the room is resynced.
+func (rm *room) load(ctx context.Context) error {
+	rm.loadOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+		p, err := rm.store.GetPaste(ctx, rm.id)
+		if err != nil {
+			rm.loadErr = err
+			return
+		}
+		if rm.hub.shared() {
+			rm.sync(ctx)
+		}
+		rm.mu.Lock()
+		defer rm.mu.Unlock()
+		if rm.doc == nil {
+			rm.doc = newDocument(p.Content, p.Language)
+			rm.session = randomID()
+			rm.applyPendingLocked()
+		}
+	})
+	return rm.loadErr
+}
+
+// sync asks the other replicas for the room's document and waits for it.
+// A replica that has the room may be slow to answer, so the room asks
+// again each SyncTimeout and gives up only after SyncAttempts requests.
+func (rm *room) sync(ctx context.Context) {
+	select {
+	case <-rm.hub.listening:
+	case <-ctx.Done():
+		return
+	}
+	timer := time.NewTimer(rm.hub.syncTimeout())
+	defer timer.Stop()
+	for attempt := 0; attempt < rm.hub.syncAttempts(); attempt++ {
+		if attempt > 0 {
+			timer.Reset(rm.hub.syncTimeout())
+		}
+		rm.hub.publish(busMsg{Kind: busSync, Room: rm.id, Attempt: attempt})
+		select {
+		case <-rm.synced:
+			return
+		case <-timer.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// loadCloseCode picks the close code for a connection whose paste could
+// not be loaded.
+func loadCloseCode(err error) (int, string) {
+	switch {
+	case errors.Is(err, pasteService.ErrPasteNotFound):
+		return closePasteNotFound, "paste not found"
+	case errors.Is(err, pasteService.ErrPasteExpired):
+		return closePasteExpired, "paste has expired"
+	default:
+		return websocket.CloseInternalServerErr, "could not load paste"
+	}
+}
+
+// handle processes one decoded message from cl.
+func (rm *room) handle(cl *client, msg any) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	switch msg := msg.(type) {
+	case helloIn:
+		// A client says hello again to resynchronise. It joins only once,
+		// but is announced again if it changed its name or colour.
+		var announce bool
+		if !cl.collaborative {
+			cl.collaborative = true
+			cl.joined = rm.joins
+			rm.joins++
+			cl.participant.Name = displayName(msg.Name, cl.participant.ID)
+			cl.participant.Color = rm.pickColorLocked(msg.Color)
+			announce = true
+		} else {
+			announce = rm.renameLocked(cl, msg.Name, msg.Color)
+		}
+		rm.sendLocked(cl, encode(rm.stateLocked(cl, msg.Session, msg.Rev)))
+		if announce {
+			rm.broadcastPresenceLocked(cl, encode(joinMsg{Type: msgJoin, Participant: cl.participant}))
+		}
+	case opIn:
+		if !cl.collaborative {
+			rm.sendLocked(cl, encode(newError(errCodeNotJoined, "op needs a hello first")))
+			return
+		}
+		if !cl.editor {
+			rm.sendLocked(cl, encode(newError(errCodeReadOnly, "viewers cannot edit")))
+			return
+		}
+		// The edit is applied, and acknowledged, when it comes back from
+		// the bus.
+		rm.hub.publish(busMsg{Kind: busOp, Room: rm.id, Client: cl.participant.ID, Rev: *msg.Rev, Op: msg.Op})
+	case contentUpdateIn:
+		if !cl.editor {
+			rm.sendLocked(cl, encode(newError(errCodeReadOnly, "viewers cannot edit")))
+			return
+		}
+		// Legacy clients send the whole text; turn it into the edit from
+		// the current text so collaborative clients can merge it.
+		rm.publishContentLocked(cl, *msg.Content)
+	case cursorIn:
+		if !cl.collaborative {
+			rm.sendLocked(cl, encode(newError(errCodeNotJoined, "cursor needs a hello first")))
+			return
+		}
+		sel, err := rm.doc.transformSelection(*msg.Rev, msg.Cursor)
+		if err != nil {
+			rm.sendLocked(cl, encode(newError(errorCode(err), err.Error())))
+			return
+		}
+		cl.participant.Cursor = sel
+		rm.broadcastCursorLocked(cl, encode(cursorMsg{Type: msgCursor, ID: cl.participant.ID, Rev: rm.doc.rev, Cursor: sel}))
+	case unknownIn:
+		rm.sendLocked(cl, encode(newError(errCodeUnknownType, "unknown message type "+msg.Type)))
+	}
+}
+
+// greet sends cl the room's state as its first message; see stateLocked.
+func (rm *room) greet(cl *client, session string, since *int) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	cl.greeted = true
+	rm.sendLocked(cl, encode(rm.stateLocked(cl, session, since)))
+}
+
+// stateLocked is the room's state for cl: the ops since revision since,
+// when cl saw that revision in this session of the room and it is still
+// in the history, or else a snapshot.
+func (rm *room) stateLocked(to *client, session string, since *int) any {
+	if since != nil && session == rm.session {
+		if ops, ok := rm.doc.since(*since); ok {
+			return catchUpMsg{
+				Type:         msgCatchUp,
+				Session:      rm.session,
+				From:         *since,
+				Rev:          rm.doc.rev,
+				Ops:          ops,
+				Language:     rm.doc.language,
+				ReadOnly:     !to.editor,
+				You:          to.participant.ID,
+				Participants: rm.participantsLocked(),
+			}
+		}
+	}
+	return rm.snapshotLocked(to)
+}
+
+func (rm *room) snapshotLocked(to *client) snapshotMsg {
+	return snapshotMsg{
+		Type:         msgSnapshot,
+		Session:      rm.session,
+		Rev:          rm.doc.rev,
+		Content:      string(rm.doc.text),
+		Language:     rm.doc.language,
+		ReadOnly:     !to.editor,
+		You:          to.participant.ID,
+		Participants: rm.participantsLocked(),
+	}
+}
+
+// broadcastLocked sends op, which produced the current revision, to every
+// member except from, which is nil for edits made on other replicas: as an
+// op to collaborative clients and as the whole new text to legacy ones.
+// Clients not yet greeted are skipped: their state will include op.
+// Followers are told the text changed.
+func (rm *room) broadcastLocked(from *client, op ot.Op) {
+	var opFrame, contentFrame []byte
+	recipients := 0
+	for cl := range rm.clients {
+		if cl == from || !cl.greeted {
+			continue
+		}
+		recipients++
+		if cl.collaborative {
+			if opFrame == nil {
+				opFrame = encode(opMsg{Type: msgOp, Rev: rm.doc.rev, Op: op})
+			}
+			rm.sendLocked(cl, opFrame)
+		} else {
+			if contentFrame == nil {
+				contentFrame = encode(contentUpdateMsg{Type: msgContentUpdate, Content: string(rm.doc.text)})
+			}
+			rm.sendLocked(cl, contentFrame)
+		}
+	}
+	metrics.WSBroadcastFanout.Observe(float64(recipients))
+	rm.notifyFollowersLocked()
+}
+
+// sendLocked queues msg for cl. A client whose queue is full is too slow
+// to keep up and is disconnected rather than allowed to hold up the room.
+func (rm *room) sendLocked(cl *client, msg []byte) {
+	if !cl.queue(msg) {
+		metrics.WSSlowConsumers.WithLabelValues("disconnected").Inc()
+		cl.logger.Warn("websocket client too slow, disconnecting")
+		cl.kick(websocket.CloseTryAgainLater, "too slow")
+	}
+}
@@ -0,0 +1,86 @@
+package ws
+
+import (
+	"context"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/logging"
+	"github.com/Sumedhvats/pasteCTL_web/internal/metrics"
+)
+
+// saveTimeout bounds writing a room's document back to its paste.
+const saveTimeout = 10 * time.Second
+
+// scheduleSaveLocked arranges for the document to be saved saveInterval
+// after its first unsaved edit. Later edits ride along with that save.
+func (rm *room) scheduleSaveLocked() {
+	if rm.saveTimer != nil || rm.closed {
+		return
+	}
+	rm.saveTimer = time.AfterFunc(rm.saveInterval, func() {
+		rm.save(context.Background())
+	})
+}
+
+// save writes the document back to the paste if it changed since the last
+// save; every save records a revision. A failed save is logged and, while
+// the room is open, retried after another interval.
+func (rm *room) save(ctx context.Context) {
+	rm.saveMu.Lock()
+	defer rm.saveMu.Unlock()
+
+	rm.mu.Lock()
+	if rm.saveTimer != nil {
+		rm.saveTimer.Stop()
+		rm.saveTimer = nil
+	}
+	if rm.doc == nil || rm.doc.rev == rm.savedRev {
+		rm.mu.Unlock()
+		return
+	}
+	rev, content, language := rm.doc.rev, string(rm.doc.text), rm.doc.language
+	rm.mu.Unlock()
+
+	logger := logging.FromContext(ctx).With("paste_id", rm.id, "rev", rev)
+	// A paste cannot be saved empty, so an emptied document stays unsaved
+	// until someone types again.
+	if content == "" {
+		logger.Debug("not saving empty live document")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), saveTimeout)
+	defer cancel()
+	_, err := rm.store.UpdatePaste(ctx, rm.id, content, language)
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if err != nil {
+		metrics.WSSaves.WithLabelValues("failed").Inc()
+		logger.Error("saving live document failed", "error", err)
+		rm.scheduleSaveLocked()
+		return
+	}
+	metrics.WSSaves.WithLabelValues("saved").Inc()
+	if rm.replacedRev > rev {
+		// The paste was saved by other means while this write was in
+		// flight and may have been overwritten; write the document again.
+		rm.savedRev = rev
+		rm.scheduleSaveLocked()
+		return
+	}
+	rm.savedRev = rev
+	if rm.hub.shared() {
+		rm.hub.publish(busMsg{Kind: busSaved, Room: rm.id, Rev: rev})
+	}
+}
+
+// close stops the room's pending save once the hub has freed it.
+func (rm *room) close() {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.closed = true
+	if rm.saveTimer != nil {
+		rm.saveTimer.Stop()
+		rm.saveTimer = nil
+	}
+}
@@ -1,41 +1,173 @@
 package ws
 
 import (
-	"fmt"
+	"errors"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Sumedhvats/pasteCTL_web/internal/logging"
+	"github.com/Sumedhvats/pasteCTL_web/internal/metrics"
+	pasteService "github.com/Sumedhvats/pasteCTL_web/internal/paste"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
-var clients = make(map[string][]*websocket.Conn)
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
+// checkOrigin admits requests from the server's own origin and from
+// AllowedOrigins, where "*" admits any, so that other sites cannot drive a
+// visitor's browser into a room.
+func (h *Hub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
 		return true
-	},
+	}
+	if slices.ContainsFunc(h.AllowedOrigins, func(o string) bool { return o == "*" || strings.EqualFold(o, origin) }) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
 }
 
-func PasteHandler(c *gin.Context) {
+// PasteHandler upgrades the request and joins the connection to the live
+// session of the paste. See the message types in protocol.go.
+func (h *Hub) PasteHandler(c *gin.Context) {
 	pasteID := c.Param("id")
+	logger := logging.FromContext(c.Request.Context()).With("paste_id", pasteID)
+	if offered := websocket.Subprotocols(c.Request); len(offered) > 0 && !slices.Contains(offered, Subprotocol) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":     "unsupported protocol version",
+			"supported": []string{Subprotocol},
+		})
+		return
+	}
+	upgrader := websocket.Upgrader{
+		CheckOrigin:  h.checkOrigin,
+		Subprotocols: []string{Subprotocol},
+	}
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		fmt.Println("Upgrade Error:", err)
+		// Upgrade has already written an HTTP error to the client.
+		logger.Warn("websocket upgrade failed", "error", err, "origin", c.GetHeader("Origin"))
 		return
 	}
 	defer conn.Close()
-	clients[pasteID] = append(clients[pasteID], conn)
+
+	// Pongs and messages prove the peer is alive; one that goes quiet for
+	// two ping intervals, e.g. behind a NAT that dropped it, times out.
+	ping := h.pingInterval()
+	conn.SetReadLimit(h.maxMessageSize())
+	conn.SetReadDeadline(time.Now().Add(2 * ping))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * ping))
+	})
+
+	cl := newClient(conn, logger, ping, h.writeTimeout(), h.sendQueueSize())
+	cl.editor = h.CanEdit != nil && h.CanEdit(c)
+	rm, err := h.join(pasteID, cl)
+	if err != nil {
+		msg := websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server restarting")
+		if errors.Is(err, ErrRoomFull) {
+			metrics.WSRefused.WithLabelValues("room_full").Inc()
+			logger.Info("websocket refused, room is full")
+			msg = websocket.FormatCloseMessage(closeRoomFull, err.Error())
+		}
+		conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		return
+	}
+	defer h.active.Done()
+	go cl.writeLoop()
+	defer func() {
+		h.leave(c.Request.Context(), rm, cl)
+		<-cl.stopped
+		cl.discard()
+	}()
+
+	if err := rm.load(c.Request.Context()); err != nil {
+		code, reason := loadCloseCode(err)
+		if code == websocket.CloseInternalServerErr {
+			logger.Error("loading paste for live editing failed", "error", err)
+		}
+		cl.kick(code, reason)
+		return
+	}
+	if !cl.editor {
+		// Pastes created before edit tokens existed need none, so even
+		// clients that never say hello may edit them.
+		cl.editor = h.store.CheckEditor(c.Request.Context(), pasteID, "") == nil
+	}
+	// A client reconnecting names the session and revision it last saw,
+	// as in /api/ws/:id?session=...&since=12, to be sent only what it
+	// missed.
+	var since *int
+	if rev, err := strconv.Atoi(c.Query("since")); err == nil {
+		since = &rev
+	}
+	rm.greet(cl, c.Query("session"), since)
+
+	limit := newRateLimiter(h.messageRate())
+	connectedAt := time.Now()
+	logger.Info("websocket connected", "remote_addr", conn.RemoteAddr().String())
+	if h.OnConnect != nil {
+		h.OnConnect(c, pasteID)
+	}
 
 	for {
-		_, message, err := conn.ReadMessage()
+		frameType, data, err := conn.ReadMessage()
 		if err != nil {
-			fmt.Println("Read error", err)
+			logDisconnect(logger, err, time.Since(connectedAt))
 			return
 		}
-		for _, cliend := range clients[pasteID] {
-			if err := cliend.WriteMessage(websocket.TextMessage, message); err != nil {
-				fmt.Println("Message sent error", err)
-
+		now := time.Now()
+		conn.SetReadDeadline(now.Add(2 * ping))
+		if !limit.allow(now) {
+			metrics.WSRefused.WithLabelValues("rate_limited").Inc()
+			logger.Info("websocket closed for sending too fast")
+			cl.kick(websocket.ClosePolicyViolation, "too many messages")
+			return
+		}
+		var msg any
+		if frameType == websocket.TextMessage {
+			msg, err = decode(data)
+		}
+		if msg == nil {
+			code, reason := closeFor(frameType, err)
+			logger.Info("websocket closed for a malformed frame", "code", code, "reason", reason)
+			cl.kick(code, reason)
+			return
+		}
+		if hello, ok := msg.(helloIn); ok && hello.Token != "" && !cl.editor {
+			// A wrong token is not an error: the client joins as a viewer
+			// and its snapshot says so.
+			err := h.store.CheckEditor(c.Request.Context(), pasteID, hello.Token)
+			if err != nil && !errors.Is(err, pasteService.ErrNotEditor) {
+				logger.Warn("checking edit token failed", "error", err)
 			}
+			cl.editor = err == nil
 		}
+		rm.handle(cl, msg)
+	}
+}
+
+// logDisconnect logs a finished session. Closes a browser sends when a tab
+// goes away are routine; anything else is worth a warning.
+func logDisconnect(logger *slog.Logger, err error, d time.Duration) {
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		logger.Info("websocket heartbeat timed out", "duration", d)
+		return
+	}
+	if errors.Is(err, websocket.ErrReadLimit) {
+		logger.Info("websocket closed for an oversized message", "duration", d)
+		return
+	}
+	if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+		logger.Warn("websocket closed unexpectedly", "error", err, "duration", d)
+		return
 	}
+	logger.Info("websocket disconnected", "reason", err.Error(), "duration", d)
 }
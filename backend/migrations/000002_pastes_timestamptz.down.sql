@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS pastes_expire_at_idx;
+ALTER TABLE pastes
+	ALTER COLUMN created_at TYPE TIMESTAMP,
+	ALTER COLUMN expire_at TYPE TIMESTAMP;
@@ -0,0 +1,7 @@
+-- 000001 created the timestamps without a time zone while the test schema
+-- used TIMESTAMPTZ. Existing values are interpreted in the session time zone,
+-- which is what NOW() wrote them in.
+ALTER TABLE pastes
+	ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+	ALTER COLUMN expire_at TYPE TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS pastes_expire_at_idx ON pastes(expire_at) WHERE expire_at IS NOT NULL;
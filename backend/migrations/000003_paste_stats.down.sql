@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS paste_referrers;
+DROP TABLE IF EXISTS paste_viewers;
+DROP TABLE IF EXISTS paste_stats_hourly;
+DROP TABLE IF EXISTS paste_events;
+ALTER TABLE pastes DROP COLUMN IF EXISTS owner_token_hash;
@@ -0,0 +1,36 @@
+-- Pastes created before this migration have no owner and so no stats access.
+ALTER TABLE pastes ADD COLUMN IF NOT EXISTS owner_token_hash TEXT;
+
+-- Raw analytics events, written in batches and folded into the rollup tables
+-- below by the scheduled rollup job.
+CREATE TABLE IF NOT EXISTS paste_events(
+	id BIGSERIAL PRIMARY KEY,
+	paste_id TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	visitor TEXT NOT NULL DEFAULT '',
+	referrer TEXT NOT NULL DEFAULT '',
+	occurred_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS paste_events_occurred_at_idx ON paste_events(occurred_at);
+
+CREATE TABLE IF NOT EXISTS paste_stats_hourly(
+	paste_id TEXT NOT NULL REFERENCES pastes(id) ON DELETE CASCADE,
+	hour TIMESTAMPTZ NOT NULL,
+	kind TEXT NOT NULL,
+	count BIGINT NOT NULL,
+	PRIMARY KEY (paste_id, hour, kind)
+);
+
+CREATE TABLE IF NOT EXISTS paste_viewers(
+	paste_id TEXT NOT NULL REFERENCES pastes(id) ON DELETE CASCADE,
+	visitor TEXT NOT NULL,
+	first_seen TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (paste_id, visitor)
+);
+
+CREATE TABLE IF NOT EXISTS paste_referrers(
+	paste_id TEXT NOT NULL REFERENCES pastes(id) ON DELETE CASCADE,
+	domain TEXT NOT NULL,
+	count BIGINT NOT NULL,
+	PRIMARY KEY (paste_id, domain)
+);
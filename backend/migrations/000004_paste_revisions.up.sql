@@ -0,0 +1,10 @@
+-- Every save of a paste's content, newest last. Only the latest revisions
+-- of each paste are kept; older ones are pruned as new ones are written.
+CREATE TABLE IF NOT EXISTS paste_revisions(
+	id BIGSERIAL PRIMARY KEY,
+	paste_id TEXT NOT NULL REFERENCES pastes(id) ON DELETE CASCADE,
+	content TEXT NOT NULL,
+	language TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS paste_revisions_paste_id_idx ON paste_revisions(paste_id, id);
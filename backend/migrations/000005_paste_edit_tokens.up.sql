@@ -0,0 +1,4 @@
+-- Editors prove themselves with the owner token or with this separate edit
+-- token, which owners can share without giving away the stats. Pastes
+-- created before this migration have no edit token.
+ALTER TABLE pastes ADD COLUMN IF NOT EXISTS edit_token_hash TEXT;
@@ -0,0 +1,17 @@
+// Package migrations embeds the SQL schema files so the binary can apply
+// them without the source tree on disk. Files are named
+// NNNNNN_description.up.sql / .down.sql; the numeric prefix is the version.
+package migrations
+
+import "embed"
+
+// Postgres holds the schema for the default Postgres storage backend.
+//
+//go:embed *.sql
+var Postgres embed.FS
+
+// SQLite holds the schema for the SQLite storage backend. Timestamps are
+// stored as Unix microseconds so expiry checks are plain integer compares.
+//
+//go:embed sqlite/*.sql
+var SQLite embed.FS
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS pastes(
+	id TEXT PRIMARY KEY,
+	content TEXT NOT NULL,
+	language TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	expire_at INTEGER,
+	views INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS pastes_expire_at_idx ON pastes(expire_at) WHERE expire_at IS NOT NULL;
@@ -0,0 +1,33 @@
+ALTER TABLE pastes ADD COLUMN owner_token_hash TEXT;
+
+CREATE TABLE IF NOT EXISTS paste_events(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	paste_id TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	visitor TEXT NOT NULL DEFAULT '',
+	referrer TEXT NOT NULL DEFAULT '',
+	occurred_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS paste_events_occurred_at_idx ON paste_events(occurred_at);
+
+CREATE TABLE IF NOT EXISTS paste_stats_hourly(
+	paste_id TEXT NOT NULL REFERENCES pastes(id) ON DELETE CASCADE,
+	hour INTEGER NOT NULL,
+	kind TEXT NOT NULL,
+	count INTEGER NOT NULL,
+	PRIMARY KEY (paste_id, hour, kind)
+);
+
+CREATE TABLE IF NOT EXISTS paste_viewers(
+	paste_id TEXT NOT NULL REFERENCES pastes(id) ON DELETE CASCADE,
+	visitor TEXT NOT NULL,
+	first_seen INTEGER NOT NULL,
+	PRIMARY KEY (paste_id, visitor)
+);
+
+CREATE TABLE IF NOT EXISTS paste_referrers(
+	paste_id TEXT NOT NULL REFERENCES pastes(id) ON DELETE CASCADE,
+	domain TEXT NOT NULL,
+	count INTEGER NOT NULL,
+	PRIMARY KEY (paste_id, domain)
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS paste_revisions(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	paste_id TEXT NOT NULL REFERENCES pastes(id) ON DELETE CASCADE,
+	content TEXT NOT NULL,
+	language TEXT NOT NULL,
+	created_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS paste_revisions_paste_id_idx ON paste_revisions(paste_id, id);
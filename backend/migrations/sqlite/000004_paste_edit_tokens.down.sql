@@ -0,0 +1 @@
+ALTER TABLE pastes DROP COLUMN edit_token_hash;
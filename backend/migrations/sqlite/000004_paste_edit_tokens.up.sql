@@ -0,0 +1 @@
+ALTER TABLE pastes ADD COLUMN edit_token_hash TEXT;
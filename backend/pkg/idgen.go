@@ -1,11 +1,44 @@
 package pkg
-import "math/rand"
-const characters="abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
-func GenerateId(n int)string{
-	b:=make([]byte, n)
-	for i :=range b{
-		b[i]=characters[rand.Intn(len(characters))]
+import (
+	"crypto/rand"
+	"strings"
+)
+
+// DefaultAlphabet is the character set paste IDs are drawn from.
+const DefaultAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// IDGenerator draws random IDs of Length characters from Alphabet using
+// crypto/rand, so IDs cannot be predicted from earlier ones.
+type IDGenerator struct {
+	Length   int
+	Alphabet string
+}
+
+// New returns a fresh ID. Every character of the alphabet is equally
+// likely: random bytes that would bias the choice are discarded.
+func (g IDGenerator) New() string {
+	n := len(g.Alphabet)
+	limit := 256 - 256%n
+	var sb strings.Builder
+	sb.Grow(g.Length)
+	buf := make([]byte, g.Length+g.Length/2)
+	for sb.Len() < g.Length {
+		rand.Read(buf)
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+			sb.WriteByte(g.Alphabet[int(b)%n])
+			if sb.Len() == g.Length {
+				break
+			}
+		}
 	}
-	return string(b)
-}
\ No newline at end of file
+	return sb.String()
+}
+
+// GenerateId returns a random n-character ID from DefaultAlphabet.
+func GenerateId(n int) string {
+	return IDGenerator{Length: n, Alphabet: DefaultAlphabet}.New()
+}
@@ -0,0 +1,68 @@
+package analytics_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/analytics"
+	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStore struct {
+	batches [][]db.Event
+	err     error
+}
+
+func (s *fakeStore) RecordEvents(ctx context.Context, events []db.Event) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.batches = append(s.batches, events)
+	return nil
+}
+
+func TestRecorder_FlushesOneBatch(t *testing.T) {
+	store := &fakeStore{}
+	rec := analytics.NewRecorder(store, 0)
+	rec.Record("p", db.EventView, "a", "example.com")
+	rec.Record("p", db.EventRaw, "a", "")
+
+	require.NoError(t, rec.Flush(context.Background()))
+	require.Len(t, store.batches, 1)
+	assert.Len(t, store.batches[0], 2)
+	assert.Equal(t, db.EventView, store.batches[0][0].Kind)
+	assert.False(t, store.batches[0][0].At.IsZero())
+
+	require.NoError(t, rec.Flush(context.Background()))
+	assert.Len(t, store.batches, 1, "empty flushes do not write")
+}
+
+func TestRecorder_BoundedBufferAndRetry(t *testing.T) {
+	store := &fakeStore{err: errors.New("database down")}
+	rec := analytics.NewRecorder(store, 3)
+	for i := 0; i < 5; i++ {
+		rec.Record("p", db.EventView, "", "")
+	}
+	require.Error(t, rec.Flush(context.Background()))
+
+	store.err = nil
+	require.NoError(t, rec.Flush(context.Background()))
+	require.Len(t, store.batches, 1)
+	assert.Len(t, store.batches[0], 3, "events beyond the cap are dropped, failed ones retried")
+}
+
+func TestReferrerDomain(t *testing.T) {
+	cases := map[string]string{
+		"":                                  "",
+		"https://www.Example.com/some/page": "example.com",
+		"http://news.ycombinator.com:8080/": "news.ycombinator.com",
+		"not a url":                         "",
+		"/relative/path":                    "",
+	}
+	for in, want := range cases {
+		assert.Equal(t, want, analytics.ReferrerDomain(in), in)
+	}
+}
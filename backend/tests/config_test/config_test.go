@@ -0,0 +1,129 @@
+package configtest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pastectl.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(body), 0o600))
+	return path
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeConfig(t, `
+server:
+  addr: ":9000"
+  cors:
+    allow_origins: ["https://paste.example.com"]
+storage:
+  driver: memory
+scheduler:
+  interval: 30m
+paste:
+  expiries:
+    1h: 1h
+    30d: 30d
+`)
+	t.Setenv("FRONTEND_URL", "")
+
+	cfg, _, err := config.Load("test", []string{"-config", path})
+	require.NoError(t, err)
+	assert.Equal(t, ":9000", cfg.Server.Addr)
+	assert.Equal(t, []string{"https://paste.example.com"}, cfg.Server.CORS.AllowOrigins)
+	assert.Equal(t, 30*time.Minute, time.Duration(cfg.Scheduler.Interval))
+	assert.Equal(t, 30*24*time.Hour, time.Duration(cfg.Paste.Expiries["30d"]))
+	assert.Equal(t, "memory", cfg.Live.PubSub, "live.pubsub follows the storage driver")
+
+	// Environment overrides the file.
+	t.Setenv("LISTEN_ADDR", ":9001")
+	t.Setenv("CLEANUP_INTERVAL", "1h")
+	cfg, _, err = config.Load("test", []string{"-config", path})
+	require.NoError(t, err)
+	assert.Equal(t, ":9001", cfg.Server.Addr)
+	assert.Equal(t, time.Hour, time.Duration(cfg.Scheduler.Interval))
+
+	// Flags override the environment.
+	cfg, rest, err := config.Load("test", []string{"-config", path, "-addr", ":9002", "status"})
+	require.NoError(t, err)
+	assert.Equal(t, ":9002", cfg.Server.Addr)
+	assert.Equal(t, []string{"status"}, rest)
+}
+
+func TestLoad_FrontendURLAddsOrigin(t *testing.T) {
+	t.Setenv("STORAGE_DRIVER", "memory")
+	t.Setenv("FRONTEND_URL", "http://localhost:3000")
+
+	cfg, _, err := config.Load("test", nil)
+	require.NoError(t, err)
+	assert.Contains(t, cfg.Server.CORS.AllowOrigins, "http://localhost:3000")
+	assert.Contains(t, cfg.Server.CORS.AllowOrigins, "https://paste.sumedh.app")
+}
+
+func TestLoad_ValidationErrors(t *testing.T) {
+	t.Setenv("DATABASE_URL", "")
+	t.Setenv("FRONTEND_URL", "")
+
+	_, _, err := config.Load("test", []string{"-cors-origins", "paste.example.com", "-cleanup-interval", "0s"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "database.url")
+	assert.Contains(t, err.Error(), `"paste.example.com" is not an http(s) origin`)
+	assert.Contains(t, err.Error(), "scheduler.interval: must be positive")
+
+	_, _, err = config.Load("test", []string{"-storage", "mongo"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "storage.driver")
+
+	_, _, err = config.Load("test", []string{"-storage", "memory", "-cleanup-interval", "soon"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "scheduler.interval (from -cleanup-interval)")
+
+	_, _, err = config.Load("test", []string{"-storage", "memory", "-id-length", "2", "-id-alphabet", "aab/"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "paste.id_length")
+	assert.Contains(t, err.Error(), "paste.id_alphabet")
+
+	_, _, err = config.Load("test", []string{"-storage", "memory", "-live-ping-interval", "0s", "-live-max-message-kb", "-1"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "live.ping_interval: must be positive")
+	assert.Contains(t, err.Error(), "live.max_message_kb: must be positive")
+
+	_, _, err = config.Load("test", []string{"-storage", "memory", "-live-send-queue", "0", "-live-message-rate", "0", "-live-max-room-connections", "-1", "-live-outbox-size", "0"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "live.send_queue: must be positive")
+	assert.Contains(t, err.Error(), "live.message_rate: must be positive")
+	assert.Contains(t, err.Error(), "live.max_room_connections: must be positive")
+	assert.Contains(t, err.Error(), "live.outbox_size: must be positive")
+
+	_, _, err = config.Load("test", []string{"-storage", "sqlite", "-live-pubsub", "postgres"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "live.pubsub: postgres needs the postgres driver")
+
+	t.Setenv("API_TOKENS", "alice:short")
+	_, _, err = config.Load("test", []string{"-storage", "memory"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "auth.tokens.alice: must be at least 16 characters")
+
+	path := writeConfig(t, "server:\n  port: 8080\n")
+	_, _, err = config.Load("test", []string{"-config", path})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "port")
+}
+
+func TestLoad_APITokens(t *testing.T) {
+	t.Setenv("STORAGE_DRIVER", "memory")
+	t.Setenv("API_TOKENS", "alice:0123456789abcdef, bob:fedcba9876543210")
+
+	cfg, _, err := config.Load("test", nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"alice": "0123456789abcdef", "bob": "fedcba9876543210"}, cfg.Auth.Tokens)
+	assert.Equal(t, 8, cfg.Paste.IDLength)
+}
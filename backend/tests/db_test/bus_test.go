@@ -0,0 +1,88 @@
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/ws"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPGBus_SharedOrderAndLargeMessages(t *testing.T) {
+	testBusSharedOrder(t, setupTestDB(t))
+}
+
+// TestBusOverFakePostgres runs the bus over the fake server, so that its
+// listener is exercised without Docker.
+func TestBusOverFakePostgres(t *testing.T) {
+	testBusSharedOrder(t, newFakePG(t))
+}
+
+// testBusSharedOrder checks that replicas on one database see every
+// message whole and in one order.
+func testBusSharedOrder(t *testing.T, pool *pgxpool.Pool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	// Two replicas, each listening on its own bus over the shared database.
+	type replica struct {
+		bus *ws.PGBus
+		mu  sync.Mutex
+		got []string
+	}
+	replicas := []*replica{{bus: ws.NewPGBus(pool)}, {bus: ws.NewPGBus(pool)}}
+	var ready sync.WaitGroup
+	for _, r := range replicas {
+		ready.Add(1)
+		var once sync.Once
+		go r.bus.Listen(ctx, func() { once.Do(ready.Done) }, func(msg []byte) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.got = append(r.got, string(msg))
+		})
+	}
+	ready.Wait()
+
+	// Messages from both replicas at once, some far over the 8000-byte
+	// notification limit, full of multi-byte runes and repeating, so
+	// that their middle chunks are alike.
+	var sent sync.WaitGroup
+	for i, r := range replicas {
+		sent.Add(1)
+		go func() {
+			defer sent.Done()
+			for j := 0; j < 20; j++ {
+				msg := fmt.Sprintf("%d-%d ", i, j)
+				if j%5 == 0 {
+					msg += strings.Repeat("ü€", 5000)
+				}
+				assert.NoError(t, r.bus.Publish(ctx, []byte(msg)))
+			}
+		}()
+	}
+	sent.Wait()
+
+	require.Eventually(t, func() bool {
+		for _, r := range replicas {
+			r.mu.Lock()
+			n := len(r.got)
+			r.mu.Unlock()
+			if n < 40 {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, replicas[0].got, replicas[1].got, "every replica sees one order")
+	for _, msg := range replicas[0].got {
+		if strings.Contains(msg, "ü") {
+			assert.Equal(t, 5000, strings.Count(msg, "ü€"), "large messages arrive whole")
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingRepo counts the reads that reach the wrapped repository.
+type countingRepo struct {
+	db.Repository
+	gets  atomic.Int32
+	delay time.Duration
+}
+
+func (r *countingRepo) GetPaste(ctx context.Context, id string) (*db.Paste, error) {
+	r.gets.Add(1)
+	time.Sleep(r.delay)
+	return r.Repository.GetPaste(ctx, id)
+}
+
+func newCachedRepo(t *testing.T, cfg db.CacheConfig) (db.Repository, *countingRepo, *db.Cache) {
+	t.Helper()
+	backing := &countingRepo{Repository: db.NewMemoryRepo()}
+	cache := db.NewCache(cfg)
+	return db.WithCache(backing, cache, nil), backing, cache
+}
+
+func TestCachedRepo_ReadThroughAndInvalidate(t *testing.T) {
+	repo, backing, cache := newCachedRepo(t, db.CacheConfig{})
+	ctx := context.Background()
+	require.NoError(t, repo.CreatePaste(ctx, &db.Paste{ID: "hot", Content: "v1", Language: "go"}))
+
+	for i := 0; i < 5; i++ {
+		p, err := repo.GetPaste(ctx, "hot")
+		require.NoError(t, err)
+		assert.Equal(t, "v1", p.Content)
+	}
+	assert.EqualValues(t, 1, backing.gets.Load(), "only the first read reaches storage")
+
+	// Callers get copies; mutating one does not change the cache.
+	p, _ := repo.GetPaste(ctx, "hot")
+	p.Content = "scribbled"
+	p, _ = repo.GetPaste(ctx, "hot")
+	assert.Equal(t, "v1", p.Content)
+
+	require.NoError(t, repo.UpdatePaste(ctx, &db.Paste{ID: "hot", Content: "v2", Language: "go"}))
+	p, err := repo.GetPaste(ctx, "hot")
+	require.NoError(t, err)
+	assert.Equal(t, "v2", p.Content)
+	assert.EqualValues(t, 2, backing.gets.Load())
+
+	// View flushes patch the cached entry instead of dropping it.
+	require.NoError(t, repo.UpdateViews(ctx, &db.Paste{ID: "hot"}, 3))
+	p, _ = repo.GetPaste(ctx, "hot")
+	assert.Equal(t, 3, p.Views)
+	assert.EqualValues(t, 2, backing.gets.Load())
+
+	cache.Invalidate("hot")
+	_, _ = repo.GetPaste(ctx, "hot")
+	assert.EqualValues(t, 3, backing.gets.Load())
+
+	_, err = repo.GetPaste(ctx, "missing")
+	assert.ErrorIs(t, err, db.ErrNotFound)
+	assert.Equal(t, 1, cache.Len(), "misses are not cached")
+}
+
+func TestCachedRepo_NeverServesExpired(t *testing.T) {
+	repo, backing, cache := newCachedRepo(t, db.CacheConfig{})
+	ctx := context.Background()
+	soon := time.Now().Add(50 * time.Millisecond)
+	require.NoError(t, repo.CreatePaste(ctx, &db.Paste{ID: "brief", Content: "x", Language: "text", ExpireAt: &soon}))
+
+	_, err := repo.GetPaste(ctx, "brief")
+	require.NoError(t, err)
+	_, _ = repo.GetPaste(ctx, "brief")
+	assert.EqualValues(t, 1, backing.gets.Load())
+
+	time.Sleep(60 * time.Millisecond)
+	p, err := repo.GetPaste(ctx, "brief")
+	require.NoError(t, err, "storage still holds it until cleanup runs")
+	assert.EqualValues(t, 2, backing.gets.Load(), "the expired entry was not served")
+	assert.Equal(t, 0, cache.Len(), "already-expired pastes are not cached")
+	assert.True(t, p.ExpireAt.Before(time.Now()))
+
+	deleted, err := repo.DeleteExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	_, err = repo.GetPaste(ctx, "brief")
+	assert.ErrorIs(t, err, db.ErrNotFound)
+}
+
+func TestCachedRepo_TTL(t *testing.T) {
+	repo, backing, _ := newCachedRepo(t, db.CacheConfig{TTL: 30 * time.Millisecond})
+	ctx := context.Background()
+	require.NoError(t, repo.CreatePaste(ctx, &db.Paste{ID: "p", Content: "x", Language: "text"}))
+
+	_, _ = repo.GetPaste(ctx, "p")
+	_, _ = repo.GetPaste(ctx, "p")
+	assert.EqualValues(t, 1, backing.gets.Load())
+	time.Sleep(40 * time.Millisecond)
+	_, _ = repo.GetPaste(ctx, "p")
+	assert.EqualValues(t, 2, backing.gets.Load())
+}
+
+func TestCachedRepo_LRULimits(t *testing.T) {
+	repo, backing, cache := newCachedRepo(t, db.CacheConfig{MaxEntries: 2})
+	ctx := context.Background()
+	for _, id := range []string{"a", "b", "c"} {
+		require.NoError(t, repo.CreatePaste(ctx, &db.Paste{ID: id, Content: id, Language: "text"}))
+	}
+
+	_, _ = repo.GetPaste(ctx, "a")
+	_, _ = repo.GetPaste(ctx, "b")
+	_, _ = repo.GetPaste(ctx, "a") // a is now most recently used
+	_, _ = repo.GetPaste(ctx, "c") // evicts b
+	assert.Equal(t, 2, cache.Len())
+	before := backing.gets.Load()
+	_, _ = repo.GetPaste(ctx, "a")
+	assert.Equal(t, before, backing.gets.Load(), "a stayed cached")
+	_, _ = repo.GetPaste(ctx, "b")
+	assert.Equal(t, before+1, backing.gets.Load(), "b was evicted")
+
+	// The byte limit evicts too, and refuses pastes too big to be worth it.
+	repo, _, cache = newCachedRepo(t, db.CacheConfig{MaxBytes: 16 << 10})
+	// About 900 bytes each, so 20 of them exceed 16KiB.
+	big := strings.Repeat("x", 700)
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("p%d", i)
+		require.NoError(t, repo.CreatePaste(ctx, &db.Paste{ID: id, Content: big, Language: "text"}))
+		_, _ = repo.GetPaste(ctx, id)
+	}
+	assert.Less(t, cache.Len(), 20)
+	assert.Greater(t, cache.Len(), 0)
+	require.NoError(t, repo.CreatePaste(ctx, &db.Paste{ID: "huge", Content: strings.Repeat("x", 4<<10), Language: "text"}))
+	before = int32(cache.Len())
+	_, _ = repo.GetPaste(ctx, "huge")
+	assert.EqualValues(t, before, cache.Len())
+}
+
+func TestCachedRepo_CoalescesConcurrentMisses(t *testing.T) {
+	repo, backing, _ := newCachedRepo(t, db.CacheConfig{})
+	backing.delay = 20 * time.Millisecond
+	ctx := context.Background()
+	require.NoError(t, repo.CreatePaste(ctx, &db.Paste{ID: "viral", Content: "x", Language: "text"}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := repo.GetPaste(ctx, "viral")
+			assert.NoError(t, err)
+			assert.Equal(t, "viral", p.ID)
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, backing.gets.Load())
+}
+
+func TestPGInvalidator_CrossReplica(t *testing.T) {
+	pool := setupTestDB(t)
+	testInvalidatorCrossReplica(t, pool, db.NewRepo(pool, db.DefaultQueryTimeout))
+}
+
+// TestInvalidatorOverFakePostgres runs the invalidator over the fake
+// server, with the pastes in memory, so that its listener is exercised
+// without Docker.
+func TestInvalidatorOverFakePostgres(t *testing.T) {
+	testInvalidatorCrossReplica(t, newFakePG(t), db.NewMemoryRepo())
+}
+
+// testInvalidatorCrossReplica checks that a write through one replica's
+// cache evicts the paste from another's.
+func testInvalidatorCrossReplica(t *testing.T, pool *pgxpool.Pool, shared db.Repository) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	// Two replicas sharing one database, each with its own cache.
+	newReplica := func() (db.Repository, *db.Cache) {
+		cache := db.NewCache(db.CacheConfig{})
+		inv := db.NewPGInvalidator(pool, cache)
+		go inv.Listen(ctx)
+		return db.WithCache(shared, cache, inv), cache
+	}
+	a, _ := newReplica()
+	b, cacheB := newReplica()
+	// Give both listeners time to subscribe.
+	time.Sleep(200 * time.Millisecond)
+
+	require.NoError(t, a.CreatePaste(ctx, &db.Paste{ID: "shared", Content: "v1", Language: "go"}))
+	p, err := b.GetPaste(ctx, "shared")
+	require.NoError(t, err)
+	assert.Equal(t, "v1", p.Content)
+	assert.Equal(t, 1, cacheB.Len())
+
+	require.NoError(t, a.UpdatePaste(ctx, &db.Paste{ID: "shared", Content: "v2", Language: "go"}))
+	require.Eventually(t, func() bool { return cacheB.Len() == 0 }, 2*time.Second, 10*time.Millisecond)
+	p, err = b.GetPaste(ctx, "shared")
+	require.NoError(t, err)
+	assert.Equal(t, "v2", p.Content)
+}
@@ -2,20 +2,22 @@ package db_test
 
 import (
 	"context"
-	"os"
-	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/Sumedhvats/pasteCTL_web/internal/db"
-	"github.com/jackc/pgx/v5"
+	"github.com/Sumedhvats/pasteCTL_web/internal/migrate"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/postgres"
 	"github.com/testcontainers/testcontainers-go/wait"
 )
 
-func setupTestDB(t *testing.T) {
+func setupTestDB(t *testing.T) *pgxpool.Pool {
 	t.Helper()
 
 	dbName := "pastes"
@@ -25,7 +27,6 @@ func setupTestDB(t *testing.T) {
 	pgContainer, err := postgres.Run(
 		ctx,
 		"postgres", 
-		postgres.WithInitScripts(filepath.Join("..","testDATA_DB", "testdata.sql")),
 		postgres.WithDatabase(dbName),
 		postgres.WithUsername(dbUser),
 		postgres.WithPassword(dbPassword),
@@ -48,20 +49,27 @@ func setupTestDB(t *testing.T) {
 	connString, err := pgContainer.ConnectionString(ctx, "sslmode=disable")
 	assert.NoError(t, err)
 
-	// Set env for db.Init()
-	os.Setenv("DATABASE_URL", connString)
-
-	db.Init()
+	pool, err := db.Open(ctx, db.Config{URL: connString})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
 
-	t.Cleanup(func() {
-		db.Close()
-	})
+	migrator, err := migrate.NewPostgres(pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return pool
 }
 
 func TestCreateGetUpdateDeletePaste(t *testing.T) {
-	setupTestDB(t)
+	pool := setupTestDB(t)
 
-	repo := db.NewRepo()
+	repo := db.NewRepo(pool, db.DefaultQueryTimeout)
+	ctx := context.Background()
 	now := time.Now().Add(10 * time.Minute)
 
 	paste := &db.Paste{
@@ -74,11 +82,13 @@ func TestCreateGetUpdateDeletePaste(t *testing.T) {
 	}
 
 	//  Create
-	err := repo.CreatePaste(paste)
+	err := repo.CreatePaste(ctx, paste)
 	assert.NoError(t, err)
+	// The unique violation surfaces as ErrDuplicateID so callers can retry.
+	assert.ErrorIs(t, repo.CreatePaste(ctx, paste), db.ErrDuplicateID)
 
 	// Get
-	fetched, err := repo.GetPaste("testingId")
+	fetched, err := repo.GetPaste(ctx, "testingId")
 	assert.NoError(t, err)
 	assert.NotNil(t, fetched)
 	assert.Equal(t, "Hello, world!", fetched.Content)
@@ -86,10 +96,10 @@ func TestCreateGetUpdateDeletePaste(t *testing.T) {
 
 	// Update
 	paste.Content = "Hello, everyone!"
-	err = repo.UpdatePaste(paste)
+	err = repo.UpdatePaste(ctx, paste)
 	assert.NoError(t, err)
 
-	fetched2, err := repo.GetPaste("testingId")
+	fetched2, err := repo.GetPaste(ctx, "testingId")
 	assert.NoError(t, err)
 	assert.NotNil(t, fetched2)
 	assert.Equal(t, "Hello, everyone!", fetched2.Content)
@@ -97,15 +107,52 @@ func TestCreateGetUpdateDeletePaste(t *testing.T) {
 	//  Expire + DeleteExpired
 	expiresTime := time.Now().Add(-10 * time.Minute)
 	paste.ExpireAt = &expiresTime
-	_, err = db.DB.Exec(context.Background(),
+	_, err = pool.Exec(ctx,
 		"UPDATE pastes SET expire_at=$1 WHERE id=$2", paste.ExpireAt, paste.ID)
 	assert.NoError(t, err)
 
-	err = repo.DeleteExpired()
+	deleted, err := repo.DeleteExpired(ctx)
 	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
 
 	// Should be gone
-	temp, err := repo.GetPaste(paste.ID)
-	assert.ErrorIs(t, err,pgx.ErrNoRows)
+	temp, err := repo.GetPaste(ctx, paste.ID)
+	assert.ErrorIs(t, err,db.ErrNotFound)
 	assert.Nil(t, temp)
 }
+
+func TestMigrationsConcurrentReplicas(t *testing.T) {
+	pool := setupTestDB(t)
+	ctx := context.Background()
+
+	migrator, err := migrate.NewPostgres(pool)
+	require.NoError(t, err)
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	reverted, err := migrator.Down(ctx, len(statuses))
+	require.NoError(t, err)
+	require.Equal(t, len(statuses), reverted)
+
+	// Several replicas starting at once must apply each migration exactly once.
+	var wg sync.WaitGroup
+	var total atomic.Int64
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m, err := migrate.NewPostgres(pool)
+			if !assert.NoError(t, err) {
+				return
+			}
+			n, err := m.Up(ctx)
+			assert.NoError(t, err)
+			total.Add(int64(n))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(len(statuses)), total.Load())
+
+	pending, err := migrator.Pending(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, pending)
+}
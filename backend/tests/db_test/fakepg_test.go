@@ -0,0 +1,194 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePG speaks just enough of the Postgres protocol for LISTEN/NOTIFY:
+// LISTEN, pg_notify and transactions around them. Like Postgres, it
+// delivers a transaction's notifications at commit and drops one that
+// repeats another of the same transaction. It lets the listeners run
+// without Docker.
+type fakePG struct {
+	ln net.Listener
+
+	mu    sync.Mutex
+	conns map[*fakeConn]struct{}
+}
+
+type fakeConn struct {
+	pid uint32
+	// mu serialises writes: notifications arrive from other connections.
+	mu       sync.Mutex
+	backend  *pgproto3.Backend
+	channels map[string]bool
+}
+
+// notifyArgs matches the quoted channel and payload of a pg_notify call
+// sent with the simple protocol.
+var notifyArgs = regexp.MustCompile(`(?s)'((?:[^']|'')*)'`)
+
+// newFakePG starts a fake server and returns a pool connected to it.
+func newFakePG(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	f := &fakePG{ln: ln, conns: make(map[*fakeConn]struct{})}
+	t.Cleanup(func() { ln.Close() })
+	go f.serve()
+
+	// The simple protocol needs no statement preparation.
+	pool, err := pgxpool.New(context.Background(),
+		"postgres://fake@"+ln.Addr().String()+"/fake?sslmode=disable&default_query_exec_mode=simple_protocol")
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func (f *fakePG) serve() {
+	var pid uint32
+	for {
+		nc, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		pid++
+		go f.handle(nc, pid)
+	}
+}
+
+func (f *fakePG) handle(nc net.Conn, pid uint32) {
+	defer nc.Close()
+	c := &fakeConn{pid: pid, backend: pgproto3.NewBackend(nc, nc), channels: make(map[string]bool)}
+	if _, err := c.backend.ReceiveStartupMessage(); err != nil {
+		return
+	}
+	c.send(
+		&pgproto3.AuthenticationOk{},
+		&pgproto3.ParameterStatus{Name: "server_version", Value: "16.0"},
+		&pgproto3.ParameterStatus{Name: "standard_conforming_strings", Value: "on"},
+		&pgproto3.ParameterStatus{Name: "client_encoding", Value: "UTF8"},
+		&pgproto3.BackendKeyData{ProcessID: pid},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	)
+	f.mu.Lock()
+	f.conns[c] = struct{}{}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		delete(f.conns, c)
+		f.mu.Unlock()
+	}()
+
+	var inTx bool
+	var pending []pgproto3.NotificationResponse
+	for {
+		msg, err := c.backend.Receive()
+		if err != nil {
+			return
+		}
+		q, ok := msg.(*pgproto3.Query)
+		if !ok {
+			return
+		}
+		sql := strings.ToLower(strings.TrimSpace(q.String))
+		var reply []pgproto3.BackendMessage
+		switch {
+		case strings.HasPrefix(sql, "begin"):
+			inTx = true
+			reply = append(reply, &pgproto3.CommandComplete{CommandTag: []byte("BEGIN")})
+		case sql == "commit":
+			f.notify(pending)
+			inTx, pending = false, nil
+			reply = append(reply, &pgproto3.CommandComplete{CommandTag: []byte("COMMIT")})
+		case sql == "rollback":
+			inTx, pending = false, nil
+			reply = append(reply, &pgproto3.CommandComplete{CommandTag: []byte("ROLLBACK")})
+		case strings.HasPrefix(sql, "listen "):
+			c.mu.Lock()
+			c.channels[strings.TrimPrefix(sql, "listen ")] = true
+			c.mu.Unlock()
+			reply = append(reply, &pgproto3.CommandComplete{CommandTag: []byte("LISTEN")})
+		case strings.Contains(sql, "pg_notify("):
+			args := notifyArgs.FindAllStringSubmatch(q.String, -1)
+			if len(args) != 2 {
+				reply = append(reply, &pgproto3.ErrorResponse{Severity: "ERROR", Code: "42601", Message: "bad pg_notify"})
+				break
+			}
+			n := pgproto3.NotificationResponse{
+				PID:     pid,
+				Channel: strings.ReplaceAll(args[0][1], "''", "'"),
+				Payload: strings.ReplaceAll(args[1][1], "''", "'"),
+			}
+			if inTx {
+				if !containsNotification(pending, n) {
+					pending = append(pending, n)
+				}
+			} else {
+				f.notify([]pgproto3.NotificationResponse{n})
+			}
+			reply = append(reply,
+				&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{{Name: []byte("pg_notify"), DataTypeOID: 2278, DataTypeSize: 4, TypeModifier: -1}}},
+				&pgproto3.DataRow{Values: [][]byte{{}}},
+				&pgproto3.CommandComplete{CommandTag: []byte("SELECT 1")},
+			)
+		default:
+			reply = append(reply, &pgproto3.ErrorResponse{Severity: "ERROR", Code: "0A000", Message: "not supported by the fake server"})
+		}
+		status := byte('I')
+		if inTx {
+			status = 'T'
+		}
+		if err := c.send(append(reply, &pgproto3.ReadyForQuery{TxStatus: status})...); err != nil {
+			return
+		}
+	}
+}
+
+// notify sends notifications to every connection listening on their
+// channels, in order.
+func (f *fakePG) notify(ns []pgproto3.NotificationResponse) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for c := range f.conns {
+		for i := range ns {
+			c.mu.Lock()
+			listening := c.channels[ns[i].Channel]
+			c.mu.Unlock()
+			if listening {
+				c.send(&ns[i])
+			}
+		}
+	}
+}
+
+func containsNotification(ns []pgproto3.NotificationResponse, n pgproto3.NotificationResponse) bool {
+	for _, m := range ns {
+		if m.Channel == n.Channel && m.Payload == n.Payload {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *fakeConn) send(msgs ...pgproto3.BackendMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, m := range msgs {
+		c.backend.Send(m)
+	}
+	if err := c.backend.Flush(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRepo_CreateGetUpdateDeletePaste(t *testing.T) {
+	repo := db.NewMemoryRepo()
+	ctx := context.Background()
+	later := time.Now().Add(10 * time.Minute)
+
+	paste := &db.Paste{
+		ID:       "testingId",
+		Content:  "Hello, world!",
+		Language: "go",
+		ExpireAt: &later,
+	}
+	require.NoError(t, repo.CreatePaste(ctx, paste))
+	assert.ErrorIs(t, repo.CreatePaste(ctx, paste), db.ErrDuplicateID)
+
+	fetched, err := repo.GetPaste(ctx, "testingId")
+	require.NoError(t, err)
+	assert.Equal(t, "Hello, world!", fetched.Content)
+	assert.False(t, fetched.CreatedAt.IsZero())
+
+	paste.Content = "Hello, everyone!"
+	require.NoError(t, repo.UpdatePaste(ctx, paste))
+	require.NoError(t, repo.UpdateViews(ctx, paste, 3))
+
+	fetched, err = repo.GetPaste(ctx, "testingId")
+	require.NoError(t, err)
+	assert.Equal(t, "Hello, everyone!", fetched.Content)
+	assert.Equal(t, 3, fetched.Views)
+
+	// Mutating a returned paste must not leak into the store.
+	fetched.Content = "mutated"
+	again, err := repo.GetPaste(ctx, "testingId")
+	require.NoError(t, err)
+	assert.Equal(t, "Hello, everyone!", again.Content)
+
+	// Expired pastes stay readable until DeleteExpired runs, like Postgres.
+	earlier := time.Now().Add(-10 * time.Minute)
+	require.NoError(t, repo.CreatePaste(ctx, &db.Paste{ID: "old", Content: "x", Language: "text", ExpireAt: &earlier}))
+	_, err = repo.GetPaste(ctx, "old")
+	require.NoError(t, err)
+
+	deleted, err := repo.DeleteExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	_, err = repo.GetPaste(ctx, "old")
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+	_, err = repo.GetPaste(ctx, "testingId")
+	assert.NoError(t, err)
+}
+
+func TestMemoryRepo_ConcurrentAccess(t *testing.T) {
+	repo := db.NewMemoryRepo()
+	ctx := context.Background()
+	require.NoError(t, repo.CreatePaste(ctx, &db.Paste{ID: "hot", Content: "x", Language: "text"}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_ = repo.CreatePaste(ctx, &db.Paste{ID: fmt.Sprintf("p%d", i), Content: "x", Language: "text"})
+			_ = repo.UpdateViews(ctx, &db.Paste{ID: "hot"}, 1)
+			_, _ = repo.GetPaste(ctx, "hot")
+		}(i)
+	}
+	wg.Wait()
+
+	hot, err := repo.GetPaste(ctx, "hot")
+	require.NoError(t, err)
+	assert.Equal(t, 50, hot.Views)
+}
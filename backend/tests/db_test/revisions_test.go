@@ -0,0 +1,79 @@
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	"github.com/Sumedhvats/pasteCTL_web/internal/migrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRevisions(t *testing.T, repo db.Repository) {
+	ctx := context.Background()
+	earlier := time.Now().Add(-time.Minute)
+	require.NoError(t, repo.CreatePaste(ctx, &db.Paste{ID: "revs", Content: "v0", Language: "text"}))
+	require.NoError(t, repo.CreatePaste(ctx, &db.Paste{ID: "old", Content: "v0", Language: "text", ExpireAt: &earlier}))
+
+	revs, err := repo.ListRevisions(ctx, "revs", db.MaxRevisions)
+	require.NoError(t, err)
+	assert.Empty(t, revs, "creating a paste records no revision")
+
+	for i := 1; i <= db.MaxRevisions+5; i++ {
+		require.NoError(t, repo.UpdatePaste(ctx, &db.Paste{ID: "revs", Content: fmt.Sprintf("v%d", i), Language: "go"}))
+	}
+	require.NoError(t, repo.UpdatePaste(ctx, &db.Paste{ID: "old", Content: "v1", Language: "go"}))
+	// Updates to unknown pastes change nothing and record nothing.
+	require.NoError(t, repo.UpdatePaste(ctx, &db.Paste{ID: "missing", Content: "v1", Language: "go"}))
+
+	revs, err = repo.ListRevisions(ctx, "revs", db.MaxRevisions+10)
+	require.NoError(t, err)
+	require.Len(t, revs, db.MaxRevisions, "older revisions are pruned")
+	assert.Equal(t, fmt.Sprintf("v%d", db.MaxRevisions+5), revs[0].Content)
+	assert.Equal(t, "v6", revs[len(revs)-1].Content)
+	assert.Equal(t, "revs", revs[0].PasteID)
+	assert.Equal(t, "go", revs[0].Language)
+	assert.WithinDuration(t, time.Now(), revs[0].CreatedAt, time.Minute)
+	assert.Greater(t, revs[0].ID, revs[1].ID)
+
+	revs, err = repo.ListRevisions(ctx, "revs", 2)
+	require.NoError(t, err)
+	assert.Len(t, revs, 2)
+
+	revs, err = repo.ListRevisions(ctx, "missing", db.MaxRevisions)
+	require.NoError(t, err)
+	assert.Empty(t, revs)
+
+	// Revisions go with their paste.
+	_, err = repo.DeleteExpired(ctx)
+	require.NoError(t, err)
+	revs, err = repo.ListRevisions(ctx, "old", db.MaxRevisions)
+	require.NoError(t, err)
+	assert.Empty(t, revs)
+}
+
+func TestMemoryRepo_Revisions(t *testing.T) {
+	testRevisions(t, db.NewMemoryRepo())
+}
+
+func TestSQLiteRepo_Revisions(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, err := db.OpenSQLite(ctx, filepath.Join(t.TempDir(), "revisions.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+	migrator, err := migrate.NewSQLite(sqlDB)
+	require.NoError(t, err)
+	_, err = migrator.Up(ctx)
+	require.NoError(t, err)
+
+	testRevisions(t, db.NewSQLiteRepo(sqlDB, db.DefaultQueryTimeout))
+}
+
+func TestPostgresRepo_Revisions(t *testing.T) {
+	pool := setupTestDB(t)
+	testRevisions(t, db.NewRepo(pool, db.DefaultQueryTimeout))
+}
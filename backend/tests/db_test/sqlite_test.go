@@ -0,0 +1,112 @@
+package db_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	"github.com/Sumedhvats/pasteCTL_web/internal/migrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteRepo_CreateGetUpdateDeletePaste(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "pastes.db")
+	sqlDB, err := db.OpenSQLite(ctx, path)
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+	migrator, err := migrate.NewSQLite(sqlDB)
+	require.NoError(t, err)
+	_, err = migrator.Up(ctx)
+	require.NoError(t, err)
+
+	repo := db.NewSQLiteRepo(sqlDB, db.DefaultQueryTimeout)
+	later := time.Now().Add(10 * time.Minute)
+
+	paste := &db.Paste{
+		ID:       "testingId",
+		Content:  "Hello, world!",
+		Language: "go",
+		ExpireAt: &later,
+	}
+	require.NoError(t, repo.CreatePaste(ctx, paste))
+	assert.ErrorIs(t, repo.CreatePaste(ctx, paste), db.ErrDuplicateID)
+
+	fetched, err := repo.GetPaste(ctx, "testingId")
+	require.NoError(t, err)
+	assert.Equal(t, "Hello, world!", fetched.Content)
+	assert.Equal(t, "go", fetched.Language)
+	require.NotNil(t, fetched.ExpireAt)
+	assert.WithinDuration(t, later, *fetched.ExpireAt, time.Millisecond)
+
+	paste.Content = "Hello, everyone!"
+	require.NoError(t, repo.UpdatePaste(ctx, paste))
+	require.NoError(t, repo.UpdateViews(ctx, paste, 2))
+
+	fetched, err = repo.GetPaste(ctx, "testingId")
+	require.NoError(t, err)
+	assert.Equal(t, "Hello, everyone!", fetched.Content)
+	assert.Equal(t, 2, fetched.Views)
+
+	earlier := time.Now().Add(-10 * time.Minute)
+	require.NoError(t, repo.CreatePaste(ctx, &db.Paste{ID: "old", Content: "x", Language: "text", ExpireAt: &earlier}))
+	deleted, err := repo.DeleteExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	_, err = repo.GetPaste(ctx, "old")
+	assert.ErrorIs(t, err, db.ErrNotFound)
+	_, err = repo.GetPaste(ctx, "testingId")
+	assert.NoError(t, err)
+
+	// Reopening applies no migration twice and keeps the data.
+	require.NoError(t, sqlDB.Close())
+	sqlDB, err = db.OpenSQLite(ctx, path)
+	require.NoError(t, err)
+	migrator, err = migrate.NewSQLite(sqlDB)
+	require.NoError(t, err)
+	n, err := migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	_, err = db.NewSQLiteRepo(sqlDB, db.DefaultQueryTimeout).GetPaste(ctx, "testingId")
+	assert.NoError(t, err)
+}
+
+func TestSQLiteMigrations_StatusAndDown(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, err := db.OpenSQLite(ctx, filepath.Join(t.TempDir(), "pastes.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	migrator, err := migrate.NewSQLite(sqlDB)
+	require.NoError(t, err)
+
+	// Counting pending migrations only reads: on a fresh database every
+	// one is pending, and no table is created.
+	pending, err := migrator.Pending(ctx)
+	require.NoError(t, err)
+	require.NotZero(t, pending)
+	var tables int
+	require.NoError(t, sqlDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE name='schema_migrations'").Scan(&tables))
+	assert.Zero(t, tables)
+
+	n, err := migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, pending, n)
+
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	for _, s := range statuses {
+		assert.NotNil(t, s.AppliedAt, "migration %d should be applied", s.Version)
+	}
+
+	n, err = migrator.Down(ctx, len(statuses))
+	require.NoError(t, err)
+	assert.Equal(t, len(statuses), n)
+
+	_, err = sqlDB.ExecContext(ctx, "SELECT 1 FROM pastes")
+	assert.Error(t, err, "pastes table should be dropped")
+}
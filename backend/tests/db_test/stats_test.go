@@ -0,0 +1,89 @@
+package db_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	"github.com/Sumedhvats/pasteCTL_web/internal/migrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStatsRollup checks the analytics rollup contract every backend shares.
+func testStatsRollup(t *testing.T, repo db.Repository) {
+	ctx := context.Background()
+	require.NoError(t, repo.CreatePaste(ctx, &db.Paste{ID: "stats", Content: "x", Language: "go", OwnerHash: "abc", EditHash: "def"}))
+
+	fetched, err := repo.GetPaste(ctx, "stats")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", fetched.OwnerHash)
+	assert.Equal(t, "def", fetched.EditHash)
+
+	hour := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+	events := []db.Event{
+		{PasteID: "stats", Kind: db.EventView, Visitor: "a", Referrer: "example.com", At: hour.Add(time.Minute)},
+		{PasteID: "stats", Kind: db.EventView, Visitor: "b", Referrer: "example.com", At: hour.Add(2 * time.Minute)},
+		{PasteID: "stats", Kind: db.EventRaw, Visitor: "a", At: hour.Add(3 * time.Minute)},
+		{PasteID: "stats", Kind: db.EventView, Visitor: "a", Referrer: "news.ycombinator.com", At: hour.Add(time.Hour)},
+		{PasteID: "gone", Kind: db.EventView, Visitor: "a", At: hour},
+	}
+	require.NoError(t, repo.RecordEvents(ctx, events))
+
+	n, err := repo.RollupEvents(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n, "events for missing pastes are discarded too")
+
+	// Rolling up again folds nothing new; a later batch adds to the buckets.
+	n, err = repo.RollupEvents(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	require.NoError(t, repo.RecordEvents(ctx, []db.Event{
+		{PasteID: "stats", Kind: db.EventView, Visitor: "c", Referrer: "example.com", At: hour.Add(5 * time.Minute)},
+	}))
+	_, err = repo.RollupEvents(ctx, time.Now())
+	require.NoError(t, err)
+
+	stats, err := repo.GetStats(ctx, "stats", hour.Add(-24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{db.EventView: 4, db.EventRaw: 1}, stats.Totals)
+	assert.Equal(t, int64(3), stats.UniqueViewers)
+	require.Len(t, stats.Hourly, 3)
+	assert.True(t, stats.Hourly[0].Hour.Equal(hour))
+	assert.Equal(t, db.EventRaw, stats.Hourly[0].Kind)
+	assert.Equal(t, int64(1), stats.Hourly[0].Count)
+	assert.Equal(t, db.EventView, stats.Hourly[1].Kind)
+	assert.Equal(t, int64(3), stats.Hourly[1].Count)
+	assert.True(t, stats.Hourly[2].Hour.Equal(hour.Add(time.Hour)))
+	assert.Equal(t, []db.ReferrerCount{{Domain: "example.com", Count: 3}, {Domain: "news.ycombinator.com", Count: 1}}, stats.Referrers)
+
+	// since limits the hourly series but not the totals.
+	stats, err = repo.GetStats(ctx, "stats", hour.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, stats.Hourly, 1)
+	assert.Equal(t, int64(4), stats.Totals[db.EventView])
+}
+
+func TestMemoryRepo_StatsRollup(t *testing.T) {
+	testStatsRollup(t, db.NewMemoryRepo())
+}
+
+func TestSQLiteRepo_StatsRollup(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, err := db.OpenSQLite(ctx, filepath.Join(t.TempDir(), "stats.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+	migrator, err := migrate.NewSQLite(sqlDB)
+	require.NoError(t, err)
+	_, err = migrator.Up(ctx)
+	require.NoError(t, err)
+
+	testStatsRollup(t, db.NewSQLiteRepo(sqlDB, db.DefaultQueryTimeout))
+}
+
+func TestPostgresRepo_StatsRollup(t *testing.T) {
+	pool := setupTestDB(t)
+	testStatsRollup(t, db.NewRepo(pool, db.DefaultQueryTimeout))
+}
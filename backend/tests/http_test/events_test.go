@@ -0,0 +1,212 @@
+package httptest
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	httpHandler "github.com/Sumedhvats/pasteCTL_web/internal/http"
+	"github.com/Sumedhvats/pasteCTL_web/internal/ot"
+	pasteService "github.com/Sumedhvats/pasteCTL_web/internal/paste"
+	"github.com/Sumedhvats/pasteCTL_web/internal/ws"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type event struct {
+	ID, Event, Data string
+}
+
+// liveServer serves the paste API with live editing over an in-memory
+// store holding paste p1.
+func liveServer(t *testing.T) (url string, repo db.Repository, hub *ws.Hub) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	repo = db.NewMemoryRepo()
+	require.NoError(t, repo.CreatePaste(context.Background(), &db.Paste{ID: "p1", Content: "p1", Language: "go"}))
+	svc := pasteService.NewPasteService(repo)
+	hub = ws.NewHub(svc)
+	hub.SaveInterval = time.Hour
+	hub.CanEdit = func(*gin.Context) bool { return true }
+	handler := httpHandler.NewHandler(svc)
+	handler.Live = hub
+	r := gin.New()
+	r.Use(httpHandler.Authenticate(map[string]string{"test": "api-token"}))
+	r.PUT("/pastes/:id", handler.UpdatePasteHandler)
+	r.GET("/pastes/:id/events", handler.EventsHandler)
+	r.GET("/ws/:id", hub.PasteHandler)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv.URL, repo, hub
+}
+
+// follow opens the events stream at url and returns its events as they
+// arrive.
+func follow(t *testing.T, url, lastEventID string) <-chan event {
+	t.Helper()
+	req, err := http.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := make(chan event, 16)
+	go func() {
+		defer close(events)
+		var ev event
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			field, value, _ := strings.Cut(scanner.Text(), ": ")
+			switch field {
+			case "id":
+				ev.ID = value
+			case "event":
+				ev.Event = value
+			case "data":
+				ev.Data = value
+			case "":
+				if ev.Event != "" {
+					events <- ev
+				}
+				ev = event{}
+			}
+		}
+	}()
+	return events
+}
+
+func next(t *testing.T, events <-chan event) event {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		require.True(t, ok, "stream ended")
+		return ev
+	case <-time.After(2 * time.Second):
+		require.FailNow(t, "no event")
+		return event{}
+	}
+}
+
+func put(t *testing.T, url, body string) {
+	t.Helper()
+	req, err := http.NewRequest("PUT", url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer api-token")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestEventsHandler_StreamsUpdates(t *testing.T) {
+	url, _, _ := liveServer(t)
+	events := follow(t, url+"/pastes/p1/events", "")
+	ev := next(t, events)
+	assert.Equal(t, "content", ev.Event)
+	assert.JSONEq(t, `{"content":"p1","language":"go"}`, ev.Data)
+	assert.NotEmpty(t, ev.ID)
+
+	// Updates made with PUT reach the stream.
+	put(t, url+"/pastes/p1", `{"content":"updated","language":"text"}`)
+	ev = next(t, events)
+	assert.Equal(t, "content", ev.Event)
+	assert.JSONEq(t, `{"content":"updated","language":"text"}`, ev.Data)
+
+	// So do live edits, before they are saved.
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http")+"/ws/p1", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.WriteJSON(map[string]any{"type": "hello"}))
+	require.NoError(t, conn.WriteJSON(map[string]any{"type": "op", "rev": 1, "op": ot.Op{}.Retain(7).Insert("!")}))
+	ev = next(t, events)
+	assert.JSONEq(t, `{"content":"updated!","language":"text"}`, ev.Data)
+}
+
+func TestEventsHandler_ResumesFromLastEventID(t *testing.T) {
+	url, _, _ := liveServer(t)
+	first := next(t, follow(t, url+"/pastes/p1/events", ""))
+
+	// A client that has the current text is not sent it again.
+	events := follow(t, url+"/pastes/p1/events", first.ID)
+	put(t, url+"/pastes/p1", `{"content":"updated","language":"go"}`)
+	ev := next(t, events)
+	assert.JSONEq(t, `{"content":"updated","language":"go"}`, ev.Data)
+	assert.NotEqual(t, first.ID, ev.ID)
+
+	// One that missed a change gets the current text straight away.
+	ev = next(t, follow(t, url+"/pastes/p1/events", first.ID))
+	assert.JSONEq(t, `{"content":"updated","language":"go"}`, ev.Data)
+}
+
+func TestEventsHandler_Expiry(t *testing.T) {
+	url, repo, hub := liveServer(t)
+	expireAt := time.Now().Add(200 * time.Millisecond)
+	require.NoError(t, repo.CreatePaste(context.Background(), &db.Paste{ID: "soon", Content: "x", Language: "go", ExpireAt: &expireAt}))
+
+	events := follow(t, url+"/pastes/soon/events", "")
+	assert.Equal(t, "content", next(t, events).Event)
+	ev := next(t, events)
+	assert.Equal(t, "expired", ev.Event)
+	assert.JSONEq(t, `{"id":"soon"}`, ev.Data)
+	_, open := <-events
+	assert.False(t, open, "the stream ends")
+	require.Eventually(t, func() bool { return hub.Rooms() == 0 }, time.Second, 5*time.Millisecond)
+
+	resp, err := http.Get(url + "/pastes/soon/events")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+}
+
+func TestEventsHandler_RoomFull(t *testing.T) {
+	url, _, hub := liveServer(t)
+	hub.MaxRoomConnections = 1
+	next(t, follow(t, url+"/pastes/p1/events", ""))
+
+	resp, err := http.Get(url + "/pastes/p1/events")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestEventsHandler_WithoutLiveEditing(t *testing.T) {
+	mockService := new(MockPasteService)
+	handler := httpHandler.NewHandler(mockService)
+	handler.EventsKeepAlive = 20 * time.Millisecond
+	r := gin.New()
+	r.GET("/pastes/:id/events", handler.EventsHandler)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	// The stream polls the paste, sending changes until it is deleted.
+	mockService.On("GetPaste", mock.Anything, "abc123").Return(&db.Paste{ID: "abc123", Content: "one", Language: "go"}, nil).Twice()
+	mockService.On("GetPaste", mock.Anything, "abc123").Return(&db.Paste{ID: "abc123", Content: "two", Language: "go"}, nil).Once()
+	mockService.On("GetPaste", mock.Anything, "abc123").Return(nil, pasteService.ErrPasteNotFound)
+	mockService.On("GetPaste", mock.Anything, "missing").Return(nil, pasteService.ErrPasteNotFound)
+
+	events := follow(t, srv.URL+"/pastes/abc123/events", "")
+	assert.JSONEq(t, `{"content":"one","language":"go"}`, next(t, events).Data)
+	assert.JSONEq(t, `{"content":"two","language":"go"}`, next(t, events).Data)
+	ev := next(t, events)
+	assert.Equal(t, "deleted", ev.Event)
+	assert.JSONEq(t, `{"id":"abc123"}`, ev.Data)
+
+	resp, err := http.Get(srv.URL + "/pastes/missing/events")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,65 @@
+package httptest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	httpHandler "github.com/Sumedhvats/pasteCTL_web/internal/http"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupHealthRouter(h *httpHandler.HealthHandler) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/healthz", h.LivenessHandler)
+	r.GET("/readyz", h.ReadinessHandler)
+	r.GET("/version", h.VersionHandler)
+	return r
+}
+
+func TestHealthHandler(t *testing.T) {
+	health := httpHandler.NewHealthHandler()
+	dbErr := error(nil)
+	health.AddCheck("database", func(ctx context.Context) (any, error) { return nil, dbErr })
+	router := setupHealthRouter(health)
+
+	get := func(path string) (*httptest.ResponseRecorder, map[string]any) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+		return w, body
+	}
+
+	w, _ := get("/healthz")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w, body := get("/readyz")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ready", body["status"])
+
+	dbErr = errors.New("connection refused")
+	w, body = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "not ready", body["status"])
+
+	dbErr = nil
+	health.SetReady(false)
+	w, body = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "shutting down", body["status"])
+
+	// Liveness is unaffected by shutdown.
+	w, _ = get("/healthz")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w, body = get("/version")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, body["go_version"])
+}
@@ -2,15 +2,19 @@ package httptest
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/Sumedhvats/pasteCTL_web/internal/db"
 	httpHandler "github.com/Sumedhvats/pasteCTL_web/internal/http"
+	pasteService "github.com/Sumedhvats/pasteCTL_web/internal/paste"
+	"github.com/Sumedhvats/pasteCTL_web/internal/views"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -21,48 +25,87 @@ type MockPasteService struct {
 	mock.Mock
 }
 
-func (m *MockPasteService) CreatePaste(content, language string, expireMinutes int) (*db.Paste, error) {
-	args := m.Called(content, language, expireMinutes)
+func (m *MockPasteService) CreatePaste(ctx context.Context, content, language string, expireMinutes int) (*db.Paste, error) {
+	args := m.Called(ctx, content, language, expireMinutes)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*db.Paste), args.Error(1)
 }
-func (m *MockPasteService) GetPaste(id string) (*db.Paste, error) {
-	args := m.Called(id)
+func (m *MockPasteService) CreatePasteWithSlug(ctx context.Context, slug, content, language string, expireMinutes int) (*db.Paste, error) {
+	args := m.Called(ctx, slug, content, language, expireMinutes)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*db.Paste), args.Error(1)
 }
-func (m *MockPasteService) GetContent(id string) (string, error) {
-	args := m.Called(id)
+func (m *MockPasteService) GetPaste(ctx context.Context, id string) (*db.Paste, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*db.Paste), args.Error(1)
+}
+func (m *MockPasteService) GetContent(ctx context.Context, id string) (string, error) {
+	args := m.Called(ctx, id)
 	if args.Get(0) == nil {
 		return "", args.Error(1)
 	}
 	return args.Get(0).(string), args.Error(1)
 }
 
-func (m *MockPasteService) UpdatePaste(id, content, language string) (*db.Paste, error) {
-	args := m.Called(id, content, language)
+func (m *MockPasteService) UpdatePaste(ctx context.Context, id, content, language string) (*db.Paste, error) {
+	args := m.Called(ctx, id, content, language)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*db.Paste), args.Error(1)
 }
 
-func (m *MockPasteService) UpdateViews(id string, views int) (*db.Paste, error) {
-	args := m.Called(id, views)
+func (m *MockPasteService) UpdateViews(ctx context.Context, id string, views int) (*db.Paste, error) {
+	args := m.Called(ctx, id, views)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*db.Paste), args.Error(1)
 }
 
-func (m *MockPasteService) DeleteExpiredPastes() error {
-	args := m.Called()
+func (m *MockPasteService) DeleteExpiredPastes(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockPasteService) CheckOwner(ctx context.Context, id, ownerToken string) error {
+	args := m.Called(ctx, id, ownerToken)
 	return args.Error(0)
 }
+
+func (m *MockPasteService) CheckEditor(ctx context.Context, id, token string) error {
+	args := m.Called(ctx, id, token)
+	return args.Error(0)
+}
+
+func (m *MockPasteService) GetStats(ctx context.Context, id, ownerToken string) (*pasteService.Stats, error) {
+	args := m.Called(ctx, id, ownerToken)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*pasteService.Stats), args.Error(1)
+}
+
+func (m *MockPasteService) RollupStats(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockPasteService) ListRevisions(ctx context.Context, id string) ([]db.Revision, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]db.Revision), args.Error(1)
+}
+
 func setupRouter(handler *httpHandler.Handler) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
@@ -71,6 +114,9 @@ func setupRouter(handler *httpHandler.Handler) *gin.Engine {
 	r.PUT("/pastes/:id", handler.UpdatePasteHandler)
 	r.PATCH("/pastes/:id/views", handler.UpdateViewsHandler)
 	r.GET("/pastes/:id/content", handler.GetContentHandler)
+	r.GET("/pastes/:id/stats", handler.StatsHandler)
+	r.GET("/pastes/:id/revisions", handler.RevisionsHandler)
+	r.GET("/pastes/:id/participants", handler.ParticipantsHandler)
 	return r
 }
 func TestCreatePasteHandler(t *testing.T) {
@@ -86,7 +132,7 @@ func TestCreatePasteHandler(t *testing.T) {
 			ExpireAt: &expireAt,
 			Views:    0,
 		}
-		mockService.On("CreatePaste", "test content", "go", 60).
+		mockService.On("CreatePaste", mock.Anything, "test content", "go", 60).
 			Return(expectedPaste, nil).Once()
 		body := map[string]any{
 			"content":  "test content",
@@ -115,7 +161,7 @@ func TestCreatePasteHandler(t *testing.T) {
 		handler := httpHandler.NewHandler(mockService)
 		router := setupRouter(handler)
 
-		mockService.On("GetPaste", "abc123").
+		mockService.On("GetPaste", mock.Anything, "abc123").
 			Return(nil, errors.New("database connection failed")).
 			Once()
 
@@ -141,7 +187,8 @@ func TestUpdatePasteHandler(t *testing.T) {
 			Language: "python",
 		}
 
-		mockService.On("UpdatePaste", "abc123", "updated content", "python").Return(updatedPaste, nil).Once()
+		mockService.On("CheckEditor", mock.Anything, "abc123", "edit-token").Return(nil).Once()
+		mockService.On("UpdatePaste", mock.Anything, "abc123", "updated content", "python").Return(updatedPaste, nil).Once()
 
 		body := map[string]interface{}{
 			"content":  "updated content",
@@ -150,6 +197,7 @@ func TestUpdatePasteHandler(t *testing.T) {
 		jsonBody, _ := json.Marshal(body)
 		req := httptest.NewRequest("PUT", "/pastes/abc123", bytes.NewReader(jsonBody))
 		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer edit-token")
 		w := httptest.NewRecorder()
 		router.ServeHTTP(w, req)
 		assert.Equal(t, http.StatusOK, w.Code)
@@ -174,11 +222,61 @@ func TestUpdatePasteHandler(t *testing.T) {
 		
 		req := httptest.NewRequest("PUT", "/pastes/abc123", bytes.NewReader(jsonBody))
 		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer edit-token")
+		mockService.On("CheckEditor", mock.Anything, "abc123", "edit-token").Return(nil).Once()
 		w := httptest.NewRecorder()
 		router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
+
+	t.Run("only editors may update", func(t *testing.T) {
+		mockService := new(MockPasteService)
+		handler := httpHandler.NewHandler(mockService)
+		router := gin.New()
+		router.Use(httpHandler.Authenticate(map[string]string{"ci": "api-token"}))
+		router.PUT("/pastes/:id", handler.UpdatePasteHandler)
+
+		mockService.On("CheckEditor", mock.Anything, "abc123", "").Return(pasteService.ErrNotEditor).Once()
+		mockService.On("CheckEditor", mock.Anything, "abc123", "wrong").Return(pasteService.ErrNotEditor).Once()
+		mockService.On("UpdatePaste", mock.Anything, "abc123", "updated content", "go").Return(&db.Paste{ID: "abc123"}, nil).Once()
+
+		for _, tc := range []struct {
+			auth string
+			want int
+		}{
+			{"", http.StatusUnauthorized},
+			{"Bearer wrong", http.StatusForbidden},
+			// API users need no token of the paste.
+			{"Bearer api-token", http.StatusOK},
+		} {
+			req := httptest.NewRequest("PUT", "/pastes/abc123", strings.NewReader(`{"content":"updated content","language":"go"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tc.auth != "" {
+				req.Header.Set("Authorization", tc.auth)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tc.want, w.Code, tc.auth)
+		}
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("pastes without tokens need none", func(t *testing.T) {
+		mockService := new(MockPasteService)
+		handler := httpHandler.NewHandler(mockService)
+		router := setupRouter(handler)
+
+		mockService.On("CheckEditor", mock.Anything, "legacy", "").Return(nil).Once()
+		mockService.On("UpdatePaste", mock.Anything, "legacy", "updated content", "go").Return(&db.Paste{ID: "legacy"}, nil).Once()
+
+		req := httptest.NewRequest("PUT", "/pastes/legacy", strings.NewReader(`{"content":"updated content","language":"go"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockService.AssertExpectations(t)
+	})
 }
 
 // TestGetContentHandler tests the GetContent endpoint
@@ -193,7 +291,7 @@ func TestGetContentHandler(t *testing.T) {
 			Content: "raw paste content",
 		}
 
-		mockService.On("GetPaste", "abc123").
+		mockService.On("GetPaste", mock.Anything, "abc123").
 			Return(expectedPaste, nil).
 			Once()
 
@@ -211,4 +309,213 @@ func TestGetContentHandler(t *testing.T) {
 
 		mockService.AssertExpectations(t)
 	})
-}
\ No newline at end of file
+}
+func TestGetPasteHandler_ErrorMapping(t *testing.T) {
+	cases := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"not found", pasteService.ErrPasteNotFound, http.StatusNotFound},
+		{"expired", pasteService.ErrPasteExpired, http.StatusGone},
+		{"query deadline", context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{"client gone", context.Canceled, http.StatusServiceUnavailable},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockService := new(MockPasteService)
+			handler := httpHandler.NewHandler(mockService)
+			router := setupRouter(handler)
+
+			mockService.On("GetPaste", mock.Anything, "abc123").
+				Return(nil, tc.err).
+				Once()
+
+			req := httptest.NewRequest("GET", "/pastes/abc123", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.status, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetPasteHandler_CountView(t *testing.T) {
+	mockService := new(MockPasteService)
+	handler := httpHandler.NewHandler(mockService)
+	handler.Views = views.NewCounter(mockService, views.Options{DedupWindow: time.Hour})
+	router := setupRouter(handler)
+
+	mockService.On("GetPaste", mock.Anything, "abc123").
+		Return(&db.Paste{ID: "abc123", Content: "x", Language: "go", Views: 7}, nil)
+
+	get := func(path string) map[string]any {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("User-Agent", "test-browser")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+		return body
+	}
+
+	assert.EqualValues(t, 7, get("/pastes/abc123")["views"], "plain GET does not count")
+	assert.EqualValues(t, 8, get("/pastes/abc123?view=1")["views"], "pending view is included")
+	assert.EqualValues(t, 8, get("/pastes/abc123?view=1")["views"], "same visitor is deduplicated")
+
+	// Views reach the service in one batched write.
+	mockService.On("UpdateViews", mock.Anything, "abc123", 1).Return(&db.Paste{ID: "abc123"}, nil).Once()
+	require.NoError(t, handler.Views.Flush(context.Background()))
+	mockService.AssertExpectations(t)
+}
+
+func TestStatsHandler(t *testing.T) {
+	mockService := new(MockPasteService)
+	router := setupRouter(httpHandler.NewHandler(mockService))
+
+	get := func(auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/pastes/abc123/stats", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("missing token", func(t *testing.T) {
+		w := get("")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+	})
+
+	t.Run("wrong token", func(t *testing.T) {
+		mockService.On("GetStats", mock.Anything, "abc123", "wrong").Return(nil, pasteService.ErrNotOwner).Once()
+		assert.Equal(t, http.StatusForbidden, get("Bearer wrong").Code)
+	})
+
+	t.Run("owner", func(t *testing.T) {
+		mockService.On("GetStats", mock.Anything, "abc123", "secret").
+			Return(&pasteService.Stats{PasteID: "abc123", UniqueViewers: 3}, nil).Once()
+		w := get("bearer secret")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "private, no-store", w.Header().Get("Cache-Control"))
+
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+		assert.EqualValues(t, 3, body["unique_viewers"])
+	})
+	mockService.AssertExpectations(t)
+}
+
+func TestGetContentHandler_Download(t *testing.T) {
+	mockService := new(MockPasteService)
+	router := setupRouter(httpHandler.NewHandler(mockService))
+	mockService.On("GetPaste", mock.Anything, "abc123").
+		Return(&db.Paste{ID: "abc123", Content: "package main\n", Language: "go"}, nil)
+
+	req := httptest.NewRequest("GET", "/pastes/abc123/content?download=1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `attachment; filename="abc123.txt"`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "package main\n", w.Body.String())
+}
+
+func TestCreatePasteHandler_Slug(t *testing.T) {
+	mockService := new(MockPasteService)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(httpHandler.Authenticate(map[string]string{"alice": "alice-api-token-0001"}))
+	router.POST("/pastes", httpHandler.NewHandler(mockService).CreatePasteHandler)
+
+	create := func(slug, auth string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]any{"content": "hi", "language": "text", "slug": slug})
+		req := httptest.NewRequest("POST", "/pastes", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("anonymous", func(t *testing.T) {
+		w := create("my-notes", "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, create("my-notes", "Bearer not-a-real-token").Code)
+	})
+
+	t.Run("authenticated", func(t *testing.T) {
+		mockService.On("CreatePasteWithSlug", mock.Anything, "my-notes", "hi", "text", 0).
+			Return(&db.Paste{ID: "my-notes", Content: "hi", Language: "text"}, nil).Once()
+		w := create("my-notes", "Bearer alice-api-token-0001")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"id":"my-notes"`)
+	})
+
+	t.Run("taken", func(t *testing.T) {
+		mockService.On("CreatePasteWithSlug", mock.Anything, "api", "hi", "text", 0).
+			Return(nil, pasteService.ErrSlugTaken).Once()
+		assert.Equal(t, http.StatusConflict, create("api", "Bearer alice-api-token-0001").Code)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		mockService.On("CreatePasteWithSlug", mock.Anything, "no spaces", "hi", "text", 0).
+			Return(nil, pasteService.ErrInvalidSlug).Once()
+		assert.Equal(t, http.StatusBadRequest, create("no spaces", "Bearer alice-api-token-0001").Code)
+	})
+	mockService.AssertExpectations(t)
+}
+
+func TestRevisionsHandler(t *testing.T) {
+	mockService := new(MockPasteService)
+	router := setupRouter(httpHandler.NewHandler(mockService))
+
+	mockService.On("ListRevisions", mock.Anything, "abc123").
+		Return([]db.Revision{{ID: 2, PasteID: "abc123", Content: "v2", Language: "go"}}, nil).Once()
+	mockService.On("ListRevisions", mock.Anything, "gone").Return(nil, pasteService.ErrPasteExpired).Once()
+
+	req := httptest.NewRequest("GET", "/pastes/abc123/revisions", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var revs []db.Revision
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&revs))
+	require.Len(t, revs, 1)
+	assert.Equal(t, "v2", revs[0].Content)
+
+	req = httptest.NewRequest("GET", "/pastes/gone/revisions", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusGone, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestParticipantsHandler(t *testing.T) {
+	mockService := new(MockPasteService)
+	router := setupRouter(httpHandler.NewHandler(mockService))
+
+	mockService.On("GetPaste", mock.Anything, "abc123").Return(&db.Paste{ID: "abc123"}, nil).Once()
+	mockService.On("GetPaste", mock.Anything, "missing").Return(nil, pasteService.ErrPasteNotFound).Once()
+
+	req := httptest.NewRequest("GET", "/pastes/abc123/participants", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, "[]", w.Body.String(), "no live room means no participants")
+
+	req = httptest.NewRequest("GET", "/pastes/missing/participants", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	mockService.AssertExpectations(t)
+}
@@ -0,0 +1,83 @@
+package httptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	httpHandler "github.com/Sumedhvats/pasteCTL_web/internal/http"
+	pasteService "github.com/Sumedhvats/pasteCTL_web/internal/paste"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	mockService := new(MockPasteService)
+	mockService.On("GetPaste", mock.Anything, "missing").Return(nil, pasteService.ErrPasteNotFound)
+	handler := httpHandler.NewHandler(mockService)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(httpHandler.RequestID())
+	router.GET("/pastes/:id", handler.GetPasteHandler)
+
+	get := func(requestID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/pastes/missing", nil)
+		if requestID != "" {
+			req.Header.Set(httpHandler.RequestIDHeader, requestID)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("echoes a valid incoming ID", func(t *testing.T) {
+		w := get("lb-1234")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "lb-1234", w.Header().Get(httpHandler.RequestIDHeader))
+
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+		assert.Equal(t, "lb-1234", body["request_id"])
+	})
+
+	t.Run("generates an ID when none is sent", func(t *testing.T) {
+		w := get("")
+		id := w.Header().Get(httpHandler.RequestIDHeader)
+		assert.Len(t, id, 32)
+
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+		assert.Equal(t, id, body["request_id"])
+	})
+
+	t.Run("replaces a malformed ID", func(t *testing.T) {
+		w := get("bad id\twith spaces")
+		id := w.Header().Get(httpHandler.RequestIDHeader)
+		assert.NotEqual(t, "bad id\twith spaces", id)
+		assert.Len(t, id, 32)
+	})
+
+	t.Run("access log carries the ID", func(t *testing.T) {
+		logs.Reset()
+		get("trace-me")
+
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+		assert.Equal(t, "request", entry["msg"])
+		assert.Equal(t, "WARN", entry["level"])
+		assert.Equal(t, "trace-me", entry["request_id"])
+		assert.Equal(t, "/pastes/:id", entry["route"])
+		assert.EqualValues(t, http.StatusNotFound, entry["status"])
+	})
+}
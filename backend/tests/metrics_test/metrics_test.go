@@ -0,0 +1,47 @@
+package metricstest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/metrics"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareLabelsByRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(metrics.Middleware())
+	r.GET("/api/pastes/:id", func(c *gin.Context) { c.Status(http.StatusNotFound) })
+	r.GET("/metrics", metrics.Handler())
+
+	for _, id := range []string{"aaaaa", "bbbbb", "ccccc"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/pastes/"+id, nil))
+	}
+	assert.Equal(t, 3.0, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("/api/pastes/:id", "GET", "404")))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `pastectl_http_requests_total{method="GET",route="/api/pastes/:id",status="404"} 3`)
+	assert.NotContains(t, body, "aaaaa")
+	assert.True(t, strings.Contains(body, "go_goroutines"))
+}
+
+func TestLanguageLabelIsBounded(t *testing.T) {
+	assert.Equal(t, "go", metrics.LanguageLabel(" Go "))
+	assert.Equal(t, "other", metrics.LanguageLabel(strings.Repeat("x", 40)))
+
+	seen := map[string]bool{}
+	for i := 0; i < 200; i++ {
+		seen[metrics.LanguageLabel(fmt.Sprintf("lang%d", i))] = true
+	}
+	assert.True(t, seen["other"])
+	assert.LessOrEqual(t, len(seen), 65)
+}
@@ -0,0 +1,153 @@
+package ottest
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/ot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOp_BuildAndJSON(t *testing.T) {
+	var op ot.Op
+	op = op.Retain(2).Retain(1).Delete(2).Insert("hé").Insert("!").Retain(4)
+	// The insert is moved ahead of the delete and neighbours are merged.
+	assert.Equal(t, ot.Op{{Retain: 3}, {Insert: "hé!"}, {Delete: 2}, {Retain: 4}}, op)
+	assert.Equal(t, 9, op.BaseLen())
+	assert.Equal(t, 10, op.TargetLen())
+
+	data, err := json.Marshal(op)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[3,"hé!",-2,4]`, string(data))
+
+	var decoded ot.Op
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, op, decoded)
+
+	for _, bad := range []string{`{"a":1}`, `[0]`, `[""]`, `[1.5]`, `[true]`} {
+		assert.ErrorIs(t, json.Unmarshal([]byte(bad), &decoded), ot.ErrInvalidOp, bad)
+	}
+}
+
+func TestApply(t *testing.T) {
+	var op ot.Op
+	op = op.Retain(6).Delete(5).Insert("gophers")
+	out, err := ot.Apply([]rune("hello world"), op)
+	require.NoError(t, err)
+	assert.Equal(t, "hello gophers", string(out))
+
+	_, err = ot.Apply([]rune("short"), op)
+	assert.ErrorIs(t, err, ot.ErrBaseLength)
+}
+
+func TestApply_RejectsOverflowingLengths(t *testing.T) {
+	// The lengths wrap around to 5, the length of the document.
+	const huge = `[9223372036854775807,-9223372036854775807,7]`
+	var decoded ot.Op
+	assert.ErrorIs(t, json.Unmarshal([]byte(huge), &decoded), ot.ErrInvalidOp)
+
+	// Built in code, the same op is refused rather than applied.
+	op := ot.Op{{Retain: math.MaxInt}, {Delete: math.MaxInt}, {Retain: 7}}
+	assert.Equal(t, -1, op.BaseLen())
+	_, err := ot.Apply([]rune("hello"), op)
+	assert.Error(t, err)
+	_, _, err = ot.Transform(op, op)
+	assert.ErrorIs(t, err, ot.ErrInvalidOp)
+
+	// A retain past the end is refused even where the total fits.
+	_, err = ot.Apply([]rune("hello"), ot.Op{{Retain: 7}, {Delete: -2}})
+	assert.Error(t, err)
+}
+
+func TestDiff(t *testing.T) {
+	for _, tc := range [][2]string{
+		{"", "abc"}, {"abc", ""}, {"abc", "abc"}, {"hello world", "hello brave world"},
+		{"aaa", "aa"}, {"héllo", "hallo"}, {"func main() {}", "func main() { run() }"},
+	} {
+		op := ot.Diff([]rune(tc[0]), []rune(tc[1]))
+		out, err := ot.Apply([]rune(tc[0]), op)
+		require.NoError(t, err)
+		assert.Equal(t, tc[1], string(out))
+	}
+	assert.True(t, ot.Diff([]rune("same"), []rune("same")).IsNoop())
+}
+
+func TestTransform_TieBreak(t *testing.T) {
+	doc := []rune("ab")
+	var a, b ot.Op
+	a = a.Retain(1).Insert("X").Retain(1)
+	b = b.Retain(1).Insert("Y").Retain(1)
+	a1, b1, err := ot.Transform(a, b)
+	require.NoError(t, err)
+	left, _ := ot.Apply(doc, a)
+	left, _ = ot.Apply(left, b1)
+	right, _ := ot.Apply(doc, b)
+	right, _ = ot.Apply(right, a1)
+	assert.Equal(t, "aXYb", string(left))
+	assert.Equal(t, string(left), string(right))
+}
+
+func randomOp(r *rand.Rand, doc []rune) ot.Op {
+	var op ot.Op
+	i := 0
+	for i < len(doc) {
+		n := 1 + r.Intn(len(doc)-i)
+		switch r.Intn(3) {
+		case 0:
+			op = op.Retain(n)
+		case 1:
+			op = op.Delete(n)
+		default:
+			op = op.Insert(string([]rune("xyzé✓")[r.Intn(5)])).Retain(n)
+		}
+		i += n
+	}
+	if r.Intn(2) == 0 {
+		op = op.Insert("end")
+	}
+	return op
+}
+
+func TestTransform_Converges(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		doc := []rune("the quick brown fox"[:r.Intn(20)])
+		a, b := randomOp(r, doc), randomOp(r, doc)
+		a1, b1, err := ot.Transform(a, b)
+		require.NoError(t, err)
+
+		left, err := ot.Apply(doc, a)
+		require.NoError(t, err)
+		left, err = ot.Apply(left, b1)
+		require.NoError(t, err)
+		right, err := ot.Apply(doc, b)
+		require.NoError(t, err)
+		right, err = ot.Apply(right, a1)
+		require.NoError(t, err)
+		require.Equal(t, string(left), string(right), "doc %q a %v b %v", string(doc), a, b)
+	}
+
+	_, _, err := ot.Transform(ot.Op{}.Retain(1), ot.Op{}.Retain(2))
+	assert.ErrorIs(t, err, ot.ErrBaseLength)
+}
+
+func TestTransformIndex(t *testing.T) {
+	// "hello world" with "big " inserted at 6 and "wor" deleted.
+	op := ot.Op{}.Retain(6).Insert("big ").Delete(3).Retain(2)
+	cases := map[int]int{
+		0:  0,
+		5:  5,
+		6:  10, // text inserted at the cursor lands before it
+		7:  10, // inside the deletion: moves to its start
+		9:  10,
+		10: 11,
+		11: 12,
+	}
+	for in, want := range cases {
+		assert.Equal(t, want, ot.TransformIndex(in, op), "index %d", in)
+	}
+	assert.Equal(t, 3, ot.TransformIndex(1, ot.Op{}.Insert("ğö").Retain(5)), "counts code points")
+}
@@ -0,0 +1,31 @@
+package pkgtest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Sumedhvats/pasteCTL_web/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIDGenerator(t *testing.T) {
+	gen := pkg.IDGenerator{Length: 20, Alphabet: "abc"}
+	seen := make(map[string]bool)
+	counts := make(map[rune]int)
+	for i := 0; i < 3000; i++ {
+		id := gen.New()
+		assert.Len(t, id, 20)
+		seen[id] = true
+		for _, r := range id {
+			assert.True(t, strings.ContainsRune("abc", r), "unexpected %q", r)
+			counts[r]++
+		}
+	}
+	assert.Greater(t, len(seen), 2998, "IDs should practically never repeat")
+	// 60000 draws over 3 characters: each should land near 20000.
+	for r, n := range counts {
+		assert.InDelta(t, 20000, n, 1000, "character %q is biased", r)
+	}
+
+	assert.Len(t, pkg.GenerateId(5), 5)
+}
@@ -0,0 +1,224 @@
+package servicetest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	pasteService "github.com/Sumedhvats/pasteCTL_web/internal/paste"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// These cases run against the in-memory repository so they need no Docker.
+
+func TestPasteService_Memory_CreateUpdateGet(t *testing.T) {
+	service := pasteService.NewPasteService(db.NewMemoryRepo())
+	ctx := context.Background()
+
+	created, err := service.CreatePaste(ctx, "original content", "text", 10)
+	require.NoError(t, err)
+
+	_, err = service.UpdatePaste(ctx, created.ID, "updated content!", "markdown")
+	require.NoError(t, err)
+	_, err = service.UpdateViews(ctx, created.ID, 2)
+	require.NoError(t, err)
+
+	fetched, err := service.GetPaste(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "updated content!", fetched.Content)
+	assert.Equal(t, "markdown", fetched.Language)
+	assert.Equal(t, 2, fetched.Views)
+}
+
+func TestPasteService_Memory_Expiry(t *testing.T) {
+	service := pasteService.NewPasteService(db.NewMemoryRepo())
+	ctx := context.Background()
+
+	_, err := service.GetPaste(ctx, "non-existent-id")
+	assert.ErrorIs(t, err, pasteService.ErrPasteNotFound)
+
+	expired, err := service.CreatePaste(ctx, "I am expired", "text", -5)
+	require.NoError(t, err)
+	active, err := service.CreatePaste(ctx, "I am still active", "text", 30)
+	require.NoError(t, err)
+
+	_, err = service.GetPaste(ctx, expired.ID)
+	assert.ErrorIs(t, err, pasteService.ErrPasteExpired)
+
+	deleted, err := service.DeleteExpiredPastes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	_, err = service.GetPaste(ctx, expired.ID)
+	assert.ErrorIs(t, err, pasteService.ErrPasteNotFound)
+	_, err = service.GetPaste(ctx, active.ID)
+	assert.NoError(t, err)
+}
+
+func TestPasteService_Memory_Stats(t *testing.T) {
+	repo := db.NewMemoryRepo()
+	service := pasteService.NewPasteService(repo)
+	ctx := context.Background()
+
+	created, err := service.CreatePaste(ctx, "shared snippet", "go", 0)
+	require.NoError(t, err)
+	require.NotEmpty(t, created.OwnerToken)
+
+	fetched, err := service.GetPaste(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Empty(t, fetched.OwnerToken, "the token is only returned at creation")
+
+	_, err = service.GetStats(ctx, created.ID, "")
+	assert.ErrorIs(t, err, pasteService.ErrNotOwner)
+	_, err = service.GetStats(ctx, created.ID, "not-the-token")
+	assert.ErrorIs(t, err, pasteService.ErrNotOwner)
+	_, err = service.GetStats(ctx, "missing", created.OwnerToken)
+	assert.ErrorIs(t, err, pasteService.ErrPasteNotFound)
+
+	now := time.Now()
+	require.NoError(t, repo.RecordEvents(ctx, []db.Event{
+		{PasteID: created.ID, Kind: db.EventView, Visitor: "a", Referrer: "example.com", At: now.Add(-25 * time.Hour)},
+		{PasteID: created.ID, Kind: db.EventView, Visitor: "b", At: now.Add(-time.Minute)},
+		{PasteID: created.ID, Kind: db.EventDownload, Visitor: "b", At: now.Add(-time.Minute)},
+	}))
+	rolled, err := service.RollupStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), rolled)
+
+	stats, err := service.GetStats(ctx, created.ID, created.OwnerToken)
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, stats.PasteID)
+	assert.Equal(t, int64(2), stats.UniqueViewers)
+	assert.Equal(t, map[string]int64{db.EventView: 2, db.EventDownload: 1}, stats.Totals)
+	require.Len(t, stats.Hourly, 2)
+	assert.Equal(t, int64(1), stats.Hourly[1].Counts[db.EventDownload])
+	assert.NotEmpty(t, stats.Daily)
+	var dailyViews int64
+	for _, b := range stats.Daily {
+		dailyViews += b.Counts[db.EventView]
+	}
+	assert.Equal(t, int64(2), dailyViews)
+	assert.Equal(t, []db.ReferrerCount{{Domain: "example.com", Count: 1}}, stats.Referrers)
+}
+
+func TestPasteService_Memory_IDs(t *testing.T) {
+	service := pasteService.NewPasteServiceWithOptions(db.NewMemoryRepo(), pasteService.Options{
+		IDLength:   12,
+		IDAlphabet: "ab",
+	})
+	ctx := context.Background()
+
+	p, err := service.CreatePaste(ctx, "x", "text", 0)
+	require.NoError(t, err)
+	assert.Regexp(t, `^[ab]{12}$`, p.ID)
+
+	// With one possible ID the second paste collides every time, and the
+	// service gives up rather than overwriting the first.
+	service = pasteService.NewPasteServiceWithOptions(db.NewMemoryRepo(), pasteService.Options{
+		IDLength:   4,
+		IDAlphabet: "z",
+	})
+	_, err = service.CreatePaste(ctx, "first", "text", 0)
+	require.NoError(t, err)
+	_, err = service.CreatePaste(ctx, "second", "text", 0)
+	assert.ErrorContains(t, err, "unique ID")
+}
+
+func TestPasteService_Memory_Slugs(t *testing.T) {
+	service := pasteService.NewPasteServiceWithOptions(db.NewMemoryRepo(), pasteService.Options{
+		ReservedSlugs: []string{"Team"},
+	})
+	ctx := context.Background()
+
+	p, err := service.CreatePasteWithSlug(ctx, "release-notes_v2", "notes", "markdown", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "release-notes_v2", p.ID)
+	assert.NotEmpty(t, p.OwnerToken)
+	fetched, err := service.GetPaste(ctx, "release-notes_v2")
+	require.NoError(t, err)
+	assert.Equal(t, "notes", fetched.Content)
+
+	_, err = service.CreatePasteWithSlug(ctx, "release-notes_v2", "again", "text", 0)
+	assert.ErrorIs(t, err, pasteService.ErrSlugTaken)
+	for _, reserved := range []string{"api", "RAW", "team"} {
+		_, err = service.CreatePasteWithSlug(ctx, reserved, "x", "text", 0)
+		assert.ErrorIs(t, err, pasteService.ErrSlugTaken, reserved)
+	}
+	for _, bad := range []string{"ab", "-lead", "trail_", "has space", "dots.not.ok", strings.Repeat("x", 65)} {
+		_, err = service.CreatePasteWithSlug(ctx, bad, "x", "text", 0)
+		assert.ErrorIs(t, err, pasteService.ErrInvalidSlug, bad)
+	}
+}
+
+func TestPasteService_Memory_Revisions(t *testing.T) {
+	service := pasteService.NewPasteService(db.NewMemoryRepo())
+	ctx := context.Background()
+
+	created, err := service.CreatePaste(ctx, "v0", "text", 10)
+	require.NoError(t, err)
+	revs, err := service.ListRevisions(ctx, created.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, revs, "an empty list, not null, for the JSON response")
+	assert.Empty(t, revs)
+
+	for _, content := range []string{"v1", "v2"} {
+		_, err = service.UpdatePaste(ctx, created.ID, content, "go")
+		require.NoError(t, err)
+	}
+	revs, err = service.ListRevisions(ctx, created.ID)
+	require.NoError(t, err)
+	require.Len(t, revs, 2)
+	assert.Equal(t, "v2", revs[0].Content)
+	assert.Equal(t, "v1", revs[1].Content)
+
+	_, err = service.ListRevisions(ctx, "missing")
+	assert.ErrorIs(t, err, pasteService.ErrPasteNotFound)
+}
+
+func TestPasteService_Memory_CheckOwner(t *testing.T) {
+	service := pasteService.NewPasteService(db.NewMemoryRepo())
+	ctx := context.Background()
+
+	created, err := service.CreatePaste(ctx, "text", "text", 0)
+	require.NoError(t, err)
+	assert.NoError(t, service.CheckOwner(ctx, created.ID, created.OwnerToken))
+	assert.ErrorIs(t, service.CheckOwner(ctx, created.ID, ""), pasteService.ErrNotOwner)
+	assert.ErrorIs(t, service.CheckOwner(ctx, created.ID, "not-the-token"), pasteService.ErrNotOwner)
+	assert.ErrorIs(t, service.CheckOwner(ctx, "missing", created.OwnerToken), pasteService.ErrPasteNotFound)
+}
+
+func TestPasteService_Memory_CheckEditor(t *testing.T) {
+	service := pasteService.NewPasteService(db.NewMemoryRepo())
+	ctx := context.Background()
+
+	created, err := service.CreatePaste(ctx, "text", "text", 0)
+	require.NoError(t, err)
+	require.NotEmpty(t, created.EditToken)
+	assert.NotEqual(t, created.OwnerToken, created.EditToken)
+	assert.NoError(t, service.CheckEditor(ctx, created.ID, created.OwnerToken))
+	assert.NoError(t, service.CheckEditor(ctx, created.ID, created.EditToken))
+	assert.ErrorIs(t, service.CheckEditor(ctx, created.ID, ""), pasteService.ErrNotEditor)
+	assert.ErrorIs(t, service.CheckEditor(ctx, created.ID, "not-the-token"), pasteService.ErrNotEditor)
+	assert.ErrorIs(t, service.CheckEditor(ctx, "missing", created.EditToken), pasteService.ErrPasteNotFound)
+
+	// The edit token does not open the stats.
+	assert.ErrorIs(t, service.CheckOwner(ctx, created.ID, created.EditToken), pasteService.ErrNotOwner)
+	_, err = service.GetStats(ctx, created.ID, created.EditToken)
+	assert.ErrorIs(t, err, pasteService.ErrNotOwner)
+}
+
+func TestPasteService_Memory_LegacyPastesStayOpen(t *testing.T) {
+	repo := db.NewMemoryRepo()
+	service := pasteService.NewPasteService(repo)
+	ctx := context.Background()
+
+	// Pastes created before the tokens existed have no hashes.
+	require.NoError(t, repo.CreatePaste(ctx, &db.Paste{ID: "legacy", Content: "text", Language: "text"}))
+	assert.NoError(t, service.CheckEditor(ctx, "legacy", ""))
+	assert.NoError(t, service.CheckEditor(ctx, "legacy", "anything"))
+	// Nobody owns them, though.
+	assert.ErrorIs(t, service.CheckOwner(ctx, "legacy", ""), pasteService.ErrNotOwner)
+}
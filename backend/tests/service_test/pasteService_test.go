@@ -2,12 +2,11 @@ package servicetest
 
 import (
 	"context"
-	"os"
-	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	"github.com/Sumedhvats/pasteCTL_web/internal/migrate"
 	pasteService "github.com/Sumedhvats/pasteCTL_web/internal/paste"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -24,7 +23,6 @@ func setupServiceTest(t *testing.T) pasteService.PasteService {
 	ctx := context.Background()
 	pgContainer, err := postgres.Run(ctx,
 		"postgres",
-		postgres.WithInitScripts(filepath.Join("..","testDATA_DB", "testdata.sql")),
 		postgres.WithDatabase(dbName),
 		postgres.WithUsername(dbUser),
 		postgres.WithPassword(dbPassword),
@@ -45,19 +43,31 @@ func setupServiceTest(t *testing.T) pasteService.PasteService {
 
 	connString, err := pgContainer.ConnectionString(ctx, "sslmode=disable")
 	assert.NoError(t, err)
-	os.Setenv("DATABASE_URL", connString)
-db.Init()
-repo:=db.NewRepo()
-service:=pasteService.NewPasteService(repo)
-return service
+	pool, err := db.Open(ctx, db.Config{URL: connString})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	migrator, err := migrate.NewPostgres(pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	repo := db.NewRepo(pool, db.DefaultQueryTimeout)
+	service := pasteService.NewPasteService(repo)
+	return service
 
 }
 
 func TestPasteService_CreateAndGet(t *testing.T) {
 	service := setupServiceTest(t)
+	ctx := context.Background()
 
 	// Test case: Creating a paste with empty content should fail
-	_, err := service.CreatePaste("", "go", 0)
+	_, err := service.CreatePaste(ctx, "", "go", 0)
 	assert.EqualError(t, err, "content and language required")
 
 
@@ -65,7 +75,7 @@ func TestPasteService_CreateAndGet(t *testing.T) {
 	lang := "go"
 	expireMinutes := 10
 
-	createdPaste, err := service.CreatePaste(content, lang, expireMinutes)
+	createdPaste, err := service.CreatePaste(ctx, content, lang, expireMinutes)
 	require.NoError(t, err) 
 	require.NotNil(t, createdPaste)
 
@@ -73,7 +83,7 @@ func TestPasteService_CreateAndGet(t *testing.T) {
 	assert.Equal(t, content, createdPaste.Content)
 	assert.WithinDuration(t, time.Now().Add(10*time.Minute), *createdPaste.ExpireAt, time.Second)
 
-	fetchedPaste, err := service.GetPaste(createdPaste.ID)
+	fetchedPaste, err := service.GetPaste(ctx, createdPaste.ID)
 	require.NoError(t, err)
 	require.NotNil(t, fetchedPaste)
 
@@ -83,19 +93,20 @@ func TestPasteService_CreateAndGet(t *testing.T) {
 
 func TestPasteService_Update(t *testing.T) {
 	service := setupServiceTest(t)
+	ctx := context.Background()
 
 	// 1. Create an initial paste
-	original, err := service.CreatePaste("original content", "text", 10)
+	original, err := service.CreatePaste(ctx, "original content", "text", 10)
 	require.NoError(t, err)
 
 	// 2. Update the paste
 	newContent := "updated content!"
 	newLang := "markdown"
-	updatedPaste, err := service.UpdatePaste(original.ID, newContent, newLang)
+	updatedPaste, err := service.UpdatePaste(ctx, original.ID, newContent, newLang)
 	require.NoError(t, err)
 	require.NotNil(t, updatedPaste)
 	assert.Equal(t, newContent, updatedPaste.Content)
-	verifiedPaste, err := service.GetPaste(original.ID)
+	verifiedPaste, err := service.GetPaste(ctx, original.ID)
 	require.NoError(t, err)
 	require.NotNil(t, verifiedPaste)
 	assert.Equal(t, newContent, verifiedPaste.Content)
@@ -104,53 +115,56 @@ func TestPasteService_Update(t *testing.T) {
 
 func TestPasteService_GetPaste_Scenarios(t *testing.T) {
 	service := setupServiceTest(t)
+	ctx := context.Background()
 
 	// Test case: Getting a paste that does not exist
-	_, err := service.GetPaste("non-existent-id")
+	_, err := service.GetPaste(ctx, "non-existent-id")
 
 	assert.ErrorIs(t, err, pasteService.ErrPasteNotFound)
 
-	expiredPaste, err := service.CreatePaste("this will expire", "text", -1) // Expired 1 minute ago
+	expiredPaste, err := service.CreatePaste(ctx, "this will expire", "text", -1) // Expired 1 minute ago
 	require.NoError(t, err)
 
-	_, err = service.GetPaste(expiredPaste.ID)
+	_, err = service.GetPaste(ctx, expiredPaste.ID)
 	assert.ErrorIs(t, err, pasteService.ErrPasteExpired)
 }
 
 func TestPasteService_UpdateViews(t *testing.T) {
 	service := setupServiceTest(t)
+	ctx := context.Background()
 
 	// 1. Create a paste, which starts with 0 views
-	paste, err := service.CreatePaste("a paste to be viewed", "text", 10)
+	paste, err := service.CreatePaste(ctx, "a paste to be viewed", "text", 10)
 	require.NoError(t, err)
 
 
 	assert.Equal(t, 0, paste.Views)
 
-	_, err = service.UpdateViews(paste.ID, 5) // Set view count to 5
+	_, err = service.UpdateViews(ctx, paste.ID, 5) // Set view count to 5
 	require.NoError(t, err)
 
-	fetchedPaste, err := service.GetPaste(paste.ID)
+	fetchedPaste, err := service.GetPaste(ctx, paste.ID)
 	require.NoError(t, err)
 	assert.Equal(t, 5, fetchedPaste.Views)
 }
 
 func TestPasteService_DeleteExpiredPastes(t *testing.T) {
 	service := setupServiceTest(t)
+	ctx := context.Background()
 
 	// 1. Create one paste that is expired and one that is not
-	expiredPaste, err := service.CreatePaste("I am expired", "text", -5) // Expired 5 minutes ago
+	expiredPaste, err := service.CreatePaste(ctx, "I am expired", "text", -5) // Expired 5 minutes ago
 	require.NoError(t, err)
 
-	activePaste, err := service.CreatePaste("I am still active", "text", 30) // Expires in 30 minutes
+	activePaste, err := service.CreatePaste(ctx, "I am still active", "text", 30) // Expires in 30 minutes
 	require.NoError(t, err)
 
-	err = service.DeleteExpiredPastes()
+	_, err = service.DeleteExpiredPastes(ctx)
 	require.NoError(t, err)
 
-	_, err = service.GetPaste(expiredPaste.ID)
+	_, err = service.GetPaste(ctx, expiredPaste.ID)
 	assert.ErrorIs(t, err, pasteService.ErrPasteNotFound)
 
-	_, err = service.GetPaste(activePaste.ID)
+	_, err = service.GetPaste(ctx, activePaste.ID)
 	assert.NoError(t, err)
 }
@@ -0,0 +1,63 @@
+package tracingtest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	httpHandler "github.com/Sumedhvats/pasteCTL_web/internal/http"
+	pasteService "github.com/Sumedhvats/pasteCTL_web/internal/paste"
+	"github.com/Sumedhvats/pasteCTL_web/internal/tracing"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSpansAcrossLayers(t *testing.T) {
+	_, err := tracing.Setup(context.Background(), tracing.Config{Exporter: "off"})
+	require.NoError(t, err)
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+
+	svc := pasteService.NewPasteService(db.WithTracing(db.NewMemoryRepo(), "memory"))
+	secret := "super secret paste body"
+	p, err := svc.CreatePaste(context.Background(), secret, "go", 0)
+	require.NoError(t, err)
+	recorder.Reset()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(tracing.Middleware()...)
+	r.GET("/api/pastes/:id", httpHandler.NewHandler(svc).GetPasteHandler)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("GET", "/api/pastes/"+p.ID, nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	spans := recorder.Ended()
+	names := make([]string, 0, len(spans))
+	for _, s := range spans {
+		names = append(names, s.Name())
+		assert.Equal(t, traceID, s.SpanContext().TraceID().String(), "span %s should continue the incoming trace", s.Name())
+
+		var hasID bool
+		for _, kv := range s.Attributes() {
+			assert.NotContains(t, kv.Value.Emit(), secret, "span %s leaks paste content", s.Name())
+			if kv.Key == tracing.AttrPasteID && kv.Value.AsString() == p.ID {
+				hasID = true
+			}
+		}
+		assert.True(t, hasID, "span %s should carry paste.id", s.Name())
+	}
+	assert.ElementsMatch(t, []string{"db.GetPaste", "PasteService.GetPaste", "GET /api/pastes/:id"}, names)
+}
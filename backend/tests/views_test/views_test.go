@@ -0,0 +1,117 @@
+package views_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	"github.com/Sumedhvats/pasteCTL_web/internal/views"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStore struct {
+	mu    sync.Mutex
+	calls map[string][]int
+	err   error
+}
+
+func (s *fakeStore) UpdateViews(ctx context.Context, id string, count int) (*db.Paste, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	if s.calls == nil {
+		s.calls = make(map[string][]int)
+	}
+	s.calls[id] = append(s.calls[id], count)
+	return &db.Paste{ID: id}, nil
+}
+
+func TestCounter_BatchesIncrements(t *testing.T) {
+	store := &fakeStore{}
+	counter := views.NewCounter(store, views.Options{DedupWindow: time.Hour})
+
+	assert.True(t, counter.Record("hot", "alice"))
+	assert.True(t, counter.Record("hot", "bob"))
+	assert.True(t, counter.Record("hot", "carol"))
+	assert.True(t, counter.Record("cold", "alice"))
+	assert.Equal(t, 3, counter.Pending("hot"))
+
+	require.NoError(t, counter.Flush(context.Background()))
+	assert.Equal(t, []int{3}, store.calls["hot"], "one write per paste per flush")
+	assert.Equal(t, []int{1}, store.calls["cold"])
+	assert.Zero(t, counter.Pending("hot"))
+
+	// Nothing pending means nothing written.
+	require.NoError(t, counter.Flush(context.Background()))
+	assert.Len(t, store.calls["hot"], 1)
+}
+
+func TestCounter_DeduplicatesWithinWindow(t *testing.T) {
+	counter := views.NewCounter(&fakeStore{}, views.Options{DedupWindow: 50 * time.Millisecond})
+
+	assert.True(t, counter.Record("p", "alice"))
+	assert.False(t, counter.Record("p", "alice"), "repeat inside the window")
+	assert.True(t, counter.Record("q", "alice"), "other pastes are counted separately")
+	assert.Equal(t, 1, counter.Pending("p"))
+
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, counter.Record("p", "alice"), "window has passed")
+	assert.Equal(t, 2, counter.Pending("p"))
+}
+
+func TestCounter_ZeroWindowCountsEverything(t *testing.T) {
+	counter := views.NewCounter(&fakeStore{}, views.Options{})
+	for i := 0; i < 5; i++ {
+		assert.True(t, counter.Record("p", "alice"))
+	}
+	assert.Equal(t, 5, counter.Pending("p"))
+}
+
+func TestCounter_MaxTrackedDropsNewVisitors(t *testing.T) {
+	counter := views.NewCounter(&fakeStore{}, views.Options{DedupWindow: time.Hour, MaxTracked: 2})
+
+	assert.True(t, counter.Record("p", "a"))
+	assert.True(t, counter.Record("p", "b"))
+	assert.False(t, counter.Record("p", "c"))
+	assert.Equal(t, 2, counter.Pending("p"))
+}
+
+func TestCounter_FailedFlushKeepsCounts(t *testing.T) {
+	store := &fakeStore{err: errors.New("database down")}
+	counter := views.NewCounter(store, views.Options{})
+
+	counter.Record("p", "alice")
+	counter.Record("p", "bob")
+	require.Error(t, counter.Flush(context.Background()))
+	assert.Equal(t, 2, counter.Pending("p"))
+
+	counter.Record("p", "carol")
+	store.err = nil
+	require.NoError(t, counter.Flush(context.Background()))
+	assert.Equal(t, []int{3}, store.calls["p"])
+}
+
+func TestCounter_ConcurrentRecord(t *testing.T) {
+	store := &fakeStore{}
+	counter := views.NewCounter(store, views.Options{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				counter.Record("p", "v")
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, counter.Flush(context.Background()))
+	assert.Equal(t, []int{1000}, store.calls["p"])
+}
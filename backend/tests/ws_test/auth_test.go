@@ -0,0 +1,114 @@
+package wstest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/ot"
+	pasteService "github.com/Sumedhvats/pasteCTL_web/internal/paste"
+	"github.com/Sumedhvats/pasteCTL_web/internal/ws"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHub_ChecksOrigin(t *testing.T) {
+	_, url, _ := newConfiguredServer(t, func(hub *ws.Hub) {
+		hub.AllowedOrigins = []string{"https://paste.example.com"}
+	})
+	for origin, allowed := range map[string]bool{
+		"https://paste.example.com": true,
+		"https://evil.example.com":  false,
+		"":                          true,
+	} {
+		header := http.Header{}
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+		conn, resp, err := websocket.DefaultDialer.Dial(url+"p1", header)
+		if allowed {
+			require.NoError(t, err, origin)
+			conn.Close()
+			continue
+		}
+		require.Error(t, err, origin)
+		require.NotNil(t, resp)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+
+	_, url, _ = newConfiguredServer(t, func(hub *ws.Hub) { hub.AllowedOrigins = []string{"*"} })
+	conn, _, err := websocket.DefaultDialer.Dial(url+"p1", http.Header{"Origin": {"https://anywhere.example.com"}})
+	require.NoError(t, err, "a wildcard admits every origin")
+	conn.Close()
+}
+
+func TestHub_ViewersCannotEdit(t *testing.T) {
+	hub, url, repo := newConfiguredServer(t, func(hub *ws.Hub) { hub.CanEdit = nil })
+	p, err := pasteService.NewPasteService(repo).CreatePaste(context.Background(), "text", "go", 0)
+	require.NoError(t, err)
+
+	viewer := dial(t, url+p.ID)
+	send(t, viewer, map[string]any{"type": "hello", "token": "wrong"})
+	snap := read(t, viewer)
+	require.Equal(t, "snapshot", snap.Type)
+	assert.True(t, snap.ReadOnly)
+	send(t, viewer, opMessage(0, ot.Op{}.Insert("x").Retain(4)))
+	assert.Equal(t, "read_only", read(t, viewer).Code)
+
+	legacy := dial(t, url+p.ID)
+	send(t, legacy, map[string]any{"type": "content_update", "content": "defaced"})
+	assert.Equal(t, "read_only", read(t, legacy).Code)
+
+	owner := dial(t, url+p.ID)
+	send(t, owner, map[string]any{"type": "hello", "token": p.OwnerToken})
+	snap = read(t, owner)
+	require.Equal(t, "snapshot", snap.Type)
+	assert.False(t, snap.ReadOnly)
+	assert.Equal(t, "text", snap.Content, "viewers' edits were not applied")
+	require.Equal(t, "join", read(t, viewer).Type)
+
+	send(t, owner, opMessage(0, ot.Op{}.Insert("> ").Retain(4)))
+	assert.Equal(t, "ack", read(t, owner).Type)
+	got := read(t, viewer)
+	assert.Equal(t, "op", got.Type, "viewers still receive updates")
+	assert.Equal(t, 1, got.Rev)
+	assert.Equal(t, "content_update", read(t, legacy).Type)
+	require.Eventually(t, func() bool { return hub.Connections(p.ID) == 3 }, time.Second, 5*time.Millisecond)
+
+	// The edit token makes an editor too.
+	collaborator := dial(t, url+p.ID)
+	send(t, collaborator, map[string]any{"type": "hello", "token": p.EditToken})
+	snap = read(t, collaborator)
+	require.Equal(t, "snapshot", snap.Type)
+	assert.False(t, snap.ReadOnly)
+}
+
+func TestHub_PastesWithoutTokensStayOpen(t *testing.T) {
+	// p1 predates edit tokens, so even clients that never say hello edit it.
+	_, url, _ := newConfiguredServer(t, func(hub *ws.Hub) { hub.CanEdit = nil })
+	watcher := dial(t, url+"p1")
+	legacy := dial(t, url+"p1")
+	send(t, legacy, map[string]any{"type": "content_update", "content": "edited"})
+	got := read(t, watcher)
+	assert.Equal(t, "content_update", got.Type)
+	assert.Equal(t, "edited", got.Content)
+
+	conn := dial(t, url+"p1")
+	assert.False(t, hello(t, conn).ReadOnly)
+}
+
+func TestHub_CanEditAdmitsUsers(t *testing.T) {
+	_, url, _ := newConfiguredServer(t, func(hub *ws.Hub) {
+		hub.CanEdit = func(c *gin.Context) bool { return c.GetHeader("Authorization") == "Bearer user-token" }
+	})
+	conn, _, err := websocket.DefaultDialer.Dial(url+"p1", http.Header{"Authorization": {"Bearer user-token"}})
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.False(t, read(t, conn).ReadOnly)
+	assert.False(t, hello(t, conn).ReadOnly)
+	send(t, conn, opMessage(0, ot.Op{}.Retain(2).Insert("!")))
+	assert.Equal(t, "ack", read(t, conn).Type)
+}
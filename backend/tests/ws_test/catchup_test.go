@@ -0,0 +1,82 @@
+package wstest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/ot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHub_GreetsWithTheRoomState(t *testing.T) {
+	_, url := newServer(t)
+	a := dial(t, url+"p1")
+	send(t, a, map[string]any{"type": "hello", "name": "Ada"})
+	require.Equal(t, "snapshot", read(t, a).Type)
+	send(t, a, opMessage(0, ot.Op{}.Retain(2).Insert("!")))
+	require.Equal(t, "ack", read(t, a).Type)
+
+	// The first message a newcomer receives, hello or not, is the state.
+	b := dialRaw(t, url+"p1")
+	snap := read(t, b)
+	assert.Equal(t, "snapshot", snap.Type)
+	assert.NotEmpty(t, snap.Session)
+	assert.Equal(t, 1, snap.Rev)
+	assert.Equal(t, "p1!", snap.Content)
+	assert.Equal(t, "go", snap.Language)
+	require.Len(t, snap.Participants, 1)
+	assert.Equal(t, "Ada", snap.Participants[0].Name)
+	assert.NotEmpty(t, snap.You)
+}
+
+func TestHub_CatchesUpFromLastSeenRevision(t *testing.T) {
+	_, url := newServer(t)
+	a := dial(t, url+"p1")
+	snap := hello(t, a)
+	ops := []ot.Op{ot.Op{}.Retain(2).Insert("a"), ot.Op{}.Retain(3).Insert("b")}
+	for rev, op := range ops {
+		send(t, a, opMessage(rev, op))
+		require.Equal(t, "ack", read(t, a).Type)
+	}
+
+	// A client that saw revision 0 of this session gets the two ops.
+	b := dialRaw(t, fmt.Sprintf("%sp1?session=%s&since=0", url, snap.Session))
+	got := read(t, b)
+	assert.Equal(t, "catch_up", got.Type)
+	assert.Equal(t, snap.Session, got.Session)
+	assert.Equal(t, 0, got.From)
+	assert.Equal(t, 2, got.Rev)
+	assert.Equal(t, ops, got.Ops)
+	assert.Equal(t, "go", got.Language)
+
+	// A hello naming its revision is answered the same way.
+	send(t, b, map[string]any{"type": "hello", "rev": 2, "session": snap.Session})
+	got = read(t, b)
+	assert.Equal(t, "catch_up", got.Type)
+	assert.Equal(t, 2, got.From)
+	assert.Empty(t, got.Ops)
+	assert.Len(t, got.Participants, 2)
+
+	// Revisions of another session, or unknown ones, need the document.
+	for _, query := range []string{"?session=other&since=0", fmt.Sprintf("?session=%s&since=3", snap.Session), "?since=0"} {
+		got = read(t, dialRaw(t, url+"p1"+query))
+		assert.Equal(t, "snapshot", got.Type, query)
+		assert.Equal(t, "p1ab", got.Content, query)
+	}
+}
+
+func TestHub_CatchesUpOnAnotherReplica(t *testing.T) {
+	urlA, urlB, _ := newReplicas(t, same)
+	a := dial(t, urlA+"p1")
+	snap := hello(t, a)
+	b := dial(t, urlB+"p1")
+	send(t, a, opMessage(0, ot.Op{}.Retain(2).Insert("!")))
+	require.Equal(t, "ack", read(t, a).Type)
+	require.Equal(t, "content_update", read(t, b).Type)
+
+	// The session spans replicas, so a client may resume on either.
+	got := read(t, dialRaw(t, fmt.Sprintf("%sp1?session=%s&since=0", urlB, snap.Session)))
+	assert.Equal(t, "catch_up", got.Type)
+	assert.Equal(t, []ot.Op{ot.Op{}.Retain(2).Insert("!")}, got.Ops)
+}
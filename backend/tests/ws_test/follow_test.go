@@ -0,0 +1,84 @@
+package wstest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/ot"
+	pasteService "github.com/Sumedhvats/pasteCTL_web/internal/paste"
+	"github.com/Sumedhvats/pasteCTL_web/internal/ws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func followHub(t *testing.T, hub *ws.Hub, pasteID string) *ws.Follower {
+	t.Helper()
+	f, err := hub.Follow(context.Background(), pasteID)
+	require.NoError(t, err)
+	return f
+}
+
+func TestHub_FollowersSeeEditsFromEveryReplica(t *testing.T) {
+	repo := newRepo(t)
+	bus := ws.NewMemoryBus()
+	configure := func(hub *ws.Hub) {
+		hub.Bus = bus
+		hub.SyncTimeout = 100 * time.Millisecond
+	}
+	_, urlA := serveHub(t, repo, configure)
+	hubB, _ := serveHub(t, repo, configure)
+	a := dial(t, urlA+"p1")
+	hello(t, a)
+
+	f := followHub(t, hubB, "p1")
+	defer f.Close(context.Background())
+	content, language := f.Text()
+	assert.Equal(t, "p1", content)
+	assert.Equal(t, "go", language)
+	assert.Equal(t, 1, hubB.Followers("p1"))
+	assert.Zero(t, hubB.Connections("p1"))
+
+	send(t, a, opMessage(0, ot.Op{}.Retain(2).Insert("!")))
+	require.Equal(t, "ack", read(t, a).Type)
+	select {
+	case <-f.Changed():
+	case <-time.After(time.Second):
+		require.FailNow(t, "the follower was not told")
+	}
+	content, _ = f.Text()
+	assert.Equal(t, "p1!", content)
+}
+
+func TestHub_FollowUnknownPaste(t *testing.T) {
+	hub, _ := newServer(t)
+	_, err := hub.Follow(context.Background(), "missing")
+	assert.ErrorIs(t, err, pasteService.ErrPasteNotFound)
+	assert.Zero(t, hub.Rooms())
+}
+
+func TestHub_ShutdownStopsFollowers(t *testing.T) {
+	hub, url, repo := newServerWithRepo(t, time.Hour)
+	f := followHub(t, hub, "p1")
+	go func() {
+		<-f.Done()
+		f.Close(context.Background())
+	}()
+	a := dial(t, url+"p1")
+	send(t, a, map[string]any{"type": "content_update", "content": "edited"})
+	require.Eventually(t, func() bool {
+		content, _ := f.Text()
+		return content == "edited"
+	}, time.Second, 5*time.Millisecond)
+	a.Close()
+	require.Eventually(t, func() bool { return hub.Connections("p1") == 0 }, time.Second, 5*time.Millisecond)
+
+	// The follower kept the room open; Shutdown saves it and stops the
+	// follower.
+	require.NoError(t, hub.Shutdown(context.Background()))
+	p, err := repo.GetPaste(context.Background(), "p1")
+	require.NoError(t, err)
+	assert.Equal(t, "edited", p.Content)
+	_, err = hub.Follow(context.Background(), "p1")
+	assert.ErrorIs(t, err, ws.ErrShuttingDown)
+}
@@ -0,0 +1,330 @@
+package wstest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	"github.com/Sumedhvats/pasteCTL_web/internal/ot"
+	pasteService "github.com/Sumedhvats/pasteCTL_web/internal/paste"
+	"github.com/Sumedhvats/pasteCTL_web/internal/ws"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type message struct {
+	Type         string           `json:"type"`
+	Session      string           `json:"session"`
+	From         int              `json:"from"`
+	Rev          int              `json:"rev"`
+	Op           ot.Op            `json:"op"`
+	Ops          []ot.Op          `json:"ops"`
+	Content      string           `json:"content"`
+	Language     string           `json:"language"`
+	ReadOnly     bool             `json:"read_only"`
+	Code         string           `json:"code"`
+	Message      string           `json:"message"`
+	You          string           `json:"you"`
+	Participants []ws.Participant `json:"participants"`
+	Participant  ws.Participant   `json:"participant"`
+	ID           string           `json:"id"`
+	Cursor       *ws.Selection    `json:"cursor"`
+}
+
+// newServer serves a hub backed by an in-memory store holding pastes p1
+// and p2, whose content is their ID.
+func newServer(t *testing.T) (*ws.Hub, string) {
+	hub, url, _ := newServerWithRepo(t, time.Hour)
+	return hub, url
+}
+
+// newServerWithRepo is newServer with the hub's save interval set and the
+// store's repository returned, to check what the rooms saved.
+func newServerWithRepo(t *testing.T, saveInterval time.Duration) (*ws.Hub, string, db.Repository) {
+	return newConfiguredServer(t, func(hub *ws.Hub) { hub.SaveInterval = saveInterval })
+}
+
+// newConfiguredServer is newServerWithRepo with the hub set up by
+// configure before it serves.
+func newConfiguredServer(t *testing.T, configure func(*ws.Hub)) (*ws.Hub, string, db.Repository) {
+	t.Helper()
+	repo := newRepo(t)
+	hub, url := serveHub(t, repo, configure)
+	return hub, url, repo
+}
+
+// newRepo returns an in-memory store holding pastes p1 and p2, whose
+// content is their ID.
+func newRepo(t *testing.T) db.Repository {
+	t.Helper()
+	repo := db.NewMemoryRepo()
+	for _, id := range []string{"p1", "p2"} {
+		require.NoError(t, repo.CreatePaste(context.Background(), &db.Paste{ID: id, Content: id, Language: "go"}))
+	}
+	return repo
+}
+
+// serveHub serves a hub over repo, set up by configure, and returns the
+// URL its rooms are under.
+func serveHub(t *testing.T, repo db.Repository, configure func(*ws.Hub)) (*ws.Hub, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	hub := ws.NewHub(pasteService.NewPasteService(repo))
+	hub.SaveInterval = time.Hour
+	// Everyone may edit unless a test says otherwise.
+	hub.CanEdit = func(*gin.Context) bool { return true }
+	configure(hub)
+	r := gin.New()
+	r.GET("/api/ws/:id", hub.PasteHandler)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return hub, "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/ws/"
+}
+
+// dial connects to url and reads the snapshot every connection starts
+// with.
+func dial(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn := dialRaw(t, url)
+	require.Equal(t, "snapshot", read(t, conn).Type)
+	return conn
+}
+
+// dialRaw connects to url without reading anything.
+func dialRaw(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func send(t *testing.T, conn *websocket.Conn, v any) {
+	t.Helper()
+	require.NoError(t, conn.WriteJSON(v))
+}
+
+func read(t *testing.T, conn *websocket.Conn) message {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg message
+	require.NoError(t, conn.ReadJSON(&msg))
+	return msg
+}
+
+// hello joins as a collaborative client and returns the snapshot.
+func hello(t *testing.T, conn *websocket.Conn) message {
+	t.Helper()
+	send(t, conn, map[string]any{"type": "hello"})
+	snap := read(t, conn)
+	require.Equal(t, "snapshot", snap.Type)
+	return snap
+}
+
+func opMessage(rev int, op ot.Op) map[string]any {
+	return map[string]any{"type": "op", "rev": rev, "op": op}
+}
+
+func TestHub_LegacyClients(t *testing.T) {
+	hub, url := newServer(t)
+	a := dial(t, url+"p1")
+	b := dial(t, url+"p1")
+	other := dial(t, url+"p2")
+	require.Eventually(t, func() bool { return hub.Connections("p1") == 2 && hub.Rooms() == 2 }, time.Second, 5*time.Millisecond)
+
+	send(t, a, map[string]any{"type": "content_update", "content": "hello"})
+	got := read(t, b)
+	assert.Equal(t, "content_update", got.Type)
+	assert.Equal(t, "hello", got.Content)
+
+	for _, conn := range []*websocket.Conn{a, other} {
+		conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		_, _, err := conn.ReadMessage()
+		assert.Error(t, err, "neither the sender nor other rooms receive it")
+	}
+}
+
+func TestHub_CollaborativeEditsConverge(t *testing.T) {
+	_, url := newServer(t)
+	a := dial(t, url+"p1")
+	b := dial(t, url+"p1")
+	snap := hello(t, a)
+	assert.Equal(t, "p1", snap.Content)
+	assert.Equal(t, "go", snap.Language)
+	assert.Zero(t, snap.Rev)
+	hello(t, b)
+	require.Equal(t, "join", read(t, a).Type)
+
+	// Both edit revision 0 at once: a prepends, b appends.
+	send(t, a, opMessage(0, ot.Op{}.Insert(">> ").Retain(2)))
+	send(t, b, opMessage(0, ot.Op{}.Retain(2).Insert(" <<")))
+
+	// Whichever the server took first, each side gets an ack for its own
+	// op and the other's op transformed to apply on top.
+	for _, conn := range []*websocket.Conn{a, b} {
+		var types []string
+		for i := 0; i < 2; i++ {
+			types = append(types, read(t, conn).Type)
+		}
+		assert.ElementsMatch(t, []string{"ack", "op"}, types)
+	}
+
+	// A late joiner is sent the current document before anything else.
+	late := dialRaw(t, url+"p1")
+	snap = read(t, late)
+	assert.Equal(t, "snapshot", snap.Type)
+	assert.Equal(t, 2, snap.Rev)
+	assert.Equal(t, ">> p1 <<", snap.Content)
+}
+
+func TestHub_RejectsBadOps(t *testing.T) {
+	_, url := newServer(t)
+	a := dial(t, url+"p1")
+
+	send(t, a, opMessage(0, ot.Op{}.Retain(2).Insert("x")))
+	got := read(t, a)
+	assert.Equal(t, "error", got.Type)
+	assert.Equal(t, "not_joined", got.Code, "ops need a hello first")
+
+	hello(t, a)
+	send(t, a, opMessage(0, ot.Op{}.Retain(5).Insert("x")))
+	assert.Equal(t, "invalid_op", read(t, a).Code, "the op must span the document")
+	send(t, a, opMessage(7, ot.Op{}.Retain(2).Insert("x")))
+	assert.Equal(t, "stale_revision", read(t, a).Code, "unknown revision")
+
+	// Lengths that overflow are malformed, and the room carries on.
+	require.NoError(t, a.WriteMessage(websocket.TextMessage,
+		[]byte(`{"type":"op","rev":0,"op":[9223372036854775807,-9223372036854775807,7]}`)))
+	err := readClose(t, a)
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseInvalidFramePayloadData), "got %v", err)
+	b := dial(t, url+"p1")
+	hello(t, b)
+	send(t, b, opMessage(0, ot.Op{}.Retain(2).Insert("x")))
+	assert.Equal(t, "ack", read(t, b).Type)
+}
+
+func TestHub_LegacyAndCollaborativeInterop(t *testing.T) {
+	_, url := newServer(t)
+	legacy := dial(t, url+"p1")
+	collab := dial(t, url+"p1")
+	hello(t, collab)
+
+	send(t, legacy, map[string]any{"type": "content_update", "content": "p1 and more"})
+	got := read(t, collab)
+	assert.Equal(t, "op", got.Type)
+	assert.Equal(t, 1, got.Rev)
+	assert.Equal(t, ot.Op{}.Retain(2).Insert(" and more"), got.Op)
+
+	send(t, collab, opMessage(1, ot.Op{}.Insert("// ").Retain(11)))
+	assert.Equal(t, "ack", read(t, collab).Type)
+	got = read(t, legacy)
+	assert.Equal(t, "content_update", got.Type)
+	assert.Equal(t, "// p1 and more", got.Content)
+}
+
+func TestHub_UnknownPaste(t *testing.T) {
+	hub, url := newServer(t)
+	conn := dialRaw(t, url+"missing")
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, 4404), "got %v", err)
+	require.Eventually(t, func() bool { return hub.Rooms() == 0 }, time.Second, 5*time.Millisecond)
+}
+
+func TestHub_FreesRoomsOnDisconnect(t *testing.T) {
+	hub, url := newServer(t)
+	a := dial(t, url+"p1")
+	b := dial(t, url+"p1")
+	require.Eventually(t, func() bool { return hub.Connections("p1") == 2 }, time.Second, 5*time.Millisecond)
+
+	a.Close()
+	require.Eventually(t, func() bool { return hub.Connections("p1") == 1 }, time.Second, 5*time.Millisecond)
+	b.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	require.Eventually(t, func() bool { return hub.Rooms() == 0 }, time.Second, 5*time.Millisecond)
+}
+
+func TestHub_ConcurrentClients(t *testing.T) {
+	hub, url := newServer(t)
+	const clients, edits = 8, 20
+
+	conns := make([]*websocket.Conn, clients)
+	for i := range conns {
+		conns[i] = dial(t, url+"p1")
+		hello(t, conns[i])
+	}
+	// Each client has heard everyone after it join.
+	for i, conn := range conns {
+		for range conns[i+1:] {
+			require.Equal(t, "join", read(t, conn).Type)
+		}
+	}
+
+	// Everyone prepends at once against revision 0, leaving the server to
+	// transform each op past all the others.
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < edits; i++ {
+				data, _ := json.Marshal(opMessage(0, ot.Op{}.Insert("x").Retain(2)))
+				assert.NoError(t, conn.WriteMessage(websocket.TextMessage, data))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < clients*edits; i++ {
+				conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+				var msg message
+				if !assert.NoError(t, conn.ReadJSON(&msg)) {
+					return
+				}
+				assert.Contains(t, []string{"ack", "op"}, msg.Type)
+			}
+		}()
+	}
+	wg.Wait()
+
+	snap := hello(t, conns[0])
+	assert.Equal(t, clients*edits, snap.Rev)
+	assert.Equal(t, strings.Repeat("x", clients*edits)+"p1", snap.Content)
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+	require.Eventually(t, func() bool { return hub.Rooms() == 0 }, time.Second, 5*time.Millisecond)
+}
+
+func TestHub_Shutdown(t *testing.T) {
+	hub, url := newServer(t)
+	conn := dial(t, url+"p1")
+	require.Eventually(t, func() bool { return hub.Connections("p1") == 1 }, time.Second, 5*time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		done <- hub.Shutdown(ctx)
+	}()
+
+	// The client sees the restart close code and, by closing in reply,
+	// lets its handler return.
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseServiceRestart), "got %v", err)
+	conn.Close()
+	require.NoError(t, <-done)
+
+	// Connections arriving during shutdown are turned away.
+	late := dialRaw(t, url+"p1")
+	late.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = late.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseServiceRestart), "got %v", err)
+}
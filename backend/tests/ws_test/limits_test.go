@@ -0,0 +1,86 @@
+package wstest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/ot"
+	"github.com/Sumedhvats/pasteCTL_web/internal/ws"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHub_CapsRoomConnections(t *testing.T) {
+	hub, url, _ := newConfiguredServer(t, func(hub *ws.Hub) { hub.MaxRoomConnections = 2 })
+	dial(t, url+"p1")
+	dial(t, url+"p1")
+	require.Eventually(t, func() bool { return hub.Connections("p1") == 2 }, time.Second, 5*time.Millisecond)
+
+	err := readClose(t, dialRaw(t, url+"p1"))
+	assert.True(t, websocket.IsCloseError(err, 4429), "got %v", err)
+	assert.Equal(t, 2, hub.Connections("p1"))
+	hello(t, dial(t, url+"p2"))
+}
+
+func TestHub_FollowersCountTowardRoomCap(t *testing.T) {
+	hub, url, _ := newConfiguredServer(t, func(hub *ws.Hub) { hub.MaxRoomConnections = 2 })
+	ctx := context.Background()
+	dial(t, url+"p1")
+	require.Eventually(t, func() bool { return hub.Connections("p1") == 1 }, time.Second, 5*time.Millisecond)
+	f, err := hub.Follow(ctx, "p1")
+	require.NoError(t, err)
+
+	// The room is full for connections and followers alike.
+	err = readClose(t, dialRaw(t, url+"p1"))
+	assert.True(t, websocket.IsCloseError(err, 4429), "got %v", err)
+	_, err = hub.Follow(ctx, "p1")
+	assert.ErrorIs(t, err, ws.ErrRoomFull)
+
+	f.Close(ctx)
+	f, err = hub.Follow(ctx, "p1")
+	require.NoError(t, err, "a follower leaving makes room")
+	f.Close(ctx)
+}
+
+func TestHub_LimitsMessageRate(t *testing.T) {
+	_, url, _ := newConfiguredServer(t, func(hub *ws.Hub) {
+		hub.MessageRate = 1
+		hub.MessageBurst = 3
+	})
+	conn := dial(t, url+"p1")
+	for i := 0; i < 3; i++ {
+		hello(t, conn)
+	}
+
+	// The burst is spent; one more message at once is too many.
+	send(t, conn, map[string]any{"type": "hello"})
+	err := readClose(t, conn)
+	assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "got %v", err)
+}
+
+func TestHub_DisconnectsSlowConsumers(t *testing.T) {
+	hub, url, _ := newConfiguredServer(t, func(hub *ws.Hub) {
+		hub.SendQueueSize = 4
+		hub.WriteTimeout = 100 * time.Millisecond
+		hub.MessageBurst = 1000
+	})
+	a := dial(t, url+"p1")
+	hello(t, a)
+	// A legacy client that never reads is sent the whole text after every
+	// edit, until its connection stops taking writes.
+	dial(t, url+"p1")
+	require.Eventually(t, func() bool { return hub.Connections("p1") == 2 }, time.Second, 5*time.Millisecond)
+
+	chunk := strings.Repeat("x", 100_000)
+	length := 2
+	for rev := 0; hub.Connections("p1") == 2; rev++ {
+		require.Less(t, rev, 200, "the slow client was never disconnected")
+		send(t, a, opMessage(rev, ot.Op{}.Retain(length).Insert(chunk)))
+		require.Equal(t, "ack", read(t, a).Type, "the room keeps serving the others")
+		length += len(chunk)
+	}
+	assert.Equal(t, 1, hub.Connections("p1"))
+}
@@ -0,0 +1,118 @@
+package wstest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/ot"
+	"github.com/Sumedhvats/pasteCTL_web/internal/ws"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func helloAs(t *testing.T, conn *websocket.Conn, name, color string) message {
+	t.Helper()
+	send(t, conn, map[string]any{"type": "hello", "name": name, "color": color})
+	snap := read(t, conn)
+	require.Equal(t, "snapshot", snap.Type)
+	return snap
+}
+
+func cursorMessage(rev, anchor, head int) map[string]any {
+	return map[string]any{"type": "cursor", "rev": rev, "cursor": ws.Selection{Anchor: anchor, Head: head}}
+}
+
+func TestHub_PresenceJoinAndLeave(t *testing.T) {
+	hub, url := newServer(t)
+	a := dial(t, url+"p1")
+	b := dial(t, url+"p1")
+	legacy := dial(t, url+"p1")
+
+	snapA := helloAs(t, a, "  Ada\x07 ", "#00ff00")
+	require.Len(t, snapA.Participants, 1)
+	ada := snapA.Participants[0]
+	assert.Equal(t, ws.Participant{ID: snapA.You, Name: "Ada", Color: "#00FF00"}, ada)
+
+	snapB := helloAs(t, b, strings.Repeat("x", 100), "red")
+	require.Len(t, snapB.Participants, 2)
+	assert.Equal(t, ada, snapB.Participants[0], "participants are listed in the order they joined")
+	bob := snapB.Participants[1]
+	assert.Equal(t, snapB.You, bob.ID)
+	assert.Len(t, bob.Name, 40)
+	assert.Regexp(t, `^#[0-9A-F]{6}$`, bob.Color, "an invalid colour is replaced from the palette")
+
+	joined := read(t, a)
+	assert.Equal(t, "join", joined.Type)
+	assert.Equal(t, bob, joined.Participant)
+
+	// Saying hello again resynchronises without joining twice.
+	assert.Len(t, helloAs(t, b, "", "").Participants, 2)
+	assert.Equal(t, []ws.Participant{ada, bob}, hub.Participants("p1"))
+	assert.Empty(t, hub.Participants("p2"))
+
+	// A new name in a repeated hello is announced as a join of the same ID.
+	helloAs(t, b, "Bob", "")
+	renamed := read(t, a)
+	assert.Equal(t, "join", renamed.Type)
+	assert.Equal(t, bob.ID, renamed.Participant.ID)
+	assert.Equal(t, "Bob", renamed.Participant.Name)
+	assert.Equal(t, bob.Color, renamed.Participant.Color)
+
+	b.Close()
+	left := read(t, a)
+	assert.Equal(t, "leave", left.Type)
+	assert.Equal(t, bob.ID, left.ID)
+	require.Eventually(t, func() bool { return len(hub.Participants("p1")) == 1 }, time.Second, 5*time.Millisecond)
+
+	// Legacy clients take no part in presence.
+	legacy.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, _, err := legacy.ReadMessage()
+	assert.Error(t, err)
+}
+
+func TestHub_CursorsFollowEdits(t *testing.T) {
+	hub, url := newServer(t)
+	a := dial(t, url+"p1")
+	b := dial(t, url+"p1")
+	you := helloAs(t, a, "Ada", "").You
+	helloAs(t, b, "Bob", "")
+	require.Equal(t, "join", read(t, a).Type)
+
+	send(t, a, cursorMessage(0, 0, 2))
+	got := read(t, b)
+	assert.Equal(t, "cursor", got.Type)
+	assert.Equal(t, you, got.ID)
+	assert.Equal(t, &ws.Selection{Anchor: 0, Head: 2}, got.Cursor)
+
+	// b types in front of a's selection, which moves along.
+	send(t, b, opMessage(0, ot.Op{}.Insert(">> ").Retain(2)))
+	require.Equal(t, "ack", read(t, b).Type)
+	require.Equal(t, "op", read(t, a).Type)
+
+	c := dial(t, url+"p1")
+	snap := helloAs(t, c, "Cy", "")
+	require.Len(t, snap.Participants, 3)
+	assert.Equal(t, &ws.Selection{Anchor: 3, Head: 5}, snap.Participants[0].Cursor)
+	assert.Nil(t, hub.Participants("p1")[0].Cursor, "the REST listing leaves cursors out")
+
+	// A cursor reported against an older revision is moved to the current
+	// one before it is relayed.
+	require.Equal(t, "join", read(t, a).Type)
+	require.Equal(t, "join", read(t, b).Type)
+	send(t, a, cursorMessage(0, 1, 1))
+	for _, conn := range []*websocket.Conn{b, c} {
+		got := read(t, conn)
+		assert.Equal(t, 1, got.Rev)
+		assert.Equal(t, &ws.Selection{Anchor: 4, Head: 4}, got.Cursor)
+	}
+
+	// Clearing the cursor and bad cursors.
+	send(t, a, map[string]any{"type": "cursor", "rev": 1, "cursor": nil})
+	assert.Nil(t, read(t, b).Cursor)
+	send(t, a, cursorMessage(1, -1, 0))
+	assert.Equal(t, "error", read(t, a).Type)
+	send(t, a, cursorMessage(7, 0, 0))
+	assert.Equal(t, "error", read(t, a).Type)
+}
@@ -0,0 +1,100 @@
+package wstest
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/ws"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readClose reads until the connection fails and returns the close error.
+func readClose(t *testing.T, conn *websocket.Conn) error {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return err
+		}
+	}
+}
+
+func TestHub_NegotiatesSubprotocol(t *testing.T) {
+	_, url := newServer(t)
+
+	dialer := websocket.Dialer{Subprotocols: []string{"pastectl.v0", ws.Subprotocol}}
+	conn, _, err := dialer.Dial(url+"p1", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, ws.Subprotocol, conn.Subprotocol())
+
+	dialer = websocket.Dialer{Subprotocols: []string{"pastectl.v0"}}
+	_, resp, err := dialer.Dial(url+"p1", nil)
+	require.Error(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	legacy := dial(t, url+"p1")
+	assert.Empty(t, legacy.Subprotocol(), "clients offering no version are still served")
+	hello(t, legacy)
+}
+
+func TestHub_ClosesMalformedFrames(t *testing.T) {
+	hub, url, _ := newConfiguredServer(t, func(hub *ws.Hub) { hub.MaxMessageSize = 64 })
+	cases := []struct {
+		name  string
+		frame int
+		data  string
+		code  int
+	}{
+		{"not json", websocket.TextMessage, "not json", websocket.CloseInvalidFramePayloadData},
+		{"no type", websocket.TextMessage, `{"rev":0}`, websocket.CloseInvalidFramePayloadData},
+		{"missing field", websocket.TextMessage, `{"type":"op","op":[2]}`, websocket.CloseInvalidFramePayloadData},
+		{"wrong field type", websocket.TextMessage, `{"type":"op","rev":"0","op":[2]}`, websocket.CloseInvalidFramePayloadData},
+		{"binary", websocket.BinaryMessage, `{"type":"hello"}`, websocket.CloseUnsupportedData},
+		{"too big", websocket.TextMessage, `{"type":"content_update","content":"` + strings.Repeat("x", 100) + `"}`, websocket.CloseMessageTooBig},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := dial(t, url+"p1")
+			require.NoError(t, conn.WriteMessage(tc.frame, []byte(tc.data)))
+			err := readClose(t, conn)
+			assert.True(t, websocket.IsCloseError(err, tc.code), "got %v", err)
+		})
+	}
+	require.Eventually(t, func() bool { return hub.Rooms() == 0 }, time.Second, 5*time.Millisecond)
+}
+
+func TestHub_UnknownTypeKeepsConnection(t *testing.T) {
+	_, url := newServer(t)
+	conn := dial(t, url+"p1")
+	send(t, conn, map[string]any{"type": "telepathy"})
+	got := read(t, conn)
+	assert.Equal(t, "error", got.Type)
+	assert.Equal(t, "unknown_type", got.Code)
+	hello(t, conn)
+}
+
+func TestHub_DropsSilentConnections(t *testing.T) {
+	hub, url, _ := newConfiguredServer(t, func(hub *ws.Hub) { hub.PingInterval = 50 * time.Millisecond })
+
+	// gorilla answers pings only while the application reads, so a
+	// connection that never reads looks as dead as one behind a lost NAT
+	// mapping.
+	silent := dial(t, url+"p1")
+	alive := dial(t, url+"p2")
+	go func() {
+		for {
+			if _, _, err := alive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	require.Eventually(t, func() bool { return hub.Connections("p1") == 0 }, 2*time.Second, 10*time.Millisecond)
+	silent.Close()
+	assert.Equal(t, 1, hub.Connections("p2"), "a connection answering pings stays")
+}
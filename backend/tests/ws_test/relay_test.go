@@ -0,0 +1,311 @@
+package wstest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	"github.com/Sumedhvats/pasteCTL_web/internal/metrics"
+	"github.com/Sumedhvats/pasteCTL_web/internal/ot"
+	"github.com/Sumedhvats/pasteCTL_web/internal/ws"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// duplicatingBus publishes every message twice, as a bus may after a
+// retry.
+type duplicatingBus struct{ ws.Bus }
+
+func (b duplicatingBus) Publish(ctx context.Context, msg []byte) error {
+	if err := b.Bus.Publish(ctx, msg); err != nil {
+		return err
+	}
+	return b.Bus.Publish(ctx, msg)
+}
+
+// lossyBus silently drops the messages containing drop, as a listener
+// misses them while reconnecting.
+type lossyBus struct {
+	ws.Bus
+	drop string
+}
+
+func (b lossyBus) Publish(ctx context.Context, msg []byte) error {
+	if strings.Contains(string(msg), b.drop) {
+		return nil
+	}
+	return b.Bus.Publish(ctx, msg)
+}
+
+// failingBus fails to publish the messages containing fail.
+type failingBus struct {
+	ws.Bus
+	fail string
+}
+
+func (b failingBus) Publish(ctx context.Context, msg []byte) error {
+	if strings.Contains(string(msg), b.fail) {
+		return errors.New("publish failed")
+	}
+	return b.Bus.Publish(ctx, msg)
+}
+
+// stallingBus holds up publishing the messages containing stall until
+// release is closed, as a slow database would.
+type stallingBus struct {
+	ws.Bus
+	stall   string
+	release chan struct{}
+}
+
+func (b stallingBus) Publish(ctx context.Context, msg []byte) error {
+	if strings.Contains(string(msg), b.stall) {
+		<-b.release
+	}
+	return b.Bus.Publish(ctx, msg)
+}
+
+// newReplicas serves two hubs over one store whose buses are wrap applied
+// to one in-memory bus, as two replicas behind a load balancer.
+func newReplicas(t *testing.T, wrap func(ws.Bus) ws.Bus) (a, b string, repo db.Repository) {
+	t.Helper()
+	repo = newRepo(t)
+	bus := ws.NewMemoryBus()
+	configure := func(hub *ws.Hub) {
+		hub.Bus = wrap(bus)
+		hub.SyncTimeout = 100 * time.Millisecond
+	}
+	_, a = serveHub(t, repo, configure)
+	_, b = serveHub(t, repo, configure)
+	return a, b, repo
+}
+
+func same(bus ws.Bus) ws.Bus { return bus }
+
+func TestHub_EditsReachOtherReplicas(t *testing.T) {
+	urlA, urlB, _ := newReplicas(t, same)
+	a := dial(t, urlA+"p1")
+	b := dial(t, urlB+"p1")
+	legacy := dial(t, urlB+"p1")
+	assert.Zero(t, hello(t, a).Rev)
+	assert.Zero(t, hello(t, b).Rev)
+
+	// Concurrent edits on both replicas converge on one order.
+	send(t, a, opMessage(0, ot.Op{}.Insert(">> ").Retain(2)))
+	send(t, b, opMessage(0, ot.Op{}.Retain(2).Insert(" <<")))
+	for _, conn := range []*websocket.Conn{a, b} {
+		var types []string
+		for i := 0; i < 2; i++ {
+			types = append(types, read(t, conn).Type)
+		}
+		assert.ElementsMatch(t, []string{"ack", "op"}, types)
+	}
+	var got message
+	for i := 0; i < 2; i++ {
+		got = read(t, legacy)
+		assert.Equal(t, "content_update", got.Type)
+	}
+	assert.Equal(t, ">> p1 <<", got.Content)
+
+	// Both replicas are at the same revision with the same text.
+	for _, conn := range []*websocket.Conn{a, b} {
+		snap := hello(t, conn)
+		assert.Equal(t, 2, snap.Rev)
+		assert.Equal(t, ">> p1 <<", snap.Content)
+	}
+}
+
+func TestHub_NewRoomSyncsFromOtherReplica(t *testing.T) {
+	urlA, urlB, repo := newReplicas(t, same)
+	a := dial(t, urlA+"p1")
+	hello(t, a)
+	for rev, op := range []ot.Op{ot.Op{}.Retain(2).Insert("a"), ot.Op{}.Retain(3).Insert("b")} {
+		send(t, a, opMessage(rev, op))
+		require.Equal(t, "ack", read(t, a).Type)
+	}
+	p, err := repo.GetPaste(context.Background(), "p1")
+	require.NoError(t, err)
+	require.Equal(t, "p1", p.Content, "nothing is saved yet")
+
+	// The room opening on B takes A's unsaved document, not the paste.
+	b := dial(t, urlB+"p1")
+	snap := hello(t, b)
+	assert.Equal(t, 2, snap.Rev)
+	assert.Equal(t, "p1ab", snap.Content)
+
+	// An edit A's client made against an older revision still applies on
+	// both.
+	send(t, a, opMessage(1, ot.Op{}.Insert("<").Retain(3)))
+	assert.Equal(t, "ack", read(t, a).Type)
+	got := read(t, b)
+	assert.Equal(t, 3, got.Rev)
+	assert.Equal(t, ot.Op{}.Insert("<").Retain(4), got.Op)
+}
+
+func TestHub_DropsDuplicateBusMessages(t *testing.T) {
+	urlA, urlB, _ := newReplicas(t, func(bus ws.Bus) ws.Bus { return duplicatingBus{bus} })
+	a := dial(t, urlA+"p1")
+	b := dial(t, urlB+"p1")
+	hello(t, a)
+	hello(t, b)
+
+	send(t, a, opMessage(0, ot.Op{}.Retain(2).Insert("!")))
+	assert.Equal(t, "ack", read(t, a).Type)
+	got := read(t, b)
+	assert.Equal(t, "op", got.Type)
+	assert.Equal(t, 1, got.Rev)
+	for _, conn := range []*websocket.Conn{a, b} {
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, _, err := conn.ReadMessage()
+		assert.Error(t, err, "the edit is applied once")
+	}
+	assert.Equal(t, "p1!", hello(t, dial(t, urlB+"p1")).Content)
+}
+
+func TestHub_ResyncsAfterMissedBusMessages(t *testing.T) {
+	// The first edit goes missing; the next message from its replica
+	// reveals the gap to every replica.
+	urlA, urlB, _ := newReplicas(t, func(bus ws.Bus) ws.Bus { return lossyBus{Bus: bus, drop: "lost"} })
+	a := dial(t, urlA+"p1")
+	hello(t, a)
+	b := dial(t, urlB+"p1")
+	hello(t, b)
+
+	send(t, a, opMessage(0, ot.Op{}.Retain(2).Insert("lost")))
+	send(t, a, opMessage(0, ot.Op{}.Retain(2).Insert("seen")))
+	for _, conn := range []*websocket.Conn{a, b} {
+		err := readClose(t, conn)
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseTryAgainLater), "got %v", err)
+	}
+
+	// Reconnecting gives a fresh room.
+	b = dial(t, urlB+"p1")
+	snap := hello(t, b)
+	assert.Equal(t, "p1", snap.Content)
+}
+
+func TestHub_FailedPublishResyncsOnlyItsRoom(t *testing.T) {
+	urlA, urlB, _ := newReplicas(t, func(bus ws.Bus) ws.Bus { return failingBus{Bus: bus, fail: "fail"} })
+	a1 := dial(t, urlA+"p1")
+	hello(t, a1)
+	b1 := dial(t, urlB+"p1")
+	hello(t, b1)
+	a2 := dial(t, urlA+"p2")
+	hello(t, a2)
+	b2 := dial(t, urlB+"p2")
+	hello(t, b2)
+
+	// The edit cannot be published, so its room starts afresh here...
+	send(t, a1, opMessage(0, ot.Op{}.Retain(2).Insert("fail")))
+	err := readClose(t, a1)
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseTryAgainLater), "got %v", err)
+
+	// ...and, once the next message reveals the gap, on the other replica,
+	// while the other rooms carry on.
+	send(t, a2, opMessage(0, ot.Op{}.Retain(2).Insert("!")))
+	assert.Equal(t, "ack", read(t, a2).Type)
+	assert.Equal(t, "op", read(t, b2).Type)
+	err = readClose(t, b1)
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseTryAgainLater), "got %v", err)
+}
+
+func TestHub_FullOutboxResyncsItsRoom(t *testing.T) {
+	repo := newRepo(t)
+	bus := ws.NewMemoryBus()
+	release := make(chan struct{})
+	hubA, urlA := serveHub(t, repo, func(hub *ws.Hub) {
+		hub.Bus = stallingBus{Bus: bus, stall: "stall", release: release}
+		hub.OutboxSize = 1
+	})
+	_, urlB := serveHub(t, repo, func(hub *ws.Hub) { hub.Bus = bus })
+	a := dial(t, urlA+"p1")
+	hello(t, a)
+	b := dial(t, urlB+"p1")
+	hello(t, b)
+
+	// The first edit holds up the bus, the second fills the outbox and
+	// the third finds it full.
+	dropped := testutil.ToFloat64(metrics.WSBusMessages.WithLabelValues("dropped"))
+	send(t, a, opMessage(0, ot.Op{}.Retain(2).Insert("stall")))
+	send(t, a, opMessage(0, ot.Op{}.Retain(2).Insert("x")))
+	send(t, a, opMessage(0, ot.Op{}.Retain(2).Insert("y")))
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(metrics.WSBusMessages.WithLabelValues("dropped")) > dropped
+	}, time.Second, 5*time.Millisecond)
+	close(release)
+
+	// The room starts afresh on both replicas.
+	for _, conn := range []*websocket.Conn{a, b} {
+		err := readClose(t, conn)
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseTryAgainLater), "got %v", err)
+	}
+	require.Eventually(t, func() bool { return hubA.Rooms() == 0 }, time.Second, 5*time.Millisecond)
+}
+
+// newSlowReplicas serves two hubs like newReplicas, except that the
+// answers to syncs are held up until release is closed. configureB sets up
+// the second hub further.
+func newSlowReplicas(t *testing.T, configureB func(*ws.Hub)) (a, b string, release chan struct{}) {
+	t.Helper()
+	repo := newRepo(t)
+	bus := ws.NewMemoryBus()
+	release = make(chan struct{})
+	configure := func(hub *ws.Hub) {
+		hub.Bus = stallingBus{Bus: bus, stall: `"kind":"state"`, release: release}
+		hub.SyncTimeout = 100 * time.Millisecond
+	}
+	_, a = serveHub(t, repo, configure)
+	_, b = serveHub(t, repo, func(hub *ws.Hub) {
+		configure(hub)
+		configureB(hub)
+	})
+	return a, b, release
+}
+
+func TestHub_NewRoomAsksAgainForALateDocument(t *testing.T) {
+	urlA, urlB, release := newSlowReplicas(t, func(*ws.Hub) {})
+	a := dial(t, urlA+"p1")
+	hello(t, a)
+	send(t, a, opMessage(0, ot.Op{}.Retain(2).Insert("a")))
+	require.Equal(t, "ack", read(t, a).Type)
+
+	// A answers only after B's first request timed out; B waits on rather
+	// than start from the paste.
+	time.AfterFunc(150*time.Millisecond, func() { close(release) })
+	b := dial(t, urlB+"p1")
+	snap := hello(t, b)
+	assert.Equal(t, "p1a", snap.Content)
+	assert.Equal(t, 1, snap.Rev)
+
+	// Both are in one session: edits go both ways, once each.
+	send(t, b, opMessage(1, ot.Op{}.Retain(3).Insert("b")))
+	assert.Equal(t, "ack", read(t, b).Type)
+	got := read(t, a)
+	assert.Equal(t, "op", got.Type)
+	assert.Equal(t, 2, got.Rev)
+	assert.Equal(t, "p1ab", hello(t, a).Content)
+	assert.Equal(t, "p1ab", hello(t, b).Content)
+}
+
+func TestHub_DocumentAfterGivingUpResyncsRoom(t *testing.T) {
+	urlA, urlB, release := newSlowReplicas(t, func(hub *ws.Hub) { hub.SyncAttempts = 1 })
+	a := dial(t, urlA+"p1")
+	hello(t, a)
+	send(t, a, opMessage(0, ot.Op{}.Retain(2).Insert("a")))
+	require.Equal(t, "ack", read(t, a).Type)
+
+	// B gives up and starts from the paste; A's document arrives after.
+	b := dial(t, urlB+"p1")
+	assert.Equal(t, "p1", hello(t, b).Content)
+	close(release)
+	err := readClose(t, b)
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseTryAgainLater), "got %v", err)
+
+	// The fresh room takes A's document.
+	assert.Equal(t, "p1a", hello(t, dial(t, urlB+"p1")).Content)
+}
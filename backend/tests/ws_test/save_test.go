@@ -0,0 +1,113 @@
+package wstest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Sumedhvats/pasteCTL_web/internal/db"
+	"github.com/Sumedhvats/pasteCTL_web/internal/ot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func revisions(t *testing.T, repo db.Repository, id string) []db.Revision {
+	t.Helper()
+	revs, err := repo.ListRevisions(context.Background(), id, db.MaxRevisions)
+	require.NoError(t, err)
+	return revs
+}
+
+func TestHub_SavesWhenLastMemberLeaves(t *testing.T) {
+	hub, url, repo := newServerWithRepo(t, time.Hour)
+	a := dial(t, url+"p1")
+	b := dial(t, url+"p1")
+	hello(t, a)
+	send(t, a, opMessage(0, ot.Op{}.Retain(2).Insert("!")))
+	require.Equal(t, "ack", read(t, a).Type)
+
+	a.Close()
+	require.Eventually(t, func() bool { return hub.Connections("p1") == 1 }, time.Second, 5*time.Millisecond)
+	assert.Empty(t, revisions(t, repo, "p1"), "the room stays unsaved while someone is editing")
+
+	b.Close()
+	require.Eventually(t, func() bool { return hub.Rooms() == 0 }, time.Second, 5*time.Millisecond)
+	p, err := repo.GetPaste(context.Background(), "p1")
+	require.NoError(t, err)
+	assert.Equal(t, "p1!", p.Content)
+	revs := revisions(t, repo, "p1")
+	require.Len(t, revs, 1)
+	assert.Equal(t, "p1!", revs[0].Content)
+	assert.Equal(t, "go", revs[0].Language)
+}
+
+func TestHub_SavesOnInterval(t *testing.T) {
+	_, url, repo := newServerWithRepo(t, 20*time.Millisecond)
+	a := dial(t, url+"p1")
+	hello(t, a)
+	for rev, text := range []string{"a", "b", "c"} {
+		send(t, a, opMessage(rev, ot.Op{}.Retain(2+rev).Insert(text)))
+		require.Equal(t, "ack", read(t, a).Type)
+	}
+
+	require.Eventually(t, func() bool {
+		p, err := repo.GetPaste(context.Background(), "p1")
+		return err == nil && p.Content == "p1abc"
+	}, time.Second, 5*time.Millisecond)
+	revs := revisions(t, repo, "p1")
+	require.NotEmpty(t, revs)
+	assert.Equal(t, "p1abc", revs[0].Content, "the newest revision is the saved text")
+}
+
+func TestHub_SavesOnShutdown(t *testing.T) {
+	hub, url, repo := newServerWithRepo(t, time.Hour)
+	a := dial(t, url+"p1")
+	b := dial(t, url+"p1")
+	require.Eventually(t, func() bool { return hub.Connections("p1") == 2 }, time.Second, 5*time.Millisecond)
+	send(t, a, map[string]any{"type": "content_update", "content": "edited"})
+	require.Equal(t, "edited", read(t, b).Content)
+
+	// Neither client answers the close frame, so Shutdown gives up
+	// waiting, but the room has been saved by then.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, hub.Shutdown(ctx), context.DeadlineExceeded)
+	p, err := repo.GetPaste(context.Background(), "p1")
+	require.NoError(t, err)
+	assert.Equal(t, "edited", p.Content)
+	assert.Len(t, revisions(t, repo, "p1"), 1)
+}
+
+func TestHub_UnchangedRoomIsNotSaved(t *testing.T) {
+	hub, url, repo := newServerWithRepo(t, time.Millisecond)
+	a := dial(t, url+"p1")
+	hello(t, a)
+	a.Close()
+	require.Eventually(t, func() bool { return hub.Rooms() == 0 }, time.Second, 5*time.Millisecond)
+	assert.Empty(t, revisions(t, repo, "p1"))
+}
+
+func TestHub_ReplaceIsNotOverwritten(t *testing.T) {
+	hub, url, repo := newServerWithRepo(t, time.Hour)
+	a := dial(t, url+"p1")
+	hello(t, a)
+	send(t, a, opMessage(0, ot.Op{}.Retain(2).Insert("!")))
+	require.Equal(t, "ack", read(t, a).Type)
+
+	// A PUT saves new text while the room has unsaved edits.
+	require.NoError(t, repo.UpdatePaste(context.Background(), &db.Paste{ID: "p1", Content: "put", Language: "text"}))
+	hub.Replace("p1", "put", "text")
+	got := read(t, a)
+	assert.Equal(t, "op", got.Type)
+	assert.Equal(t, 2, got.Rev)
+	snap := hello(t, a)
+	assert.Equal(t, "put", snap.Content)
+	assert.Equal(t, "text", snap.Language)
+
+	a.Close()
+	require.Eventually(t, func() bool { return hub.Rooms() == 0 }, time.Second, 5*time.Millisecond)
+	p, err := repo.GetPaste(context.Background(), "p1")
+	require.NoError(t, err)
+	assert.Equal(t, "put", p.Content)
+	assert.Len(t, revisions(t, repo, "p1"), 1, "the room does not save the text again")
+}
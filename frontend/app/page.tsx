@@ -78,6 +78,15 @@ export default function CreatePaste() {
 
       const paste = await response.json();
 
+      // The tokens are only returned once; keep them so this browser can
+      // open the paste's stats later and share an edit link.
+      if (paste.owner_token) {
+        localStorage.setItem(`pasteOwnerToken:${paste.id}`, paste.owner_token);
+      }
+      if (paste.edit_token) {
+        localStorage.setItem(`pasteEditToken:${paste.id}`, paste.edit_token);
+      }
+
       // Set expire_at locally if backend doesn't send it
       if (!paste.expire_at && expireAt) paste.expire_at = expireAt;
 
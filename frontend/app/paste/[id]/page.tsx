@@ -5,11 +5,13 @@ import { useParams, useRouter } from 'next/navigation';
 import { Button } from '@/components/ui/button';
 import { Card, CardContent } from '@/components/ui/card';
 import { Badge } from '@/components/ui/badge';
-import { CreditCard as Edit, Copy, Eye, Calendar, Clock, Plus } from 'lucide-react';
-import { CodeEditor } from '@/components/code-editor';
+import { Input } from '@/components/ui/input';
+import { CreditCard as Edit, Copy, Eye, Calendar, Clock, Plus, Download, Users } from 'lucide-react';
+import { CodeEditor, type RemoteCursor } from '@/components/code-editor';
 import { Header } from '@/components/header';
 import { toast } from 'sonner';
 import { format } from 'date-fns';
+import { OTClient, apply, diff, transformIndex, type Operation } from '@/lib/ot';
 
 interface Paste {
   id: string;
@@ -20,6 +22,41 @@ interface Paste {
   views: number;
 }
 
+type Selection = { anchor: number; head: number };
+
+// Participant is someone in the live session. Cursor offsets are kept in
+// this editor's text, with its unacknowledged edits applied.
+interface Participant {
+  id: string;
+  name: string;
+  color: string;
+  cursor?: Selection | null;
+}
+
+const NAME_KEY = 'pastectl:name';
+
+// PROTOCOL is the live-editing protocol version this page speaks.
+const PROTOCOL = 'pastectl.v1';
+
+// Close codes after which reconnecting cannot help: the paste is gone, the
+// room is full, or the server could not make sense of what we sent.
+const FINAL_CLOSE_CODES = new Set([1003, 1007, 1009, 4404, 4410, 4429]);
+
+// editToken is the token that makes this browser an editor of the paste:
+// the owner token if it created the paste, or an edit token it was given.
+const editToken = (pasteId: string) =>
+  localStorage.getItem(`pasteOwnerToken:${pasteId}`) ??
+  localStorage.getItem(`pasteEditToken:${pasteId}`) ??
+  '';
+
+// moveCursors carries every participant's cursor across an edit.
+const moveCursors = (participants: Participant[], op: Operation) =>
+  participants.map((p) =>
+    p.cursor
+      ? { ...p, cursor: { anchor: transformIndex(p.cursor.anchor, op), head: transformIndex(p.cursor.head, op) } }
+      : p,
+  );
+
 export default function PastePage() {
   const params = useParams();
   const router = useRouter();
@@ -28,18 +65,41 @@ export default function PastePage() {
   const [paste, setPaste] = useState<Paste | null>(null);
   const [isLoading, setIsLoading] = useState(true);
   const [editedContent, setEditedContent] = useState('');
+  const [canShareEdit, setCanShareEdit] = useState(false);
   const [error, setError] = useState<string | null>(null);
 
   const wsRef = useRef<WebSocket | null>(null);
-  const debounceRef = useRef<NodeJS.Timeout | null>(null);
-  const lastSentContentRef = useRef<string>('');
+  // contentRef mirrors the editor text for computing and applying ops.
+  const contentRef = useRef<string>('');
+  const otClientRef = useRef<OTClient | null>(null);
+  // sessionRef names the room session our revisions belong to. resumeRef
+  // is the revision our text matched when the connection dropped, so that
+  // reconnecting asks only for the ops missed since.
+  const sessionRef = useRef('');
+  const resumeRef = useRef<number | null>(null);
+  const [participants, setParticipants] = useState<Participant[]>([]);
+  const [you, setYou] = useState('');
+  const [name, setName] = useState('');
+  // readOnly is set when the server lets us watch but not edit: editing
+  // takes the owner token this browser got when it created the paste.
+  const [readOnly, setReadOnly] = useState(true);
+  // selectionRef is this editor's selection, sent whenever no local edit
+  // is awaiting an ack so that it is in the server's coordinates.
+  const selectionRef = useRef<Selection | null>(null);
+  const selectionDirtyRef = useRef(false);
   const hasIncrementedViews = useRef(false);
 
   // Fetch paste from backend
   const fetchPaste = useCallback(async () => {
     try {
       setIsLoading(true);
-      const response = await fetch(`${process.env.NEXT_PUBLIC_BACKEND_URL}/api/pastes/${pasteId}`);
+      // Count the view with the first load only; refetches just read.
+      const countView = !hasIncrementedViews.current;
+      hasIncrementedViews.current = true;
+      const query = countView
+        ? `?view=1&ref=${encodeURIComponent(document.referrer)}`
+        : '';
+      const response = await fetch(`${process.env.NEXT_PUBLIC_BACKEND_URL}/api/pastes/${pasteId}${query}`);
       if (!response.ok) {
         if (response.status === 404) setError('Paste not found');
         else setError('Failed to load paste');
@@ -48,11 +108,9 @@ export default function PastePage() {
 
       const pasteData = await response.json();
       setPaste(pasteData);
-      setEditedContent(pasteData.content);
-
-      if (!hasIncrementedViews.current) {
-        hasIncrementedViews.current = true;
-        await incrementViews();
+      if (!otClientRef.current) {
+        contentRef.current = pasteData.content;
+        setEditedContent(pasteData.content);
       }
       setError(null);
     } catch (err) {
@@ -63,73 +121,201 @@ export default function PastePage() {
     }
   }, [pasteId]);
 
-  // Increment views
-  const incrementViews = async () => {
-    try {
-      await fetch(`${process.env.NEXT_PUBLIC_BACKEND_URL}/api/pastes/${pasteId}/view`, {
-        method: 'PUT',
-      });
-    } catch (err) {
-      console.error('Error incrementing views:', err);
-    }
-  };
+  // sendSelection reports this editor's selection once it has changed and
+  // every local edit is acknowledged.
+  const sendSelection = useCallback(() => {
+    const ws = wsRef.current;
+    const client = otClientRef.current;
+    if (!selectionDirtyRef.current || !client?.idle || ws?.readyState !== WebSocket.OPEN) return;
+    selectionDirtyRef.current = false;
+    ws.send(JSON.stringify({ type: 'cursor', rev: client.rev, cursor: selectionRef.current }));
+  }, []);
 
   // Initialize always-connected WebSocket
   const initializeWebSocket = useCallback(() => {
     if (wsRef.current?.readyState === WebSocket.OPEN) return;
 
-    const ws = new WebSocket(`${process.env.NEXT_PUBLIC_WS_URL}/api/ws/${pasteId}`);
+    const resume = resumeRef.current;
+    const query = resume !== null
+      ? `?session=${encodeURIComponent(sessionRef.current)}&since=${resume}`
+      : '';
+    const ws = new WebSocket(`${process.env.NEXT_PUBLIC_WS_URL}/api/ws/${pasteId}${query}`, PROTOCOL);
+
+    // hello joins as a participant. Naming the revision we have gets a
+    // catch-up instead of the whole text; without one, the server sends a
+    // snapshot to start over from.
+    const hello = (rev?: number) =>
+      ws.send(JSON.stringify({
+        type: 'hello',
+        name: localStorage.getItem(NAME_KEY) ?? '',
+        token: editToken(pasteId),
+        ...(rev !== undefined && { rev, session: sessionRef.current }),
+      }));
+    const newClient = (rev: number) =>
+      new OTClient(rev, (rev: number, op: Operation) => {
+        ws.send(JSON.stringify({ type: 'op', rev, op }));
+      });
+    // The server sends the room's state first; we say hello once we have it.
+    let joined = false;
+    const join = () => {
+      if (joined || !otClientRef.current) return;
+      joined = true;
+      hello(otClientRef.current.rev);
+    };
 
-    ws.onopen = () => console.log('WebSocket connected');
+    const setContent = (content: string) => {
+      contentRef.current = content;
+      setEditedContent(content);
+    };
+
+    const toLocal = (sel: Selection | null): Selection | null => {
+      const client = otClientRef.current;
+      if (!sel || !client) return null;
+      return { anchor: client.transformIndex(sel.anchor), head: client.transformIndex(sel.head) };
+    };
 
     ws.onmessage = (event) => {
       try {
         const data = JSON.parse(event.data);
-        if (data.type === 'content_update' && data.content !== lastSentContentRef.current) {
-          setEditedContent(data.content);
-          setPaste(prev => prev ? { ...prev, content: data.content } : null);
+        switch (data.type) {
+          case 'snapshot':
+            setContent(data.content);
+            sessionRef.current = data.session;
+            otClientRef.current = newClient(data.rev);
+            setYou(data.you);
+            // Ops are refused until our hello is answered.
+            if (joined) setReadOnly(data.read_only);
+            setParticipants(data.participants);
+            // Tell the others where we are, as of this snapshot.
+            selectionDirtyRef.current = selectionRef.current !== null;
+            sendSelection();
+            join();
+            break;
+          case 'catch_up': {
+            // Ops since the revision we asked from, some of which we may
+            // have applied already.
+            const client = otClientRef.current ?? newClient(data.from);
+            otClientRef.current = client;
+            if (client.rev < data.from) {
+              otClientRef.current = null;
+              hello();
+              break;
+            }
+            let content = contentRef.current;
+            for (let rev = client.rev; rev < data.rev; rev++) {
+              const op = client.applyRemote(rev + 1, data.ops[rev - data.from]);
+              content = apply(content, op);
+              setParticipants((ps) => moveCursors(ps, op));
+            }
+            setContent(content);
+            setYou(data.you);
+            if (joined) setReadOnly(data.read_only);
+            setParticipants(data.participants);
+            selectionDirtyRef.current = selectionRef.current !== null;
+            sendSelection();
+            join();
+            break;
+          }
+          case 'op':
+            if (otClientRef.current) {
+              const op = otClientRef.current.applyRemote(data.rev, data.op);
+              setContent(apply(contentRef.current, op));
+              setParticipants((ps) => moveCursors(ps, op));
+            }
+            break;
+          case 'ack':
+            otClientRef.current?.ack(data.rev);
+            sendSelection();
+            break;
+          case 'join':
+            setParticipants((ps) => {
+              const i = ps.findIndex((p) => p.id === data.participant.id);
+              if (i < 0) return [...ps, data.participant];
+              // A participant changed its name or colour.
+              return ps.map((p, j) => (j === i ? { ...data.participant, cursor: p.cursor } : p));
+            });
+            break;
+          case 'leave':
+            setParticipants((ps) => ps.filter((p) => p.id !== data.id));
+            break;
+          case 'cursor': {
+            const cursor = toLocal(data.cursor);
+            setParticipants((ps) => ps.map((p) => (p.id === data.id ? { ...p, cursor } : p)));
+            break;
+          }
+          case 'error':
+            if (data.code === 'read_only') {
+              setReadOnly(true);
+              break;
+            }
+            // Our state no longer matches the server's; start over.
+            console.warn(`Live editing error (${data.code}), resyncing:`, data.message);
+            otClientRef.current = null;
+            hello();
+            break;
         }
       } catch (err) {
-        console.error('Error parsing WebSocket message:', err);
+        console.error('Error handling WebSocket message:', err);
       }
     };
 
     ws.onerror = (err) => console.error('WebSocket error:', err);
 
-    ws.onclose = () => {
+    ws.onclose = (event) => {
+      const client = otClientRef.current;
+      resumeRef.current = client?.idle ? client.rev : null;
+      otClientRef.current = null;
+      setParticipants([]);
+      setReadOnly(true);
+      if (FINAL_CLOSE_CODES.has(event.code)) {
+        console.warn(`WebSocket closed (${event.code} ${event.reason}), not reconnecting`);
+        return;
+      }
       console.log('WebSocket disconnected, reconnecting in 2s...');
       setTimeout(() => initializeWebSocket(), 2000);
     };
 
     wsRef.current = ws;
-  }, [pasteId]);
-
-  // Debounced auto-save + WebSocket update
-  const sendContentUpdate = useCallback((content: string) => {
-    if (content === lastSentContentRef.current) return;
+  }, [pasteId, sendSelection]);
 
-    lastSentContentRef.current = content;
+  const handleSelectionChange = useCallback((selection: Selection | null) => {
+    selectionRef.current = selection;
+    selectionDirtyRef.current = true;
+    sendSelection();
+  }, [sendSelection]);
 
-    // WebSocket
-    if (wsRef.current?.readyState === WebSocket.OPEN) {
-      wsRef.current.send(JSON.stringify({ type: 'content_update', content }));
+  // Collaborative edit. The live room saves the document to the paste
+  // itself, so there is no separate auto-save.
+  const sendContentUpdate = useCallback((content: string) => {
+    const op = diff(contentRef.current, content);
+    contentRef.current = content;
+    // Text changed while disconnected no longer matches any revision.
+    if (!otClientRef.current) resumeRef.current = null;
+    otClientRef.current?.applyLocal(op);
+    setParticipants((ps) => moveCursors(ps, op));
+  }, []);
+
+  // Rename takes effect with a repeated hello, which also resynchronises,
+  // so it waits until no local edit is in flight.
+  const saveName = () => {
+    const trimmed = name.trim();
+    if (trimmed === (localStorage.getItem(NAME_KEY) ?? '')) return;
+    localStorage.setItem(NAME_KEY, trimmed);
+    const client = otClientRef.current;
+    if (trimmed && client?.idle && wsRef.current?.readyState === WebSocket.OPEN) {
+      wsRef.current.send(JSON.stringify({
+        type: 'hello',
+        name: trimmed,
+        token: editToken(pasteId),
+        rev: client.rev,
+        session: sessionRef.current,
+      }));
     }
+  };
 
-    // Debounced backend save
-    if (debounceRef.current) clearTimeout(debounceRef.current);
-    debounceRef.current = setTimeout(async () => {
-      try {
-        await fetch(`${process.env.NEXT_PUBLIC_BACKEND_URL}/api/pastes/${pasteId}`, {
-          method: 'PUT',
-          headers: { 'Content-Type': 'application/json' },
-          body: JSON.stringify({ content }),
-        });
-        console.log('Auto-saved paste to backend');
-      } catch (err) {
-        console.error('Error auto-saving paste:', err);
-      }
-    }, 1000);
-  }, [pasteId]);
+  const remoteCursors: RemoteCursor[] = participants.flatMap((p) =>
+    p.id !== you && p.cursor ? [{ id: p.id, name: p.name, color: p.color, ...p.cursor }] : [],
+  );
 
   // Handle editor change
   const handleContentChange = useCallback((value: string) => {
@@ -147,11 +333,31 @@ export default function PastePage() {
     }
   };
 
+  // Share an edit link, which makes its visitors editors
+  const copyEditLink = async () => {
+    const token = localStorage.getItem(`pasteEditToken:${pasteId}`);
+    if (!token) return;
+    try {
+      await navigator.clipboard.writeText(`${window.location.origin}/paste/${pasteId}#edit=${encodeURIComponent(token)}`);
+      toast.success('Edit link copied');
+    } catch {
+      toast.error('Failed to copy');
+    }
+  };
+
   // View raw paste
   const viewRaw = () => {
     window.open(`${process.env.NEXT_PUBLIC_BACKEND_URL}/api/pastes/${pasteId}/raw`, '_blank');
   };
 
+  // Download paste as a text file
+  const downloadRaw = () => {
+    const link = document.createElement('a');
+    link.href = `${process.env.NEXT_PUBLIC_BACKEND_URL}/api/pastes/${pasteId}/raw?download=1`;
+    link.download = `${pasteId}.txt`;
+    link.click();
+  };
+
   // Create new paste
   const createNewPaste = () => router.push('/');
 
@@ -165,14 +371,22 @@ export default function PastePage() {
 
   // Initialize everything on mount
   useEffect(() => {
+    setName(localStorage.getItem(NAME_KEY) ?? '');
+    // An edit link carries its token in the fragment, which never reaches
+    // the server; keep it and tidy the address.
+    const shared = new URLSearchParams(window.location.hash.slice(1)).get('edit');
+    if (shared) {
+      localStorage.setItem(`pasteEditToken:${pasteId}`, shared);
+      window.history.replaceState(null, '', window.location.pathname + window.location.search);
+    }
+    setCanShareEdit(localStorage.getItem(`pasteEditToken:${pasteId}`) !== null);
     fetchPaste();
     initializeWebSocket();
 
     return () => {
       if (wsRef.current) wsRef.current.close();
-      if (debounceRef.current) clearTimeout(debounceRef.current);
     };
-  }, [fetchPaste, initializeWebSocket]);
+  }, [pasteId, fetchPaste, initializeWebSocket]);
 
   if (isLoading) {
     return (
@@ -209,9 +423,17 @@ export default function PastePage() {
             <Button onClick={copyToClipboard} variant="secondary" className="bg-slate-700 hover:bg-slate-600 text-white">
               <Copy className="w-4 h-4 mr-2" /> Copy
             </Button>
+            {canShareEdit && (
+              <Button onClick={copyEditLink} variant="secondary" className="bg-slate-700 hover:bg-slate-600 text-white">
+                <Edit className="w-4 h-4 mr-2" /> Edit link
+              </Button>
+            )}
             <Button onClick={viewRaw} variant="secondary" className="bg-slate-700 hover:bg-slate-600 text-white">
               Raw
             </Button>
+            <Button onClick={downloadRaw} variant="secondary" className="bg-slate-700 hover:bg-slate-600 text-white">
+              <Download className="w-4 h-4 mr-2" /> Download
+            </Button>
           </div>
         </div>
 
@@ -221,8 +443,10 @@ export default function PastePage() {
               value={editedContent}
               onChange={handleContentChange}
               language={paste.language}
-              readOnly={false}
+              readOnly={readOnly}
               height="500px"
+              remoteCursors={remoteCursors}
+              onSelectionChange={handleSelectionChange}
             />
           </div>
 
@@ -263,10 +487,32 @@ export default function PastePage() {
 
             <Card className="bg-slate-800 border-slate-700">
               <CardContent className="p-6">
-                <div className="flex items-center gap-2">
+                <div className="flex items-center gap-2 mb-4">
                   <div className="w-2 h-2 bg-emerald-400 rounded-full animate-pulse"></div>
-                  <span className="text-sm text-emerald-400">Live editing</span>
+                  <span className="text-sm text-emerald-400">{readOnly ? 'Live (view only)' : 'Live editing'}</span>
+                </div>
+                <div className="flex items-center gap-2 mb-3">
+                  <Users className="w-4 h-4 text-slate-400" />
+                  <span className="text-sm text-slate-400">{participants.length} here</span>
                 </div>
+                <ul className="space-y-2 mb-4">
+                  {participants.map((p) => (
+                    <li key={p.id} className="flex items-center gap-2 text-sm text-white">
+                      <span className="w-2 h-2 rounded-full" style={{ backgroundColor: p.color }} />
+                      {p.name}
+                      {p.id === you && <span className="text-slate-400">(you)</span>}
+                    </li>
+                  ))}
+                </ul>
+                <Input
+                  value={name}
+                  onChange={(e) => setName(e.target.value)}
+                  onBlur={saveName}
+                  onKeyDown={(e) => e.key === 'Enter' && saveName()}
+                  placeholder="Your name"
+                  maxLength={40}
+                  className="bg-slate-700 border-slate-600 text-white"
+                />
               </CardContent>
             </Card>
           </div>
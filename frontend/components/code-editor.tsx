@@ -2,6 +2,17 @@
 
 import { useEffect, useRef, useState } from 'react';
 import Editor from '@monaco-editor/react';
+import { toCodePoints, toUTF16 } from '@/lib/ot';
+
+// RemoteCursor is another participant's cursor or selection. Offsets count
+// code points, like the live-editing protocol.
+export interface RemoteCursor {
+  id: string;
+  name: string;
+  color: string;
+  anchor: number;
+  head: number;
+}
 
 interface CodeEditorProps {
   value: string;
@@ -10,6 +21,9 @@ interface CodeEditorProps {
   placeholder?: string;
   readOnly?: boolean;
   height?: string;
+  remoteCursors?: RemoteCursor[];
+  // Called with the local selection in code points, or null on blur.
+  onSelectionChange?: (selection: { anchor: number; head: number } | null) => void;
 }
 
 export function CodeEditor({
@@ -18,15 +32,59 @@ export function CodeEditor({
   language,
   placeholder = "Start typing your code...",
   readOnly = false,
-  height = "400px"
+  height = "400px",
+  remoteCursors = [],
+  onSelectionChange,
 }: CodeEditorProps) {
   const editorRef = useRef<any>(null);
+  const monacoRef = useRef<any>(null);
+  const decorationsRef = useRef<string[]>([]);
+  const onSelectionChangeRef = useRef(onSelectionChange);
+  onSelectionChangeRef.current = onSelectionChange;
   const [isEditorReady, setIsEditorReady] = useState(false);
 
+  // Draw the other participants' cursors and selections.
+  useEffect(() => {
+    const editor = editorRef.current;
+    const monaco = monacoRef.current;
+    const model = editor?.getModel();
+    if (!isEditorReady || !model) return;
+    const text = model.getValue();
+    const decorations = remoteCursors.map((c) => {
+      const anchor = model.getPositionAt(toUTF16(text, c.anchor));
+      const head = model.getPositionAt(toUTF16(text, c.head));
+      const caret = `remote-${c.id}-caret`;
+      return {
+        range: new monaco.Range(anchor.lineNumber, anchor.column, head.lineNumber, head.column),
+        options: {
+          className: c.anchor === c.head ? undefined : `remote-${c.id}-selection`,
+          // The caret sits at the head, whichever end of the range it is.
+          beforeContentClassName: c.head < c.anchor ? caret : undefined,
+          afterContentClassName: c.head >= c.anchor ? caret : undefined,
+          hoverMessage: { value: c.name },
+          stickiness: monaco.editor.TrackedRangeStickiness.NeverGrowsWhenTypingAtEdges,
+        },
+      };
+    });
+    decorationsRef.current = editor.deltaDecorations(decorationsRef.current, decorations);
+  }, [remoteCursors, value, isEditorReady]);
+
   const handleEditorDidMount = (editor: any, monaco: any) => {
     editorRef.current = editor;
+    monacoRef.current = monaco;
     setIsEditorReady(true);
 
+    editor.onDidChangeCursorSelection((e: any) => {
+      const model = editor.getModel();
+      if (!model) return;
+      const text = model.getValue();
+      onSelectionChangeRef.current?.({
+        anchor: toCodePoints(text, model.getOffsetAt(e.selection.getSelectionStart())),
+        head: toCodePoints(text, model.getOffsetAt(e.selection.getPosition())),
+      });
+    });
+    editor.onDidBlurEditorText(() => onSelectionChangeRef.current?.(null));
+
     // Configure Monaco theme
     monaco.editor.defineTheme('pasteCTLTheme', {
       base: 'vs-dark',
@@ -105,6 +163,12 @@ export function CodeEditor({
 
   return (
     <div className="relative">
+      <style>
+        {remoteCursors.map((c) => `
+          .remote-${c.id}-caret { border-left: 2px solid ${c.color}; margin-left: -1px; }
+          .remote-${c.id}-selection { background-color: ${c.color}40; }
+        `).join('')}
+      </style>
       <div className="bg-slate-800 rounded-lg border border-slate-700 overflow-hidden">
         <Editor
           height={height}
@@ -0,0 +1,252 @@
+// Operational transformation for plain text, matching the server's
+// internal/ot package. An operation walks the whole document: a positive
+// number retains that many characters, a negative one deletes them and a
+// string inserts it. Lengths count Unicode code points, not UTF-16 units.
+
+export type Component = number | string;
+export type Operation = Component[];
+
+const chars = (s: string) => Array.from(s);
+
+function retain(op: Operation, n: number) {
+  if (n <= 0) return;
+  const last = op[op.length - 1];
+  if (typeof last === 'number' && last > 0) op[op.length - 1] = last + n;
+  else op.push(n);
+}
+
+function insert(op: Operation, s: string) {
+  if (s === '') return;
+  const last = op[op.length - 1];
+  if (typeof last === 'string') {
+    op[op.length - 1] = last + s;
+  } else if (typeof last === 'number' && last < 0) {
+    // Keep inserts ahead of deletes at the same position.
+    const prev = op[op.length - 2];
+    if (typeof prev === 'string') op[op.length - 2] = prev + s;
+    else op.splice(op.length - 1, 0, s);
+  } else {
+    op.push(s);
+  }
+}
+
+function del(op: Operation, n: number) {
+  if (n <= 0) return;
+  const last = op[op.length - 1];
+  if (typeof last === 'number' && last < 0) op[op.length - 1] = last - n;
+  else op.push(-n);
+}
+
+export function isNoop(op: Operation): boolean {
+  return op.length === 0 || (op.length === 1 && typeof op[0] === 'number' && op[0] > 0);
+}
+
+export function apply(doc: string, op: Operation): string {
+  const src = chars(doc);
+  const out: string[] = [];
+  let i = 0;
+  for (const c of op) {
+    if (typeof c === 'string') out.push(c);
+    else if (c > 0) {
+      out.push(src.slice(i, i + c).join(''));
+      i += c;
+    } else i -= c;
+  }
+  if (i !== src.length) throw new Error('operation length does not match the document');
+  return out.join('');
+}
+
+// diff returns the operation turning before into after, as one changed
+// region between their common prefix and suffix.
+export function diff(before: string, after: string): Operation {
+  const a = chars(before);
+  const b = chars(after);
+  let prefix = 0;
+  while (prefix < a.length && prefix < b.length && a[prefix] === b[prefix]) prefix++;
+  let suffix = 0;
+  while (
+    suffix < a.length - prefix &&
+    suffix < b.length - prefix &&
+    a[a.length - 1 - suffix] === b[b.length - 1 - suffix]
+  ) suffix++;
+  const op: Operation = [];
+  retain(op, prefix);
+  insert(op, b.slice(prefix, b.length - suffix).join(''));
+  del(op, a.length - prefix - suffix);
+  retain(op, suffix);
+  return op;
+}
+
+// Cursor over an operation that splits retains and deletes as they are
+// consumed.
+class Walker {
+  private i = 0;
+  cur: Component | undefined;
+  constructor(private op: Operation) {
+    this.next();
+  }
+  next() {
+    this.cur = this.op[this.i++];
+  }
+  take(n: number) {
+    const c = this.cur as number;
+    const left = c > 0 ? c - n : c + n;
+    if (left === 0) this.next();
+    else this.cur = left;
+  }
+}
+
+const span = (c: Component) => Math.abs(c as number);
+
+// transform returns [a', b'] for concurrent a and b such that applying a
+// then b' equals applying b then a'. On a tie a's insert comes first.
+export function transform(a: Operation, b: Operation): [Operation, Operation] {
+  const a1: Operation = [];
+  const b1: Operation = [];
+  const wa = new Walker(a);
+  const wb = new Walker(b);
+  while (wa.cur !== undefined || wb.cur !== undefined) {
+    if (typeof wa.cur === 'string') {
+      insert(a1, wa.cur);
+      retain(b1, chars(wa.cur).length);
+      wa.next();
+      continue;
+    }
+    if (typeof wb.cur === 'string') {
+      retain(a1, chars(wb.cur).length);
+      insert(b1, wb.cur);
+      wb.next();
+      continue;
+    }
+    if (wa.cur === undefined || wb.cur === undefined) {
+      throw new Error('operations do not share a base document');
+    }
+    const n = Math.min(span(wa.cur), span(wb.cur));
+    if (wa.cur > 0 && wb.cur > 0) {
+      retain(a1, n);
+      retain(b1, n);
+    } else if (wa.cur < 0 && wb.cur > 0) {
+      del(a1, n);
+    } else if (wa.cur > 0 && wb.cur < 0) {
+      del(b1, n);
+    }
+    wa.take(n);
+    wb.take(n);
+  }
+  return [a1, b1];
+}
+
+// compose returns one operation with the effect of a followed by b.
+export function compose(a: Operation, b: Operation): Operation {
+  const out: Operation = [];
+  const wa = new Walker(a);
+  const wb = new Walker(b);
+  while (wa.cur !== undefined || wb.cur !== undefined) {
+    if (typeof wa.cur === 'number' && wa.cur < 0) {
+      del(out, -wa.cur);
+      wa.next();
+      continue;
+    }
+    if (typeof wb.cur === 'string') {
+      insert(out, wb.cur);
+      wb.next();
+      continue;
+    }
+    if (wa.cur === undefined || wb.cur === undefined) {
+      throw new Error('operations cannot be composed');
+    }
+    if (typeof wa.cur === 'string') {
+      const s = chars(wa.cur);
+      const n = Math.min(s.length, span(wb.cur));
+      if (wb.cur > 0) insert(out, s.slice(0, n).join(''));
+      // A delete in b removes text a inserted: neither survives.
+      if (n === s.length) wa.next();
+      else wa.cur = s.slice(n).join('');
+      wb.take(n);
+      continue;
+    }
+    const n = Math.min(span(wa.cur), span(wb.cur));
+    if (wb.cur > 0) retain(out, n);
+    else del(out, n);
+    wa.take(n);
+    wb.take(n);
+  }
+  return out;
+}
+
+// transformIndex maps a position in the document op applies to onto the
+// document it produces. Text inserted at the position lands before it,
+// and a position inside deleted text moves to the start of the deletion.
+export function transformIndex(index: number, op: Operation): number {
+  let out = index;
+  let at = 0;
+  for (const c of op) {
+    if (at > index) break;
+    if (typeof c === 'string') out += chars(c).length;
+    else if (c > 0) at += c;
+    else {
+      out -= Math.min(-c, index - at);
+      at -= c;
+    }
+  }
+  return out;
+}
+
+// Editors count UTF-16 units while operations count code points; these
+// convert offsets into text between the two.
+export const toCodePoints = (text: string, utf16: number) => chars(text.slice(0, utf16)).length;
+export const toUTF16 = (text: string, codePoints: number) => chars(text).slice(0, codePoints).join('').length;
+
+type Send = (rev: number, op: Operation) => void;
+
+// OTClient tracks one editor's state against the server: at most one op
+// in flight awaiting an ack, and local edits made meanwhile buffered into
+// a single op.
+export class OTClient {
+  private inflight: Operation | null = null;
+  private buffer: Operation | null = null;
+
+  constructor(public rev: number, private send: Send) {}
+
+  // applyLocal records an edit made in this editor.
+  applyLocal(op: Operation) {
+    if (isNoop(op)) return;
+    if (this.inflight === null) {
+      this.inflight = op;
+      this.send(this.rev, op);
+    } else {
+      this.buffer = this.buffer === null ? op : compose(this.buffer, op);
+    }
+  }
+
+  // applyRemote takes another client's op at revision rev and returns it
+  // transformed to apply on top of this editor's unacknowledged edits.
+  applyRemote(rev: number, op: Operation): Operation {
+    if (this.inflight !== null) [this.inflight, op] = transform(this.inflight, op);
+    if (this.buffer !== null) [this.buffer, op] = transform(this.buffer, op);
+    this.rev = rev;
+    return op;
+  }
+
+  // idle reports whether every local edit has been acknowledged, so the
+  // local text is the server's text at rev.
+  get idle(): boolean {
+    return this.inflight === null;
+  }
+
+  // transformIndex maps a position in the server's text at rev onto the
+  // local text, which has the unacknowledged edits on top.
+  transformIndex(index: number): number {
+    if (this.inflight !== null) index = transformIndex(index, this.inflight);
+    if (this.buffer !== null) index = transformIndex(index, this.buffer);
+    return index;
+  }
+
+  // ack confirms the op in flight, which became revision rev.
+  ack(rev: number) {
+    this.rev = rev;
+    this.inflight = this.buffer;
+    this.buffer = null;
+    if (this.inflight !== null) this.send(this.rev, this.inflight);
+  }
+}